@@ -0,0 +1,47 @@
+package rest
+
+import "time"
+
+// AchievementCondition условие над событиями одного типа. Заполненные поля проверяются все вместе.
+type AchievementCondition struct {
+	Event string `json:"event" mapstructure:"event"`
+	// Сколько раз событие должно произойти
+	Count int `json:"count,omitempty" mapstructure:"count"`
+	// Сумма значений событий, например заработанных монет
+	Total int `json:"total,omitempty" mapstructure:"total"`
+	// Наибольшее значение одного события, например день серии
+	Value int `json:"value,omitempty" mapstructure:"value"`
+}
+
+// Achievement достижение из каталога. Открывается, когда выполнены все условия.
+type Achievement struct {
+	Code        string `json:"code" mapstructure:"code"`
+	Title       string `json:"title" mapstructure:"title"`
+	Description string `json:"description" mapstructure:"description"`
+	// Сколько монет выдается при открытии, 0 - без награды
+	Coins      int                    `json:"coins" mapstructure:"coins"`
+	Conditions []AchievementCondition `json:"conditions" mapstructure:"conditions"`
+}
+
+// AchievementCounter накопленная статистика пользователя по одному типу событий.
+type AchievementCounter struct {
+	UserID   int    `db:"user_id"`
+	Event    string `db:"event"`
+	Count    int    `db:"count"`
+	Total    int    `db:"total"`
+	MaxValue int    `db:"max_value"`
+}
+
+// UserAchievement открытое пользователем достижение.
+type UserAchievement struct {
+	UserID     int       `db:"user_id"`
+	Code       string    `db:"code"`
+	UnlockedAt time.Time `db:"unlocked_at"`
+}
+
+// AchievementStatus достижение каталога с отметкой, открыто ли оно пользователем.
+type AchievementStatus struct {
+	Achievement
+	Unlocked   bool       `json:"unlocked"`
+	UnlockedAt *time.Time `json:"unlockedAt"`
+}
@@ -0,0 +1,154 @@
+package rest
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// Роли в клане, чем меньше id, тем выше ранг
+const (
+	// Глава клана, получает роль при создании
+	ClanRoleLeader = 1
+	// Самая младшая роль
+	ClanRoleLowest = 5
+)
+
+// Права ролей в клане
+const (
+	ClanPermissionInvite          = "invite"
+	ClanPermissionKick            = "kick"
+	ClanPermissionEditDescription = "editDescription"
+	ClanPermissionSpendTreasury   = "spendTreasury"
+	ClanPermissionManageRoles     = "manageRoles"
+)
+
+// Виды приглашений
+const (
+	// Клан пригласил пользователя, отвечает пользователь
+	ClanInviteKindInvite = "invite"
+	// Пользователь попросился в клан, отвечает клан
+	ClanInviteKindRequest = "request"
+)
+
+// ClanMetadata произвольные данные клана (поле other): эмблема, цвета, ссылки. Хранится в JSONB.
+type ClanMetadata map[string]interface{}
+
+func (m ClanMetadata) Value() (driver.Value, error) {
+	if m == nil {
+		return nil, nil
+	}
+	return json.Marshal(m)
+}
+
+func (m *ClanMetadata) Scan(src interface{}) error {
+	var data []byte
+	switch v := src.(type) {
+	case nil:
+		*m = nil
+		return nil
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return errors.New("unsupported type for clan metadata")
+	}
+	return json.Unmarshal(data, m)
+}
+
+// Clan клан игроков.
+type Clan struct {
+	ID           int          `json:"id" db:"id"`
+	Name         string       `json:"name" db:"name"`
+	Description  *string      `json:"description" db:"description"`
+	Other        ClanMetadata `json:"other" db:"other"`
+	MembersCount int          `json:"membersCount" db:"members_count"`
+}
+
+// ClanInput создание клана.
+type ClanInput struct {
+	Name        string       `json:"name" binding:"required"`
+	Description *string      `json:"description"`
+	Other       ClanMetadata `json:"other"`
+}
+
+// ClanUpdateInput изменение клана, не переданные поля не меняются.
+type ClanUpdateInput struct {
+	Description *string      `json:"description"`
+	Other       ClanMetadata `json:"other"`
+}
+
+// ClanMember участник клана.
+type ClanMember struct {
+	ClanID int     `json:"-" db:"clan_id"`
+	UserID int     `json:"userId" db:"user_id"`
+	Name   string  `json:"name" db:"name"`
+	Icon   *string `json:"icon" db:"icon"`
+	RoleID int     `json:"role" db:"role_id"`
+	// Название роли, заданное кланом, или стандартное
+	RoleName string    `json:"roleName" db:"role_name"`
+	JoinedAt time.Time `json:"joinedAt" db:"joined_at"`
+}
+
+// ClanPermissions что может роль в клане.
+type ClanPermissions struct {
+	Invite          bool `json:"invite" db:"invite"`
+	Kick            bool `json:"kick" db:"kick"`
+	EditDescription bool `json:"editDescription" db:"edit_description"`
+	SpendTreasury   bool `json:"spendTreasury" db:"spend_treasury"`
+	// Повышать и понижать участников ниже рангом
+	ManageRoles bool `json:"manageRoles" db:"manage_roles"`
+}
+
+// Allows роль имеет право permission, см. ClanPermission*.
+func (p ClanPermissions) Allows(permission string) bool {
+	switch permission {
+	case ClanPermissionInvite:
+		return p.Invite
+	case ClanPermissionKick:
+		return p.Kick
+	case ClanPermissionEditDescription:
+		return p.EditDescription
+	case ClanPermissionSpendTreasury:
+		return p.SpendTreasury
+	case ClanPermissionManageRoles:
+		return p.ManageRoles
+	}
+	return false
+}
+
+// ClanRole роль в клане с названием и правами.
+type ClanRole struct {
+	ID int `json:"id" db:"id"`
+	// Название, заданное кланом, или стандартное
+	Name        string          `json:"name" db:"name"`
+	DefaultName string          `json:"defaultName" db:"default_name"`
+	Permissions ClanPermissions `json:"permissions" db:"-"`
+}
+
+// ClanRoleInput изменение роли главой клана, не переданные поля не меняются.
+type ClanRoleInput struct {
+	// Пустое название возвращает стандартное
+	Name        *string          `json:"name"`
+	Permissions *ClanPermissions `json:"permissions"`
+}
+
+// ClanInvite приглашение в клан или заявка на вступление.
+type ClanInvite struct {
+	ID       int    `json:"id" db:"id"`
+	ClanID   int    `json:"clanId" db:"clan_id"`
+	ClanName string `json:"clanName" db:"clan_name"`
+	UserID   int    `json:"userId" db:"user_id"`
+	UserName string `json:"userName" db:"user_name"`
+	Kind     string `json:"kind" db:"kind"`
+	// Кто пригласил, у заявок nil
+	InvitedBy *int      `json:"invitedBy" db:"invited_by"`
+	CreatedAt time.Time `json:"createdAt" db:"created_at"`
+}
+
+// ClanInviteInput кого пригласить в клан.
+type ClanInviteInput struct {
+	UserID int `json:"userId" binding:"required,gt=0"`
+}
@@ -1,58 +1,93 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
+	// База часовых поясов внутри бинарника, в образе alpine ее нет
+	_ "time/tzdata"
 
 	"github.com/ArtemChadaev/go"
+	"github.com/ArtemChadaev/go/pkg/app"
 	"github.com/ArtemChadaev/go/pkg/handler"
-	"github.com/ArtemChadaev/go/pkg/repository"
-	"github.com/ArtemChadaev/go/pkg/service"
-	"github.com/joho/godotenv"
+	"github.com/fsnotify/fsnotify"
 	_ "github.com/lib/pq"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
 )
 
+// Сколько ждем завершения запросов и фоновых задач при остановке
+const shutdownTimeout = 30 * time.Second
+
 func main() {
 	logrus.SetFormatter(new(logrus.JSONFormatter))
-	if err := initConfig(); err != nil {
+	if err := app.InitConfig(); err != nil {
 		logrus.Fatalf("%s", err.Error())
 	}
-
-	if err := godotenv.Load(); err != nil {
+	deps, err := app.New()
+	if err != nil {
 		logrus.Fatalf("%s", err.Error())
 	}
-	db, err := repository.NewPostgresDB(repository.PostgresConfig{
-		Host:     viper.GetString("db.host"),
-		Port:     viper.GetString("db.port"),
-		Username: viper.GetString("db.username"),
-		Database: viper.GetString("db.database"),
-		SSLMode:  viper.GetString("db.sslmode"),
-		Password: os.Getenv("DB_PASSWORD"),
-	})
+	rateLimit, err := rateLimitConfig()
 	if err != nil {
-		logrus.Fatalf("%s", err.Error())
+		logrus.Fatalf("error reading rate limit config: %s", err.Error())
 	}
-	redis, err := repository.NewRedisClient(repository.RedisConfig{
-		Addr:     viper.GetString("redis.addr"),
-		Password: os.Getenv("REDIS_PASSWORD"),
-		DB:       viper.GetInt("redis.db"),
-	})
+	handlers, err := handler.NewHandler(deps.Services, deps.Redis, rateLimit, viper.GetStringSlice("trustedProxies"))
 	if err != nil {
-		logrus.Fatalf("%s", err.Error())
+		logrus.Fatalf("error handler config: %s", err.Error())
 	}
-	repos := repository.NewRepository(db)
-	services := service.NewService(repos, redis)
-	handlers := handler.NewHandler(services, redis)
+
+	// Лимиты можно менять в конфиге без перезапуска
+	viper.OnConfigChange(func(e fsnotify.Event) {
+		rateLimit, err := rateLimitConfig()
+		if err == nil {
+			err = handlers.SetRateLimitConfig(rateLimit)
+		}
+		if err != nil {
+			logrus.Errorf("error reloading rate limit config from %s: %s", e.Name, err.Error())
+		}
+	})
+	viper.WatchConfig()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Задачи очереди выполняются здесь же или только в cmd/worker
+	jobsDone := make(chan struct{})
+	go func() {
+		deps.Run(ctx, deps.Tasks.InProcess())
+		close(jobsDone)
+	}()
 
 	srv := new(rest.Server)
-	if err := srv.Run(viper.GetString("port"), handlers.InitRoutes()); err != nil {
-		logrus.Fatalf("error http: %s", err.Error())
+	go func() {
+		if err := srv.Run(viper.GetString("port"), handlers.InitRoutes()); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logrus.Fatalf("error http: %s", err.Error())
+		}
+	}()
+
+	<-ctx.Done()
+	logrus.Info("shutting down")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		logrus.Errorf("error http shutdown: %s", err.Error())
+	}
+	// Планировщик, очередь и обработчики событий дожидаются начатой работы, планировщик отдает лидерство другой реплике
+	select {
+	case <-jobsDone:
+	case <-shutdownCtx.Done():
+		logrus.Error("background jobs did not stop in time")
 	}
 }
 
-func initConfig() error {
-	viper.AddConfigPath("configs")
-	viper.SetConfigName("config")
-	return viper.ReadInConfig()
+func rateLimitConfig() (handler.RateLimitConfig, error) {
+	var cfg handler.RateLimitConfig
+	err := viper.UnmarshalKey("rateLimit", &cfg)
+	return cfg, err
 }
@@ -0,0 +1,50 @@
+// Локальная тестовая платежная система, чтобы пройти покупку целиком без настоящего провайдера.
+// Сервис должен быть настроен на нее в секции payments (provider: mock, mock.url) и знать тот же MOCKPAY_SECRET.
+package main
+
+import (
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/ArtemChadaev/go/pkg/payment"
+	"github.com/joho/godotenv"
+	"github.com/sirupsen/logrus"
+)
+
+func main() {
+	logrus.SetFormatter(new(logrus.JSONFormatter))
+	_ = godotenv.Load()
+
+	secret := os.Getenv("MOCKPAY_SECRET")
+	if secret == "" {
+		logrus.Fatal("MOCKPAY_SECRET is not set")
+	}
+	addr := getEnv("MOCKPAY_ADDR", ":8090")
+
+	server := payment.NewMockServer(payment.MockServerConfig{
+		PublicURL:  getEnv("MOCKPAY_PUBLIC_URL", "http://localhost:8090"),
+		WebhookURL: getEnv("MOCKPAY_WEBHOOK_URL", "http://localhost:8080/webhooks/payments/mock"),
+		Secret:     secret,
+		// Любое непустое значение, чтобы проверить неудачное автопродление
+		DeclineCharges: os.Getenv("MOCKPAY_DECLINE_CHARGES") != "",
+	})
+
+	srv := &http.Server{
+		Addr:         addr,
+		Handler:      server.Handler(),
+		ReadTimeout:  10 * time.Second,
+		WriteTimeout: 10 * time.Second,
+	}
+	logrus.Infof("mockpay listening on %s", addr)
+	if err := srv.ListenAndServe(); err != nil {
+		logrus.Fatalf("error http: %s", err.Error())
+	}
+}
+
+func getEnv(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
@@ -0,0 +1,32 @@
+// Отдельный процесс для фоновой работы: выполняет задачи очереди, обработчики событий и задачи по расписанию без HTTP API.
+// Конфиг и окружение те же, что у основного сервиса. В API очередь можно выключить: queue.inProcess: false.
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+	// База часовых поясов внутри бинарника, в образе alpine ее нет
+	_ "time/tzdata"
+
+	"github.com/ArtemChadaev/go/pkg/app"
+	_ "github.com/lib/pq"
+	"github.com/sirupsen/logrus"
+)
+
+func main() {
+	logrus.SetFormatter(new(logrus.JSONFormatter))
+	if err := app.InitConfig(); err != nil {
+		logrus.Fatalf("%s", err.Error())
+	}
+	deps, err := app.New()
+	if err != nil {
+		logrus.Fatalf("%s", err.Error())
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	deps.Run(ctx, true)
+}
@@ -0,0 +1,60 @@
+package rest
+
+import "time"
+
+// Причины изменения баланса монет
+const (
+	CoinReasonInitialBalance = "initial_balance"
+	CoinReasonDailyReward    = "daily_reward"
+	CoinReasonTransferOut    = "transfer_out"
+	CoinReasonTransferIn     = "transfer_in"
+	CoinReasonTransferFee    = "transfer_fee"
+	CoinReasonRedeemCode     = "redeem_code"
+	CoinReasonAchievement    = "achievement"
+	CoinReasonReferrerBonus  = "referrer_bonus"
+	CoinReasonRefereeBonus   = "referee_bonus"
+	CoinReasonPurchase       = "coin_purchase"
+	CoinReasonRefund         = "coin_refund"
+	// Покупка подписки за монеты
+	CoinReasonSubscription = "subscription_purchase"
+)
+
+// CoinTransaction запись в журнале монет. Баланс меняется только вместе с ней.
+type CoinTransaction struct {
+	ID           int64     `json:"id" db:"id"`
+	UserID       int       `json:"-" db:"user_id"`
+	Amount       int       `json:"amount" db:"amount"`
+	Reason       string    `json:"reason" db:"reason"`
+	ReferenceID  *string   `json:"referenceId" db:"reference_id"`
+	BalanceAfter int       `json:"balanceAfter" db:"balance_after"`
+	CreatedAt    time.Time `json:"createdAt" db:"created_at"`
+}
+
+// CoinHistory страница журнала монет пользователя.
+type CoinHistory struct {
+	Transactions []CoinTransaction `json:"transactions"`
+	Total        int               `json:"total"`
+	Limit        int               `json:"limit"`
+	Offset       int               `json:"offset"`
+}
+
+// CoinTransferInput запрос на перевод монет другому пользователю: по id или по имени.
+type CoinTransferInput struct {
+	ToUserID int    `json:"toUserId"`
+	ToName   string `json:"toName"`
+	// Верхняя граница не дает комиссии и суточному лимиту переполнить int
+	Amount int `json:"amount" binding:"required,gt=0,max=1000000000"`
+}
+
+// CoinTransfer проведенный перевод.
+type CoinTransfer struct {
+	ID       string `json:"id"`
+	FromUser int    `json:"fromUserId"`
+	ToUser   int    `json:"toUserId"`
+	Amount   int    `json:"amount"`
+	Fee      int    `json:"fee"`
+	// Баланс отправителя после перевода
+	BalanceAfter int `json:"balanceAfter"`
+	// Баланс получателя после перевода, наружу не отдается
+	ToBalanceAfter int `json:"-"`
+}
@@ -0,0 +1,51 @@
+package rest
+
+import "time"
+
+// DailyRewardStreak серия ежедневных наград пользователя.
+type DailyRewardStreak struct {
+	UserID         int        `json:"-" db:"user_id"`
+	CurrentStreak  int        `json:"currentStreak" db:"current_streak"`
+	LongestStreak  int        `json:"longestStreak" db:"longest_streak"`
+	LastClaimDate  *time.Time `json:"lastClaimDate" db:"last_claim_date"`
+	LastFreezeDate *time.Time `json:"lastFreezeDate" db:"last_freeze_date"`
+	UpdatedAt      time.Time  `json:"-" db:"updated_at"`
+}
+
+// DailyRewardClaim полученная ежедневная награда.
+type DailyRewardClaim struct {
+	ID               int64     `json:"-" db:"id"`
+	UserID           int       `json:"-" db:"user_id"`
+	ClaimDate        time.Time `json:"claimDate" db:"claim_date"`
+	StreakDay        int       `json:"streakDay" db:"streak_day"`
+	Coins            int       `json:"coins" db:"coins"`
+	SubscriptionDays int       `json:"subscriptionDays" db:"subscription_days"`
+	ClaimedAt        time.Time `json:"claimedAt" db:"claimed_at"`
+	// Баланс монет после получения
+	Balance int `json:"balance" db:"-"`
+	// Новая дата окончания подписки, если награда - дни подписки
+	SubscriptionUntil *time.Time `json:"subscriptionUntil,omitempty" db:"-"`
+	// Когда можно будет забрать следующую награду
+	NextClaimAt time.Time `json:"nextClaimAt" db:"-"`
+}
+
+// DailyReward награда за день серии.
+type DailyReward struct {
+	// С какого дня серии действует награда
+	Day              int `json:"day" mapstructure:"day"`
+	Coins            int `json:"coins,omitempty" mapstructure:"coins"`
+	SubscriptionDays int `json:"subscriptionDays,omitempty" mapstructure:"subscriptionDays"`
+}
+
+// DailyRewardStatus состояние ежедневной награды для клиента.
+type DailyRewardStatus struct {
+	Streak        int  `json:"streak"`
+	LongestStreak int  `json:"longestStreak"`
+	ClaimedToday  bool `json:"claimedToday"`
+	// Какой день серии будет следующим и что за него дадут
+	NextStreakDay int         `json:"nextStreakDay"`
+	NextReward    DailyReward `json:"nextReward"`
+	// Когда начнется следующий день
+	ResetAt           time.Time `json:"resetAt"`
+	SecondsUntilReset int       `json:"secondsUntilReset"`
+}
@@ -1,7 +1,10 @@
 package rest
 
 import (
+	"fmt"
+	"math"
 	"net/http"
+	"time"
 )
 
 // AppError — это наша основная структура для всех ошибок приложения.
@@ -14,6 +17,8 @@ type AppError struct {
 	Message string `json:"error_description"`
 	// Внутренняя (исходная) ошибка для логирования.
 	Err error `json:"-"`
+	// Через сколько можно повторить запрос, если это важно клиенту.
+	RetryAfter time.Duration `json:"-"`
 }
 
 // Error позволяет AppError соответствовать стандартному интерфейсу error.
@@ -47,11 +52,11 @@ var (
 		Message:    "authorization token is invalid",
 	}
 
-	// ErrTooManyRequestsByAccessToken Превышено количество запросов по токену
-	ErrTooManyRequestsByAccessToken = &AppError{
+	// ErrTooManyRequestsByUser Превышено количество запросов пользователем
+	ErrTooManyRequestsByUser = &AppError{
 		HTTPStatus: http.StatusTooManyRequests,
 		Code:       "too_many_requests",
-		Message:    "too many requests by access token",
+		Message:    "too many requests by user",
 	}
 	// ErrTooManyRequestsByIp Превышено количество запросов по ip
 	ErrTooManyRequestsByIp = &AppError{
@@ -59,6 +64,19 @@ var (
 		Code:       "too_many_requests",
 		Message:    "too many requests by ip",
 	}
+	// ErrTooManyRequests Превышено количество запросов по маршруту или API-ключу
+	ErrTooManyRequests = &AppError{
+		HTTPStatus: http.StatusTooManyRequests,
+		Code:       "too_many_requests",
+		Message:    "too many requests",
+	}
+
+	// ErrForbidden Нет прав на действие
+	ErrForbidden = &AppError{
+		HTTPStatus: http.StatusForbidden,
+		Code:       "forbidden",
+		Message:    "you don't have permission to perform this action",
+	}
 
 	// ErrUserNotFound Пользователь не найден
 	ErrUserNotFound = &AppError{
@@ -68,6 +86,22 @@ var (
 	}
 )
 
+// Ошибки ключей идемпотентности
+var (
+	// ErrIdempotencyRequestInProgress запрос с этим ключом еще выполняется
+	ErrIdempotencyRequestInProgress = &AppError{
+		HTTPStatus: http.StatusConflict,
+		Code:       "idempotency_request_in_progress",
+		Message:    "a request with this idempotency key is already in progress",
+	}
+	// ErrIdempotencyKeyReused ключ уже использован с другим запросом
+	ErrIdempotencyKeyReused = &AppError{
+		HTTPStatus: http.StatusUnprocessableEntity,
+		Code:       "idempotency_key_reused",
+		Message:    "idempotency key was already used with a different request",
+	}
+)
+
 // Ошибки связанные с настройкой
 var (
 	// ErrNoCoins Не хватает монеток на аккаунте
@@ -82,11 +116,107 @@ var (
 		Code:       "failed_save_img",
 		Message:    "failed save img",
 	}
+	// ErrImgTooLarge Фотография больше допустимого размера
+	ErrImgTooLarge = &AppError{
+		HTTPStatus: http.StatusRequestEntityTooLarge,
+		Code:       "img_too_large",
+		Message:    "image is too large",
+	}
+
+	// ErrCoinTransactionExists Операция с монетами уже проведена
+	ErrCoinTransactionExists = &AppError{
+		HTTPStatus: http.StatusConflict,
+		Code:       "coin_transaction_exists",
+		Message:    "this coin operation has already been applied",
+	}
+
+	// ErrTransferToSelf Перевод самому себе
+	ErrTransferToSelf = &AppError{
+		HTTPStatus: http.StatusBadRequest,
+		Code:       "transfer_to_self",
+		Message:    "you can't transfer coins to yourself",
+	}
+	// ErrAmbiguousRecipient Несколько пользователей с таким именем
+	ErrAmbiguousRecipient = &AppError{
+		HTTPStatus: http.StatusConflict,
+		Code:       "ambiguous_recipient",
+		Message:    "several users have this name, use user id",
+	}
+	// ErrTransferDailyCap Превышен дневной лимит переводов
+	ErrTransferDailyCap = &AppError{
+		HTTPStatus: http.StatusForbidden,
+		Code:       "transfer_daily_cap",
+		Message:    "daily transfer limit exceeded",
+	}
 
+	// ErrInvalidTimezone Неизвестный часовой пояс
+	ErrInvalidTimezone = &AppError{
+		HTTPStatus: http.StatusBadRequest,
+		Code:       "invalid_timezone",
+		Message:    "timezone must be a valid IANA name, for example Europe/Moscow",
+	}
+	// ErrTimezoneChangeTooSoon Часовой пояс недавно меняли
+	ErrTimezoneChangeTooSoon = &AppError{
+		HTTPStatus: http.StatusConflict,
+		Code:       "timezone_change_too_soon",
+		Message:    "timezone was changed recently, try again later",
+	}
+
+	// ErrDayCoin Ежедневная награда уже получена
 	ErrDayCoin = &AppError{
 		HTTPStatus: http.StatusConflict,
 		Code:       "day_coin",
-		Message:    "day coin",
+		Message:    "daily reward has already been claimed today",
+	}
+)
+
+// Промокоды
+var (
+	// ErrRedeemCodeNotFound Такого кода нет
+	ErrRedeemCodeNotFound = &AppError{
+		HTTPStatus: http.StatusNotFound,
+		Code:       "redeem_code_not_found",
+		Message:    "redeem code not found",
+	}
+	// ErrRedeemCodeExpired Срок действия кода истек
+	ErrRedeemCodeExpired = &AppError{
+		HTTPStatus: http.StatusGone,
+		Code:       "redeem_code_expired",
+		Message:    "redeem code has expired",
+	}
+	// ErrRedeemCodeExhausted Код активирован максимальное число раз
+	ErrRedeemCodeExhausted = &AppError{
+		HTTPStatus: http.StatusGone,
+		Code:       "redeem_code_exhausted",
+		Message:    "redeem code has no uses left",
+	}
+	// ErrRedeemCodeAlreadyUsed Пользователь уже получал награду из этой партии
+	ErrRedeemCodeAlreadyUsed = &AppError{
+		HTTPStatus: http.StatusConflict,
+		Code:       "redeem_code_already_used",
+		Message:    "you have already redeemed a code from this batch",
+	}
+	// ErrRedeemBatchNotFound Партии кодов нет
+	ErrRedeemBatchNotFound = &AppError{
+		HTTPStatus: http.StatusNotFound,
+		Code:       "redeem_batch_not_found",
+		Message:    "redeem batch not found",
+	}
+	// ErrRedeemExportNotFound Выгрузки нет или она уже удалена
+	ErrRedeemExportNotFound = &AppError{
+		HTTPStatus: http.StatusNotFound,
+		Code:       "redeem_export_not_found",
+		Message:    "redeem export not found",
+	}
+)
+
+// Реферальная программа
+var (
+	// ErrReferralCodeNotFound Такого реферального кода нет
+	ErrReferralCodeNotFound = &AppError{
+		HTTPStatus: http.StatusBadRequest,
+		Code:       "referral_code_not_found",
+		Message:    "referral code not found",
 	}
 )
 
@@ -98,12 +228,184 @@ var (
 		Code:       "no_money",
 		Message:    "there are not enough money in the account",
 	}
+	// ErrSubscriptionPlanNotFound Такого тарифа нет или он снят с продажи
+	ErrSubscriptionPlanNotFound = &AppError{
+		HTTPStatus: http.StatusNotFound,
+		Code:       "subscription_plan_not_found",
+		Message:    "subscription plan not found",
+	}
+	// ErrSubscriptionPlanNotForCoins Тариф не продается за монеты
+	ErrSubscriptionPlanNotForCoins = &AppError{
+		HTTPStatus: http.StatusBadRequest,
+		Code:       "subscription_plan_not_for_coins",
+		Message:    "subscription plan can't be bought with coins",
+	}
+	// ErrTrialUnavailable Пробный период уже использован или подписка уже есть
+	ErrTrialUnavailable = &AppError{
+		HTTPStatus: http.StatusConflict,
+		Code:       "trial_unavailable",
+		Message:    "trial is already used or subscription is active",
+	}
+	// ErrNoActiveSubscription Нечего отменять, подписки нет
+	ErrNoActiveSubscription = &AppError{
+		HTTPStatus: http.StatusConflict,
+		Code:       "no_active_subscription",
+		Message:    "there is no active subscription",
+	}
 	// ErrPaymentFailed Ошибка платежа
 	ErrPaymentFailed = &AppError{
 		HTTPStatus: http.StatusPaymentRequired,
 		Code:       "payment_failed",
 		Message:    "payment failed",
 	}
+	// ErrPaymentNotFound Платежа нет или он чужой
+	ErrPaymentNotFound = &AppError{
+		HTTPStatus: http.StatusNotFound,
+		Code:       "payment_not_found",
+		Message:    "payment not found",
+	}
+	// ErrPaymentProviderNotFound Неизвестный платежный провайдер
+	ErrPaymentProviderNotFound = &AppError{
+		HTTPStatus: http.StatusNotFound,
+		Code:       "payment_provider_not_found",
+		Message:    "payment provider not found",
+	}
+	// ErrPaymentProviderUnavailable Провайдер не ответил
+	ErrPaymentProviderUnavailable = &AppError{
+		HTTPStatus: http.StatusBadGateway,
+		Code:       "payment_provider_unavailable",
+		Message:    "payment provider is unavailable, try again later",
+	}
+	// ErrInvalidWebhookSignature Подпись уведомления не совпала
+	ErrInvalidWebhookSignature = &AppError{
+		HTTPStatus: http.StatusBadRequest,
+		Code:       "invalid_webhook_signature",
+		Message:    "webhook signature is invalid",
+	}
+	// ErrInvalidPaymentTransition Недопустимая смена статуса платежа
+	ErrInvalidPaymentTransition = &AppError{
+		HTTPStatus: http.StatusConflict,
+		Code:       "invalid_payment_transition",
+		Message:    "payment can't move to this status",
+	}
+	// ErrCoinPackNotFound Такого набора монет нет
+	ErrCoinPackNotFound = &AppError{
+		HTTPStatus: http.StatusNotFound,
+		Code:       "coin_pack_not_found",
+		Message:    "coin pack not found",
+	}
+)
+
+// Кланы
+var (
+	// ErrClanNotFound Клана нет
+	ErrClanNotFound = &AppError{
+		HTTPStatus: http.StatusNotFound,
+		Code:       "clan_not_found",
+		Message:    "clan not found",
+	}
+	// ErrClanNameTaken Имя клана занято
+	ErrClanNameTaken = &AppError{
+		HTTPStatus: http.StatusConflict,
+		Code:       "clan_name_taken",
+		Message:    "clan with this name already exists",
+	}
+	// ErrInvalidClanName Имя клана слишком короткое или длинное
+	ErrInvalidClanName = &AppError{
+		HTTPStatus: http.StatusBadRequest,
+		Code:       "invalid_clan_name",
+		Message:    "clan name must be from 3 to 32 characters",
+	}
+	// ErrInvalidClanInfo Описание или данные клана слишком большие
+	ErrInvalidClanInfo = &AppError{
+		HTTPStatus: http.StatusBadRequest,
+		Code:       "invalid_clan_info",
+		Message:    "clan description or metadata is too long",
+	}
+	// ErrAlreadyInClan Пользователь уже состоит в клане
+	ErrAlreadyInClan = &AppError{
+		HTTPStatus: http.StatusConflict,
+		Code:       "already_in_clan",
+		Message:    "user is already in a clan",
+	}
+	// ErrClanRoleTooLow Действие доступно только более высокой роли в клане
+	ErrClanRoleTooLow = &AppError{
+		HTTPStatus: http.StatusForbidden,
+		Code:       "clan_role_too_low",
+		Message:    "your clan role doesn't allow this action",
+	}
+	// ErrClanPermissionDenied У роли нет права на это действие
+	ErrClanPermissionDenied = &AppError{
+		HTTPStatus: http.StatusForbidden,
+		Code:       "clan_permission_denied",
+		Message:    "your clan role doesn't have permission for this action",
+	}
+	// ErrClanRoleNotFound Такой роли нет
+	ErrClanRoleNotFound = &AppError{
+		HTTPStatus: http.StatusNotFound,
+		Code:       "clan_role_not_found",
+		Message:    "clan role not found",
+	}
+	// ErrInvalidClanRoleName Название роли слишком длинное
+	ErrInvalidClanRoleName = &AppError{
+		HTTPStatus: http.StatusBadRequest,
+		Code:       "invalid_clan_role_name",
+		Message:    "clan role name must be at most 20 characters",
+	}
+	// ErrClanRoleNameNotAllowed Название роли не прошло фильтр нецензурных слов
+	ErrClanRoleNameNotAllowed = &AppError{
+		HTTPStatus: http.StatusBadRequest,
+		Code:       "clan_role_name_not_allowed",
+		Message:    "clan role name contains forbidden words",
+	}
+	// ErrClanLeaderPermissions Права главы не настраиваются
+	ErrClanLeaderPermissions = &AppError{
+		HTTPStatus: http.StatusBadRequest,
+		Code:       "clan_leader_permissions",
+		Message:    "clan leader always has all permissions",
+	}
+	// ErrClanMemberRankTooHigh Управлять можно только участниками строго ниже рангом
+	ErrClanMemberRankTooHigh = &AppError{
+		HTTPStatus: http.StatusForbidden,
+		Code:       "clan_member_rank_too_high",
+		Message:    "you can only manage members of a lower rank",
+	}
+	// ErrClanMemberNotFound Пользователь не состоит в этом клане
+	ErrClanMemberNotFound = &AppError{
+		HTTPStatus: http.StatusNotFound,
+		Code:       "clan_member_not_found",
+		Message:    "user is not a member of this clan",
+	}
+	// ErrClanRoleOutOfRange Повышать или понижать дальше некуда
+	ErrClanRoleOutOfRange = &AppError{
+		HTTPStatus: http.StatusConflict,
+		Code:       "clan_role_out_of_range",
+		Message:    "member can't be promoted or demoted any further",
+	}
+	// ErrClanLeaderCannotLeave Глава не может выйти из клана
+	ErrClanLeaderCannotLeave = &AppError{
+		HTTPStatus: http.StatusConflict,
+		Code:       "clan_leader_cannot_leave",
+		Message:    "clan leader must hand over leadership or disband the clan",
+	}
+	// ErrClanFull В клане нет мест
+	ErrClanFull = &AppError{
+		HTTPStatus: http.StatusConflict,
+		Code:       "clan_full",
+		Message:    "clan has reached its member limit",
+	}
+	// ErrClanInviteExists Приглашение или заявка уже есть
+	ErrClanInviteExists = &AppError{
+		HTTPStatus: http.StatusConflict,
+		Code:       "clan_invite_exists",
+		Message:    "invite or join request already exists",
+	}
+	// ErrClanInviteNotFound Приглашения или заявки нет
+	ErrClanInviteNotFound = &AppError{
+		HTTPStatus: http.StatusNotFound,
+		Code:       "clan_invite_not_found",
+		Message:    "invite or join request not found",
+	}
 )
 
 // Функции-конструкторы для ошибок, которые должны содержать дополнительный контекст.
@@ -127,3 +429,27 @@ func NewInternalServerError(err error) *AppError {
 		Err:        err,
 	}
 }
+
+// NewEntitlementRequiredError функция feature доступна только по подписке, plan - тариф, который ее дает.
+func NewEntitlementRequiredError(feature, plan string) *AppError {
+	message := fmt.Sprintf("feature %q requires a subscription", feature)
+	if plan != "" {
+		message = fmt.Sprintf("feature %q requires the %q subscription plan", feature, plan)
+	}
+	return &AppError{
+		HTTPStatus: http.StatusPaymentRequired,
+		Code:       "subscription_required",
+		Message:    message,
+	}
+}
+
+// NewTooManyRequestsError дополняет одну из ErrTooManyRequests* временем, через которое можно повторить запрос.
+func NewTooManyRequestsError(base *AppError, retryAfter time.Duration) *AppError {
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	return &AppError{
+		HTTPStatus: base.HTTPStatus,
+		Code:       base.Code,
+		Message:    fmt.Sprintf("%s, retry after %d seconds", base.Message, seconds),
+		RetryAfter: time.Duration(seconds) * time.Second,
+	}
+}
@@ -0,0 +1,23 @@
+package rest
+
+import "time"
+
+// Типы событий, на которые реагируют достижения и другие фоновые обработчики
+const (
+	EventUserRegistered        = "user_registered"
+	EventDailyRewardClaimed    = "daily_reward_claimed"
+	EventCoinsEarned           = "coins_earned"
+	EventSubscriptionPurchased = "subscription_purchased"
+	EventClanJoined            = "clan_joined"
+)
+
+// Event событие в жизни пользователя.
+type Event struct {
+	// ID записи в потоке событий, заполняется при чтении
+	ID     string `json:"-"`
+	Type   string `json:"type"`
+	UserID int    `json:"userId"`
+	// Числовое значение события: сколько монет заработано, день серии, дней подписки
+	Value     int       `json:"value"`
+	CreatedAt time.Time `json:"createdAt"`
+}
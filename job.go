@@ -0,0 +1,29 @@
+package rest
+
+import "time"
+
+// JobStatus состояние фоновой задачи по запускам на лидере.
+type JobStatus struct {
+	Name string `json:"name"`
+	// Расписание из конфига, пустое - задача выключена
+	Spec           string     `json:"spec"`
+	Running        bool       `json:"running"`
+	NextRunAt      *time.Time `json:"nextRunAt"`
+	LastStartedAt  *time.Time `json:"lastStartedAt"`
+	LastFinishedAt *time.Time `json:"lastFinishedAt"`
+	// Длительность последнего запуска в миллисекундах
+	LastDurationMs int64  `json:"lastDurationMs"`
+	LastError      string `json:"lastError,omitempty"`
+	Runs           int64  `json:"runs"`
+	Failures       int64  `json:"failures"`
+}
+
+// SchedulerStatus состояние планировщика. Задачи выполняет только реплика-лидер,
+// она же сохраняет их состояние в Redis, поэтому оно одинаково на любой реплике.
+type SchedulerStatus struct {
+	Instance string `json:"instance"`
+	Leader   bool   `json:"leader"`
+	// Реплика, которая сейчас держит аренду, пустая - лидера нет
+	LeaderInstance string      `json:"leaderInstance"`
+	Jobs           []JobStatus `json:"jobs"`
+}
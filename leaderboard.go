@@ -0,0 +1,62 @@
+package rest
+
+import "time"
+
+// Виды рейтингов
+const (
+	// Текущий баланс монет
+	LeaderboardBalance = "balance"
+	// Заработанные монеты (без переводов от других игроков)
+	LeaderboardEarned = "earned"
+)
+
+// Периоды рейтингов
+const (
+	LeaderboardPeriodAll  = "all"
+	LeaderboardPeriodWeek = "week"
+)
+
+// LeaderboardQuery какой рейтинг запрошен.
+type LeaderboardQuery struct {
+	Board  string `form:"-"`
+	Period string `form:"period"`
+	// Рейтинг внутри клана, 0 - глобальный
+	ClanID int `form:"clanId"`
+	Limit  int `form:"limit"`
+}
+
+// LeaderboardEntry строка рейтинга.
+type LeaderboardEntry struct {
+	Rank   int     `json:"rank"`
+	UserID int     `json:"userId"`
+	Name   string  `json:"name"`
+	Icon   *string `json:"icon"`
+	Score  int64   `json:"score"`
+}
+
+// Leaderboard топ игроков, место запросившего и его соседи.
+type Leaderboard struct {
+	Board      string             `json:"board"`
+	Period     string             `json:"period"`
+	ClanID     int                `json:"clanId,omitempty"`
+	Entries    []LeaderboardEntry `json:"entries"`
+	Me         *LeaderboardEntry  `json:"me"`
+	Neighbours []LeaderboardEntry `json:"neighbours"`
+}
+
+// LeaderboardArchiveEntry строка архива недельного рейтинга.
+type LeaderboardArchiveEntry struct {
+	Week       string    `db:"week"`
+	Board      string    `db:"board"`
+	Rank       int       `db:"rank"`
+	UserID     int       `db:"user_id"`
+	Score      int64     `db:"score"`
+	ArchivedAt time.Time `db:"archived_at"`
+}
+
+// LeaderboardScore сумма для пересчета рейтинга из базы.
+type LeaderboardScore struct {
+	UserID int   `db:"user_id"`
+	ClanID *int  `db:"clan_id"`
+	Score  int64 `db:"score"`
+}
@@ -0,0 +1,3 @@
+ALTER TABLE user_settings DROP CONSTRAINT user_settings_coin_non_negative;
+DROP TABLE coin_transactions;
+DROP FUNCTION forbid_coin_transactions_update;
@@ -0,0 +1,42 @@
+-- Журнал всех изменений монет. Записи только добавляются.
+CREATE TABLE coin_transactions
+(
+    id            BIGSERIAL PRIMARY KEY,
+    user_id       INT         NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    -- Положительное - начисление, отрицательное - списание
+    amount        INT         NOT NULL,
+    -- Причина: daily_reward, transfer_in и т.д.
+    reason        VARCHAR(50) NOT NULL,
+    -- Внешний идентификатор операции (id платежа, перевода, день награды)
+    reference_id  VARCHAR(255),
+    -- Баланс пользователя сразу после операции
+    balance_after INT         NOT NULL,
+    created_at    TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX coin_transactions_user_id_idx ON coin_transactions (user_id, id DESC);
+-- Одна и та же операция не может быть проведена дважды
+CREATE UNIQUE INDEX coin_transactions_reference_uq
+    ON coin_transactions (user_id, reason, reference_id)
+    WHERE reference_id IS NOT NULL;
+
+-- Запрещаем редактировать журнал
+CREATE OR REPLACE FUNCTION forbid_coin_transactions_update()
+    RETURNS TRIGGER AS $$
+BEGIN
+    RAISE EXCEPTION 'coin_transactions is append-only';
+END;
+$$ language 'plpgsql';
+CREATE TRIGGER coin_transactions_immutable
+    BEFORE UPDATE ON coin_transactions
+    FOR EACH ROW
+EXECUTE PROCEDURE forbid_coin_transactions_update();
+
+-- Баланс не может уйти в минус
+ALTER TABLE user_settings
+    ADD CONSTRAINT user_settings_coin_non_negative CHECK (coin >= 0);
+
+-- Уже накопленные монеты попадают в журнал как начальный баланс
+INSERT INTO coin_transactions (user_id, amount, reason, balance_after)
+SELECT user_id, coin, 'initial_balance', coin
+FROM user_settings
+WHERE coin <> 0;
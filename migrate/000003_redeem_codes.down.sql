@@ -0,0 +1,4 @@
+DROP TABLE redeem_code_uses;
+DROP TABLE redeem_codes;
+DROP TABLE redeem_batches;
+ALTER TABLE users DROP COLUMN is_admin;
@@ -0,0 +1,34 @@
+-- Администраторы могут выпускать коды
+ALTER TABLE users
+    ADD COLUMN is_admin BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- Партия промокодов с общей наградой
+CREATE TABLE redeem_batches
+(
+    id            SERIAL PRIMARY KEY,
+    name          VARCHAR(255) NOT NULL,
+    -- coins или subscription_days
+    reward_type   VARCHAR(20)  NOT NULL CHECK (reward_type IN ('coins', 'subscription_days')),
+    reward_amount INT          NOT NULL CHECK (reward_amount > 0),
+    -- Сколько раз можно активировать каждый код
+    max_uses      INT          NOT NULL DEFAULT 1 CHECK (max_uses > 0),
+    expires_at    TIMESTAMPTZ,
+    created_by    INT          REFERENCES users (id) ON DELETE SET NULL,
+    created_at    TIMESTAMPTZ  NOT NULL DEFAULT NOW()
+);
+CREATE TABLE redeem_codes
+(
+    id       SERIAL PRIMARY KEY,
+    batch_id INT         NOT NULL REFERENCES redeem_batches (id) ON DELETE CASCADE,
+    code     VARCHAR(32) NOT NULL UNIQUE,
+    uses     INT         NOT NULL DEFAULT 0
+);
+-- Кто и когда активировал код. Один пользователь - одна награда из партии.
+CREATE TABLE redeem_code_uses
+(
+    batch_id    INT         NOT NULL REFERENCES redeem_batches (id) ON DELETE CASCADE,
+    code_id     INT         NOT NULL REFERENCES redeem_codes (id) ON DELETE CASCADE,
+    user_id     INT         NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    redeemed_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (batch_id, user_id)
+);
@@ -0,0 +1,14 @@
+-- Серии ежедневных наград
+CREATE TABLE daily_reward_streaks
+(
+    user_id          INT         NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    -- Сколько дней подряд получена награда
+    current_streak   INT         NOT NULL DEFAULT 0,
+    longest_streak   INT         NOT NULL DEFAULT 0,
+    -- День последнего получения (UTC)
+    last_claim_date  DATE,
+    -- Последний день, пропуск которого простили благодаря подписке
+    last_freeze_date DATE,
+    updated_at       TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CONSTRAINT daily_reward_streaks_pk PRIMARY KEY (user_id)
+);
@@ -0,0 +1,3 @@
+ALTER TABLE user_settings
+    DROP COLUMN timezone_updated_at,
+    DROP COLUMN timezone;
@@ -0,0 +1,4 @@
+-- Часовой пояс пользователя (имя IANA), от него считается "сегодня" для ежедневных наград
+ALTER TABLE user_settings
+    ADD COLUMN timezone            VARCHAR(64) NOT NULL DEFAULT 'UTC',
+    ADD COLUMN timezone_updated_at TIMESTAMPTZ;
@@ -0,0 +1 @@
+DROP TABLE daily_reward_claims;
@@ -0,0 +1,15 @@
+-- Каждое получение ежедневной награды. Уникальность (user_id, claim_date)
+-- гарантирует одну награду в день даже при параллельных запросах.
+CREATE TABLE daily_reward_claims
+(
+    id                BIGSERIAL PRIMARY KEY,
+    user_id           INT         NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    -- День по часовому поясу пользователя
+    claim_date        DATE        NOT NULL,
+    -- Какой это был день серии
+    streak_day        INT         NOT NULL,
+    coins             INT         NOT NULL DEFAULT 0,
+    subscription_days INT         NOT NULL DEFAULT 0,
+    claimed_at        TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CONSTRAINT daily_reward_claims_user_day_uq UNIQUE (user_id, claim_date)
+);
@@ -0,0 +1,13 @@
+-- Итоги недельных рейтингов, сохраняются при смене недели
+CREATE TABLE leaderboard_archives
+(
+    -- Неделя ISO, например 2025-W39
+    week        VARCHAR(10) NOT NULL,
+    -- earned - заработано монет за неделю
+    board       VARCHAR(20) NOT NULL,
+    rank        INT         NOT NULL,
+    user_id     INT         NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    score       BIGINT      NOT NULL,
+    archived_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (week, board, rank)
+);
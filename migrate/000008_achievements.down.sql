@@ -0,0 +1,3 @@
+DROP TABLE achievement_processed_events;
+DROP TABLE achievement_counters;
+DROP TABLE user_achievements;
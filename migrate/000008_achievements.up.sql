@@ -0,0 +1,26 @@
+-- Открытые достижения, код берется из каталога в конфиге
+CREATE TABLE user_achievements
+(
+    user_id     INT         NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    code        VARCHAR(64) NOT NULL,
+    unlocked_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, code)
+);
+
+-- Статистика событий пользователя, по ней проверяются условия достижений
+CREATE TABLE achievement_counters
+(
+    user_id   INT         NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    event     VARCHAR(64) NOT NULL,
+    count     INT         NOT NULL DEFAULT 0,
+    total     BIGINT      NOT NULL DEFAULT 0,
+    max_value INT         NOT NULL DEFAULT 0,
+    PRIMARY KEY (user_id, event)
+);
+
+-- Уже учтенные события из потока, чтобы повторная доставка не увеличивала счетчики
+CREATE TABLE achievement_processed_events
+(
+    event_id     VARCHAR(64) PRIMARY KEY,
+    processed_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,3 @@
+DROP TABLE referrals;
+ALTER TABLE users
+    DROP COLUMN referral_code;
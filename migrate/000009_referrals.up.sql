@@ -0,0 +1,23 @@
+-- Реферальный код пользователя, создается при первом обращении
+ALTER TABLE users
+    ADD COLUMN referral_code VARCHAR(16) UNIQUE;
+
+-- Кто кого пригласил. У пользователя может быть только один пригласивший.
+CREATE TABLE referrals
+(
+    referee_id         INT         PRIMARY KEY REFERENCES users (id) ON DELETE CASCADE,
+    referrer_id        INT         NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    -- pending - ждем выполнения условия, qualified - бонусы выданы, rejected - отклонено антифродом
+    status             VARCHAR(20) NOT NULL DEFAULT 'pending',
+    reject_reason      VARCHAR(64),
+    -- Откуда пришла регистрация, для ограничений по IP и устройству
+    signup_ip          VARCHAR(45),
+    -- Хеш отпечатка устройства от клиента
+    device_fingerprint VARCHAR(64),
+    created_at         TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    qualified_at       TIMESTAMPTZ,
+    CHECK (referee_id <> referrer_id)
+);
+CREATE INDEX referrals_referrer_id_idx ON referrals (referrer_id);
+CREATE INDEX referrals_signup_ip_idx ON referrals (signup_ip, created_at);
+CREATE INDEX referrals_device_fingerprint_idx ON referrals (device_fingerprint, created_at);
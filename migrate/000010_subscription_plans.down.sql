@@ -0,0 +1,4 @@
+DROP TABLE subscriptions;
+ALTER TABLE user_settings
+    DROP COLUMN subscription_plan_id;
+DROP TABLE subscription_plans;
@@ -0,0 +1,45 @@
+-- Тарифы подписки
+CREATE TABLE subscription_plans
+(
+    id            SERIAL PRIMARY KEY,
+    code          VARCHAR(32) NOT NULL UNIQUE,
+    name          VARCHAR(64) NOT NULL,
+    duration_days INT         NOT NULL CHECK (duration_days > 0),
+    -- Цена в копейках
+    price         INT         NOT NULL CHECK (price >= 0),
+    currency      VARCHAR(3)  NOT NULL DEFAULT 'RUB',
+    -- Цена в монетах, NULL - за монеты не продается
+    coin_price    INT CHECK (coin_price > 0),
+    -- Что дает тариф, например {"bigAvatar": true, "clanMemberLimit": 100}
+    perks         JSONB       NOT NULL DEFAULT '{}',
+    -- Снятый с продажи тариф остается у тех, кто его купил
+    active        BOOLEAN     NOT NULL DEFAULT TRUE,
+    created_at    TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+INSERT INTO subscription_plans (code, name, duration_days, price, coin_price, perks)
+VALUES ('premium_month', 'Премиум на месяц', 30, 29900, 1000,
+        '{"streakFreeze": true, "paidRateLimit": true, "bigAvatar": true}'),
+       ('premium_year', 'Премиум на год', 365, 249900, 10000,
+        '{"streakFreeze": true, "paidRateLimit": true, "bigAvatar": true}');
+
+-- Текущий тариф пользователя, NULL - подписка получена наградой или куплена до появления тарифов
+ALTER TABLE user_settings
+    ADD COLUMN subscription_plan_id INT REFERENCES subscription_plans (id);
+
+-- История подписки: покупки, продления, подарки и отмены
+CREATE TABLE subscriptions
+(
+    id           BIGSERIAL PRIMARY KEY,
+    user_id      INT         NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    plan_id      INT REFERENCES subscription_plans (id),
+    -- purchase, renewal, grant, cancel
+    action       VARCHAR(20) NOT NULL,
+    days         INT         NOT NULL DEFAULT 0,
+    -- Дата окончания подписки после операции
+    ends_at      TIMESTAMPTZ,
+    -- Платеж, промокод или награда, из-за которых изменилась подписка
+    reference_id VARCHAR(255),
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX subscriptions_user_id_idx ON subscriptions (user_id, created_at);
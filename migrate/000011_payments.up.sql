@@ -0,0 +1,29 @@
+-- Платежи через внешних провайдеров.
+-- Статус меняется только по допустимым переходам: pending -> succeeded/failed, succeeded -> refunded.
+CREATE TABLE payments
+(
+    id           UUID PRIMARY KEY,
+    user_id      INT         NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    provider     VARCHAR(32) NOT NULL,
+    -- ID платежа у провайдера, появляется после создания страницы оплаты
+    external_id  VARCHAR(255),
+    -- subscription или coins
+    kind         VARCHAR(20) NOT NULL,
+    plan_id      INT REFERENCES subscription_plans (id),
+    coins        INT CHECK (coins > 0),
+    -- Сумма в копейках
+    amount       INT         NOT NULL CHECK (amount > 0),
+    currency     VARCHAR(3)  NOT NULL,
+    status       VARCHAR(20) NOT NULL DEFAULT 'pending',
+    checkout_url TEXT,
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at   TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (provider, external_id),
+    CHECK ((kind = 'subscription' AND plan_id IS NOT NULL) OR (kind = 'coins' AND coins IS NOT NULL))
+);
+CREATE INDEX payments_user_id_idx ON payments (user_id, created_at);
+
+CREATE TRIGGER update_payments_updated_at
+    BEFORE UPDATE ON payments
+    FOR EACH ROW
+EXECUTE PROCEDURE update_updated_at_column();
@@ -0,0 +1,8 @@
+ALTER TABLE payments
+    DROP COLUMN renewal;
+DROP INDEX user_settings_auto_renew_idx;
+ALTER TABLE user_settings
+    DROP COLUMN subscription_grace_until,
+    DROP COLUMN subscription_canceled_at,
+    DROP COLUMN trial_used_at,
+    DROP COLUMN auto_renew;
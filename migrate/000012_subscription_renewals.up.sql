@@ -0,0 +1,15 @@
+ALTER TABLE user_settings
+    -- Продлевать подписку автоматически сохраненным способом оплаты
+    ADD COLUMN auto_renew               BOOLEAN NOT NULL DEFAULT FALSE,
+    -- Пробный период дается один раз на аккаунт
+    ADD COLUMN trial_used_at            TIMESTAMPTZ,
+    -- Подписка отменена, но работает до date_of_paid_subscription
+    ADD COLUMN subscription_canceled_at TIMESTAMPTZ,
+    -- Автопродление не прошло, подписка работает до этого момента
+    ADD COLUMN subscription_grace_until TIMESTAMPTZ;
+
+CREATE INDEX user_settings_auto_renew_idx ON user_settings (date_of_paid_subscription) WHERE auto_renew;
+
+-- Платеж создан автопродлением, а не пользователем
+ALTER TABLE payments
+    ADD COLUMN renewal BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,16 @@
+-- Уведомления в приложении, важные дублируются письмом
+CREATE TABLE notifications
+(
+    id            BIGSERIAL PRIMARY KEY,
+    user_id       INT          NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    type          VARCHAR(50)  NOT NULL,
+    title         VARCHAR(255) NOT NULL,
+    body          TEXT         NOT NULL,
+    -- Не даем отправить одно и то же дважды, например напоминание за тот же период подписки
+    dedup_key     VARCHAR(255),
+    read_at       TIMESTAMPTZ,
+    email_sent_at TIMESTAMPTZ,
+    created_at    TIMESTAMPTZ  NOT NULL DEFAULT NOW(),
+    UNIQUE (user_id, dedup_key)
+);
+CREATE INDEX notifications_user_id_idx ON notifications (user_id, id);
@@ -0,0 +1 @@
+DROP INDEX clan_members_user_id_key;
@@ -0,0 +1,2 @@
+-- Пользователь может состоять только в одном клане
+CREATE UNIQUE INDEX clan_members_user_id_key ON clan_members (user_id);
@@ -0,0 +1,3 @@
+DROP TABLE clan_invites;
+ALTER TABLE clan_members
+    DROP COLUMN joined_at;
@@ -0,0 +1,19 @@
+-- Когда участник вступил в клан, для списка участников
+ALTER TABLE clan_members
+    ADD COLUMN joined_at TIMESTAMPTZ NOT NULL DEFAULT NOW();
+
+-- Приглашения в клан и заявки на вступление, ждущие ответа
+CREATE TABLE clan_invites
+(
+    id         SERIAL PRIMARY KEY,
+    clan_id    INT         NOT NULL REFERENCES clan (id) ON DELETE CASCADE,
+    user_id    INT         NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    -- invite - клан пригласил пользователя, request - пользователь попросился в клан
+    kind       VARCHAR(10) NOT NULL,
+    -- Кто пригласил, у заявок NULL
+    invited_by INT         REFERENCES users (id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    -- Одно приглашение или одна заявка на пару клан-пользователь
+    UNIQUE (clan_id, user_id)
+);
+CREATE INDEX clan_invites_user_id_idx ON clan_invites (user_id);
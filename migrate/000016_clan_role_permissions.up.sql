@@ -0,0 +1,15 @@
+-- Права ролей, настроенные кланом. Если строки нет, у роли права по умолчанию, у главы есть все права
+CREATE TABLE clan_role_permissions
+(
+    clan_id          INT      NOT NULL REFERENCES clan (id) ON DELETE CASCADE,
+    role_id          SMALLINT NOT NULL REFERENCES roles (id) ON DELETE CASCADE,
+    -- Приглашать и разбирать заявки
+    invite           BOOLEAN  NOT NULL DEFAULT false,
+    -- Исключать участников ниже рангом
+    kick             BOOLEAN  NOT NULL DEFAULT false,
+    -- Менять описание и данные клана
+    edit_description BOOLEAN  NOT NULL DEFAULT false,
+    -- Тратить казну клана
+    spend_treasury   BOOLEAN  NOT NULL DEFAULT false,
+    PRIMARY KEY (clan_id, role_id)
+);
@@ -0,0 +1,4 @@
+DROP INDEX payments_renewal_claim_key;
+ALTER TABLE payments
+    DROP COLUMN renewal_attempt,
+    DROP COLUMN renewal_period;
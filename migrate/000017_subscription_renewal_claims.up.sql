@@ -0,0 +1,7 @@
+-- Какой срок подписки продлевает платеж автопродления и какая это попытка.
+-- Запуск задачи сначала создает платеж, а потом списывает оплату, поэтому два запуска
+-- не могут списать оплату за одну попытку дважды.
+ALTER TABLE payments
+    ADD COLUMN renewal_period  TIMESTAMPTZ,
+    ADD COLUMN renewal_attempt INT;
+CREATE UNIQUE INDEX payments_renewal_claim_key ON payments (user_id, renewal_period, renewal_attempt) WHERE renewal;
@@ -0,0 +1,2 @@
+ALTER TABLE payments
+    DROP COLUMN auto_renew;
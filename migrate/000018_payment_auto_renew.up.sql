@@ -0,0 +1,3 @@
+-- Пользователь сам включил автопродление при покупке, без этого оплата его не включает
+ALTER TABLE payments
+    ADD COLUMN auto_renew BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS achievement_processed_events_processed_at_idx;
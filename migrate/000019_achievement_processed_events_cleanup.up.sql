@@ -0,0 +1,2 @@
+-- Отметки об учтенных событиях удаляются по processed_at, когда событие обрезано из потока
+CREATE INDEX achievement_processed_events_processed_at_idx ON achievement_processed_events (processed_at);
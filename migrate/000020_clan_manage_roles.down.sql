@@ -0,0 +1,2 @@
+ALTER TABLE clan_role_permissions
+    DROP COLUMN manage_roles;
@@ -0,0 +1,6 @@
+-- Повышать и понижать участников ниже рангом. Ролям, настроенным кланом, право достается от исключения
+ALTER TABLE clan_role_permissions
+    ADD COLUMN manage_roles BOOLEAN NOT NULL DEFAULT false;
+
+UPDATE clan_role_permissions
+SET manage_roles = kick;
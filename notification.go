@@ -0,0 +1,44 @@
+package rest
+
+import "time"
+
+// Типы уведомлений
+const (
+	NotificationSubscriptionExpiring = "subscription_expiring"
+	NotificationSubscriptionExpired  = "subscription_expired"
+	NotificationRenewalFailed        = "subscription_renewal_failed"
+)
+
+// Notification сообщение пользователю в приложении, может дублироваться письмом.
+type Notification struct {
+	ID     int64  `json:"id" db:"id"`
+	UserID int    `json:"-" db:"user_id"`
+	Type   string `json:"type" db:"type"`
+	Title  string `json:"title" db:"title"`
+	Body   string `json:"body" db:"body"`
+	// Одно уведомление на ключ: например, одно напоминание на период подписки
+	DedupKey    *string    `json:"-" db:"dedup_key"`
+	ReadAt      *time.Time `json:"readAt" db:"read_at"`
+	EmailSentAt *time.Time `json:"-" db:"email_sent_at"`
+	CreatedAt   time.Time  `json:"createdAt" db:"created_at"`
+}
+
+// NotificationList страница уведомлений пользователя.
+type NotificationList struct {
+	Notifications []Notification `json:"notifications"`
+	Unread        int            `json:"unread"`
+	Total         int            `json:"total"`
+	Limit         int            `json:"limit"`
+	Offset        int            `json:"offset"`
+}
+
+// NotificationsReadInput какие уведомления отметить прочитанными, пустой список - все.
+type NotificationsReadInput struct {
+	IDs []int64 `json:"ids"`
+}
+
+// SubscriptionExpiry когда заканчивается или закончилась подписка пользователя.
+type SubscriptionExpiry struct {
+	UserID int       `db:"user_id"`
+	EndsAt time.Time `db:"ends_at"`
+}
@@ -0,0 +1,76 @@
+package rest
+
+import "time"
+
+// Статусы платежа
+const (
+	PaymentStatusPending   = "pending"
+	PaymentStatusSucceeded = "succeeded"
+	PaymentStatusFailed    = "failed"
+	PaymentStatusRefunded  = "refunded"
+)
+
+// Что покупается
+const (
+	PaymentKindSubscription = "subscription"
+	PaymentKindCoins        = "coins"
+)
+
+// Допустимые переходы статусов платежа, все остальные отклоняются
+var paymentTransitions = map[string][]string{
+	PaymentStatusPending:   {PaymentStatusSucceeded, PaymentStatusFailed},
+	PaymentStatusSucceeded: {PaymentStatusRefunded},
+}
+
+// CanTransitionPayment проверяет, может ли платеж перейти из статуса from в to.
+func CanTransitionPayment(from, to string) bool {
+	for _, status := range paymentTransitions[from] {
+		if status == to {
+			return true
+		}
+	}
+	return false
+}
+
+// Payment платеж через внешнего провайдера.
+type Payment struct {
+	ID         string  `json:"id" db:"id"`
+	UserID     int     `json:"-" db:"user_id"`
+	Provider   string  `json:"provider" db:"provider"`
+	ExternalID *string `json:"-" db:"external_id"`
+	Kind       string  `json:"kind" db:"kind"`
+	PlanID     *int    `json:"planId,omitempty" db:"plan_id"`
+	Coins      *int    `json:"coins,omitempty" db:"coins"`
+	// Сумма в копейках
+	Amount      int     `json:"amount" db:"amount"`
+	Currency    string  `json:"currency" db:"currency"`
+	Status      string  `json:"status" db:"status"`
+	CheckoutURL *string `json:"checkoutUrl,omitempty" db:"checkout_url"`
+	// Платеж создан автопродлением подписки
+	Renewal bool `json:"renewal" db:"renewal"`
+	// Пользователь при покупке согласился на автопродление
+	AutoRenew bool `json:"autoRenew" db:"auto_renew"`
+	// Какой срок подписки продлевает автопродление и номер попытки, с 0
+	RenewalPeriod  *time.Time `json:"-" db:"renewal_period"`
+	RenewalAttempt *int       `json:"-" db:"renewal_attempt"`
+	CreatedAt      time.Time  `json:"createdAt" db:"created_at"`
+	UpdatedAt      time.Time  `json:"updatedAt" db:"updated_at"`
+
+	// Что изменилось после смены статуса
+	Subscription *Subscription    `json:"subscription,omitempty" db:"-"`
+	Transaction  *CoinTransaction `json:"transaction,omitempty" db:"-"`
+}
+
+// CoinPack набор монет за деньги.
+type CoinPack struct {
+	Code  string `json:"code" mapstructure:"code"`
+	Coins int    `json:"coins" mapstructure:"coins"`
+	// Цена в копейках
+	Price    int    `json:"price" mapstructure:"price"`
+	Currency string `json:"currency" mapstructure:"currency"`
+}
+
+// CoinPackPurchaseInput покупка набора монет.
+type CoinPackPurchaseInput struct {
+	PackCode string `json:"pack" binding:"required"`
+}
@@ -0,0 +1,106 @@
+// Package app собирает зависимости сервиса из конфига и окружения. Общий запуск для API и cmd/worker.
+package app
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/ArtemChadaev/go/pkg/queue"
+	"github.com/ArtemChadaev/go/pkg/repository"
+	"github.com/ArtemChadaev/go/pkg/scheduler"
+	"github.com/ArtemChadaev/go/pkg/service"
+	"github.com/joho/godotenv"
+	"github.com/redis/go-redis/v9"
+	"github.com/spf13/viper"
+)
+
+// App подключения и сервисы одного процесса.
+type App struct {
+	Redis    *redis.Client
+	Jobs     *scheduler.Scheduler
+	Tasks    *queue.Queue
+	Services *service.Service
+}
+
+// InitConfig читает configs/config.yml и секреты из .env.
+func InitConfig() error {
+	viper.AddConfigPath("configs")
+	viper.SetConfigName("config")
+	if err := viper.ReadInConfig(); err != nil {
+		return err
+	}
+	return godotenv.Load()
+}
+
+// New подключается к Postgres и Redis и создает сервисы. Сервисы сразу регистрируют
+// фоновые задачи, обработчики очереди и событий, запускает их Run.
+func New() (*App, error) {
+	db, err := repository.NewPostgresDB(repository.PostgresConfig{
+		Host:     viper.GetString("db.host"),
+		Port:     viper.GetString("db.port"),
+		Username: viper.GetString("db.username"),
+		Database: viper.GetString("db.database"),
+		SSLMode:  viper.GetString("db.sslmode"),
+		Password: os.Getenv("DB_PASSWORD"),
+	})
+	if err != nil {
+		return nil, err
+	}
+	redis, err := repository.NewRedisClient(repository.RedisConfig{
+		Addr:     viper.GetString("redis.addr"),
+		Password: os.Getenv("REDIS_PASSWORD"),
+		DB:       viper.GetInt("redis.db"),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var serviceConfig service.Config
+	if err := viper.Unmarshal(&serviceConfig); err != nil {
+		return nil, fmt.Errorf("error reading service config: %w", err)
+	}
+	serviceConfig.Achievements.Catalog, err = service.LoadAchievementCatalog(serviceConfig.Achievements.CatalogFile)
+	if err != nil {
+		return nil, fmt.Errorf("error reading achievements catalog: %w", err)
+	}
+	serviceConfig.Payments.Mock.Secret = os.Getenv("MOCKPAY_SECRET")
+	serviceConfig.Notifications.SMTP.Password = os.Getenv("SMTP_PASSWORD")
+	var schedulerConfig scheduler.Config
+	if err := viper.UnmarshalKey("scheduler", &schedulerConfig); err != nil {
+		return nil, fmt.Errorf("error reading scheduler config: %w", err)
+	}
+	jobs, err := scheduler.New(redis, schedulerConfig)
+	if err != nil {
+		return nil, fmt.Errorf("error scheduler config: %w", err)
+	}
+	var queueConfig queue.Config
+	if err := viper.UnmarshalKey("queue", &queueConfig); err != nil {
+		return nil, fmt.Errorf("error reading queue config: %w", err)
+	}
+	tasks, err := queue.New(redis, queueConfig)
+	if err != nil {
+		return nil, fmt.Errorf("error queue config: %w", err)
+	}
+
+	return &App{
+		Redis:    redis,
+		Jobs:     jobs,
+		Tasks:    tasks,
+		Services: service.NewService(repository.NewRepository(db), redis, jobs, tasks, serviceConfig),
+	}, nil
+}
+
+// Run выполняет задачи по расписанию, обработчики событий и, если runQueue, задачи очереди,
+// пока не отменен ctx. Возвращается, когда начатая работа закончена, а лидерство отдано.
+func (a *App) Run(ctx context.Context, runQueue bool) {
+	var background sync.WaitGroup
+	// Задачи по расписанию выполняет только лидер, поэтому процессов может быть несколько
+	background.Go(func() { a.Jobs.Run(ctx) })
+	background.Go(func() { a.Services.Consume(ctx) })
+	if runQueue {
+		background.Go(func() { a.Tasks.Run(ctx) })
+	}
+	background.Wait()
+}
@@ -7,6 +7,9 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
+// Отпечаток устройства от клиента, используется для защиты реферальной программы от накруток
+const deviceFingerprintHeader = "X-Device-Fingerprint"
+
 func (h *Handler) signUp(c *gin.Context) {
 	var input rest.User
 
@@ -15,7 +18,10 @@ func (h *Handler) signUp(c *gin.Context) {
 		return
 	}
 
-	_, err := h.services.CreateUser(input)
+	_, err := h.services.CreateUser(input, rest.ReferralSignUp{
+		IP:                c.ClientIP(),
+		DeviceFingerprint: c.GetHeader(deviceFingerprintHeader),
+	})
 	if err != nil {
 		handleError(c, err)
 		return
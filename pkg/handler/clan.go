@@ -0,0 +1,387 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/ArtemChadaev/go"
+	"github.com/gin-gonic/gin"
+)
+
+// createClan Создание клана, создатель становится главой
+func (h *Handler) createClan(c *gin.Context) {
+	userId, err := getUserID(c)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	var input rest.ClanInput
+	if err := c.BindJSON(&input); err != nil {
+		handleError(c, rest.NewInvalidRequestError(err))
+		return
+	}
+
+	clan, err := h.services.CreateClan(userId, input)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, clan)
+}
+
+// getClan Информация о клане
+func (h *Handler) getClan(c *gin.Context) {
+	clanId, err := paramInt(c, "id")
+	if err != nil {
+		handleError(c, rest.NewInvalidRequestError(err))
+		return
+	}
+
+	clan, err := h.services.GetClan(clanId)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, clan)
+}
+
+// updateClan Изменение описания и данных клана
+func (h *Handler) updateClan(c *gin.Context) {
+	userId, err := getUserID(c)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+	clanId, err := paramInt(c, "id")
+	if err != nil {
+		handleError(c, rest.NewInvalidRequestError(err))
+		return
+	}
+
+	var input rest.ClanUpdateInput
+	if err := c.BindJSON(&input); err != nil {
+		handleError(c, rest.NewInvalidRequestError(err))
+		return
+	}
+
+	clan, err := h.services.UpdateClan(userId, clanId, input)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, clan)
+}
+
+// disbandClan Роспуск клана главой
+func (h *Handler) disbandClan(c *gin.Context) {
+	userId, err := getUserID(c)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+	clanId, err := paramInt(c, "id")
+	if err != nil {
+		handleError(c, rest.NewInvalidRequestError(err))
+		return
+	}
+
+	if err := h.services.DisbandClan(userId, clanId); err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// getClanMembers Участники клана
+func (h *Handler) getClanMembers(c *gin.Context) {
+	clanId, err := paramInt(c, "id")
+	if err != nil {
+		handleError(c, rest.NewInvalidRequestError(err))
+		return
+	}
+
+	members, err := h.services.GetClanMembers(clanId)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, members)
+}
+
+// inviteToClan Приглашение пользователя в клан
+func (h *Handler) inviteToClan(c *gin.Context) {
+	userId, err := getUserID(c)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+	clanId, err := paramInt(c, "id")
+	if err != nil {
+		handleError(c, rest.NewInvalidRequestError(err))
+		return
+	}
+
+	var input rest.ClanInviteInput
+	if err := c.BindJSON(&input); err != nil {
+		handleError(c, rest.NewInvalidRequestError(err))
+		return
+	}
+
+	invite, err := h.services.InviteToClan(userId, clanId, input.UserID)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, invite)
+}
+
+// requestToJoinClan Заявка на вступление в клан
+func (h *Handler) requestToJoinClan(c *gin.Context) {
+	userId, err := getUserID(c)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+	clanId, err := paramInt(c, "id")
+	if err != nil {
+		handleError(c, rest.NewInvalidRequestError(err))
+		return
+	}
+
+	invite, err := h.services.RequestToJoinClan(userId, clanId)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, invite)
+}
+
+// getClanInvites Приглашения и заявки клана
+func (h *Handler) getClanInvites(c *gin.Context) {
+	userId, err := getUserID(c)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+	clanId, err := paramInt(c, "id")
+	if err != nil {
+		handleError(c, rest.NewInvalidRequestError(err))
+		return
+	}
+
+	invites, err := h.services.GetClanInvites(userId, clanId)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, invites)
+}
+
+// getMyClanInvites Приглашения пользователя и его заявки
+func (h *Handler) getMyClanInvites(c *gin.Context) {
+	userId, err := getUserID(c)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	invites, err := h.services.GetMyClanInvites(userId)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, invites)
+}
+
+// acceptClanInvite Принять приглашение или заявку
+func (h *Handler) acceptClanInvite(c *gin.Context) {
+	userId, err := getUserID(c)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+	inviteId, err := paramInt(c, "inviteId")
+	if err != nil {
+		handleError(c, rest.NewInvalidRequestError(err))
+		return
+	}
+
+	if err := h.services.AcceptClanInvite(userId, inviteId); err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// declineClanInvite Отклонить приглашение или заявку
+func (h *Handler) declineClanInvite(c *gin.Context) {
+	userId, err := getUserID(c)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+	inviteId, err := paramInt(c, "inviteId")
+	if err != nil {
+		handleError(c, rest.NewInvalidRequestError(err))
+		return
+	}
+
+	if err := h.services.DeclineClanInvite(userId, inviteId); err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// leaveClan Выход из клана
+func (h *Handler) leaveClan(c *gin.Context) {
+	userId, err := getUserID(c)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+	clanId, err := paramInt(c, "id")
+	if err != nil {
+		handleError(c, rest.NewInvalidRequestError(err))
+		return
+	}
+
+	if err := h.services.LeaveClan(userId, clanId); err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// kickClanMember Исключение участника ниже рангом
+func (h *Handler) kickClanMember(c *gin.Context) {
+	userId, clanId, memberId, ok := clanMemberParams(c)
+	if !ok {
+		return
+	}
+
+	if err := h.services.KickClanMember(userId, clanId, memberId); err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// promoteClanMember Повышение участника на одну роль
+func (h *Handler) promoteClanMember(c *gin.Context) {
+	userId, clanId, memberId, ok := clanMemberParams(c)
+	if !ok {
+		return
+	}
+
+	member, err := h.services.PromoteClanMember(userId, clanId, memberId)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, member)
+}
+
+// demoteClanMember Понижение участника на одну роль
+func (h *Handler) demoteClanMember(c *gin.Context) {
+	userId, clanId, memberId, ok := clanMemberParams(c)
+	if !ok {
+		return
+	}
+
+	member, err := h.services.DemoteClanMember(userId, clanId, memberId)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, member)
+}
+
+// getClanRoles Роли клана с названиями и правами
+func (h *Handler) getClanRoles(c *gin.Context) {
+	clanId, err := paramInt(c, "id")
+	if err != nil {
+		handleError(c, rest.NewInvalidRequestError(err))
+		return
+	}
+
+	roles, err := h.services.GetClanRoles(clanId)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, roles)
+}
+
+// updateClanRole Глава меняет название и права роли
+func (h *Handler) updateClanRole(c *gin.Context) {
+	userId, err := getUserID(c)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+	clanId, err := paramInt(c, "id")
+	if err != nil {
+		handleError(c, rest.NewInvalidRequestError(err))
+		return
+	}
+	roleId, err := paramInt(c, "roleId")
+	if err != nil {
+		handleError(c, rest.NewInvalidRequestError(err))
+		return
+	}
+
+	var input rest.ClanRoleInput
+	if err := c.BindJSON(&input); err != nil {
+		handleError(c, rest.NewInvalidRequestError(err))
+		return
+	}
+
+	role, err := h.services.UpdateClanRole(userId, clanId, roleId, input)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, role)
+}
+
+// clanMemberParams пользователь, клан и участник из маршрута /:id/members/:userId.
+// Если что-то не так, ответ с ошибкой уже отправлен.
+func clanMemberParams(c *gin.Context) (userId, clanId, memberId int, ok bool) {
+	userId, err := getUserID(c)
+	if err != nil {
+		handleError(c, err)
+		return 0, 0, 0, false
+	}
+	clanId, err = paramInt(c, "id")
+	if err == nil {
+		memberId, err = paramInt(c, "userId")
+	}
+	if err != nil {
+		handleError(c, rest.NewInvalidRequestError(err))
+		return 0, 0, 0, false
+	}
+	return userId, clanId, memberId, true
+}
+
+func paramInt(c *gin.Context, name string) (int, error) {
+	return strconv.Atoi(c.Param(name))
+}
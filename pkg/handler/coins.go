@@ -0,0 +1,69 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/ArtemChadaev/go"
+	"github.com/gin-gonic/gin"
+)
+
+// getCoinHistory История изменений монет, параметры ?limit=&offset=
+func (h *Handler) getCoinHistory(c *gin.Context) {
+	userId, err := getUserID(c)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	limit, err := queryInt(c, "limit")
+	if err != nil {
+		handleError(c, rest.NewInvalidRequestError(err))
+		return
+	}
+	offset, err := queryInt(c, "offset")
+	if err != nil {
+		handleError(c, rest.NewInvalidRequestError(err))
+		return
+	}
+
+	history, err := h.services.GetCoinHistory(userId, limit, offset)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, history)
+}
+
+// transferCoins Перевод монет другому пользователю
+func (h *Handler) transferCoins(c *gin.Context) {
+	userId, err := getUserID(c)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	var input rest.CoinTransferInput
+	if err := c.BindJSON(&input); err != nil {
+		handleError(c, rest.NewInvalidRequestError(err))
+		return
+	}
+
+	transfer, err := h.services.TransferCoins(userId, input)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, transfer)
+}
+
+// queryInt читает необязательный числовой параметр запроса, если его нет - 0.
+func queryInt(c *gin.Context, name string) (int, error) {
+	value := c.Query(name)
+	if value == "" {
+		return 0, nil
+	}
+	return strconv.Atoi(value)
+}
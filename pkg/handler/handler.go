@@ -1,28 +1,60 @@
 package handler
 
 import (
+	"expvar"
+	"fmt"
+
+	"github.com/ArtemChadaev/go/pkg/repository"
 	"github.com/ArtemChadaev/go/pkg/service"
 	"github.com/gin-gonic/gin"
 	"github.com/redis/go-redis/v9"
 )
 
 type Handler struct {
-	services *service.Service
-	redis    *redis.Client
+	services   *service.Service
+	redis      *redis.Client
+	rateLimits *rateLimitPolicies
+	// Клиент лимитера с выключателем: при недоступности Redis лимитер считает в памяти
+	limiterRedis *redis.Client
+	// Прокси, которым доверяем X-Forwarded-For, от остальных IP клиента берется из соединения
+	trustedProxies []string
+
+	localRateLimiter *localRateLimiter
 }
 
-func NewHandler(services *service.Service, redis *redis.Client) *Handler {
-	return &Handler{
-		services: services,
-		redis:    redis,
+func NewHandler(services *service.Service, redis *redis.Client, rateLimit RateLimitConfig, trustedProxies []string) (*Handler, error) {
+	rateLimits, err := newRateLimitPolicies(rateLimit)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := parseCIDRs(trustedProxies); err != nil {
+		return nil, fmt.Errorf("trusted proxies: %w", err)
+	}
+
+	limiterRedis := redis
+	if redis != nil {
+		limiterRedis = repository.WithCircuitBreaker(redis)
 	}
+
+	return &Handler{
+		services:       services,
+		redis:          redis,
+		rateLimits:     rateLimits,
+		limiterRedis:   limiterRedis,
+		trustedProxies: trustedProxies,
+		// Запасной лимитер на время недоступности Redis
+		localRateLimiter: newLocalRateLimiter(localRateLimitKeys),
+	}, nil
 }
 
 // InitRoutes Машруты
 func (h *Handler) InitRoutes() *gin.Engine {
 	router := gin.New()
+	// По умолчанию gin верит X-Forwarded-For от кого угодно, и клиент мог бы подставить
+	// чужой IP, чтобы попасть в allowlist или обойти лимиты. Список уже проверен в NewHandler
+	_ = router.SetTrustedProxies(h.trustedProxies)
 
-	auth := router.Group("/auth", h.authRateLimiter)
+	auth := router.Group("/auth", h.rateLimit("auth"))
 	{
 		auth.POST("/sign-up", h.signUp)
 		auth.POST("/sign-in", h.signIn)
@@ -30,14 +62,81 @@ func (h *Handler) InitRoutes() *gin.Engine {
 
 	}
 
-	api := router.Group("/api", h.userIdentify, h.rateLimiter)
+	// Уведомления платежных провайдеров, проверяются по подписи
+	router.POST("/webhooks/payments/:provider", h.paymentWebhook)
+
+	api := router.Group("/api", h.userIdentify, h.rateLimit("api"))
 	{
 		settings := api.Group("/settings")
 		{
-			settings.POST("/subscript")
-			settings.POST("/dayCoin", h.dayCoin)
+			settings.GET("/subscript", h.getSubscriptionPlans)
+			settings.POST("/subscript", h.idempotency, h.buySubscription)
+			settings.POST("/subscript/coins", h.idempotency, h.buySubscriptionWithCoins)
+			settings.POST("/subscript/trial", h.idempotency, h.startTrial)
+			settings.POST("/subscript/cancel", h.cancelSubscription)
+			settings.PUT("/subscript/autoRenew", h.setAutoRenew)
+			settings.POST("/dayCoin", h.idempotency, h.dayCoin)
+			settings.GET("/dayCoin", h.getDayCoin)
 			settings.GET("/", h.getMySettings)
-			settings.PUT("/", h.setNameIcon)
+			settings.GET("/entitlements", h.getEntitlements)
+			settings.PUT("/", h.rateLimit("upload"), h.setNameIcon)
+			settings.PUT("/timezone", h.setTimezone)
+		}
+
+		coins := api.Group("/coins")
+		{
+			coins.GET("/history", h.getCoinHistory)
+			coins.POST("/transfer", h.idempotency, h.transferCoins)
+			coins.GET("/packs", h.getCoinPacks)
+			coins.POST("/buy", h.idempotency, h.buyCoins)
+		}
+
+		api.POST("/redeem", h.idempotency, h.redeemCode)
+		api.GET("/leaderboards/:board", h.getLeaderboard)
+		api.GET("/achievements", h.getAchievements)
+		api.GET("/referrals", h.getReferrals)
+		api.GET("/payments/:id", h.getPayment)
+
+		notifications := api.Group("/notifications")
+		{
+			notifications.GET("/", h.getNotifications)
+			notifications.POST("/read", h.readNotifications)
+		}
+
+		clans := api.Group("/clans")
+		{
+			clans.POST("/", h.createClan)
+			clans.GET("/invites", h.getMyClanInvites)
+			clans.POST("/invites/:inviteId/accept", h.acceptClanInvite)
+			clans.POST("/invites/:inviteId/decline", h.declineClanInvite)
+			clans.GET("/:id", h.getClan)
+			clans.PUT("/:id", h.updateClan)
+			clans.DELETE("/:id", h.disbandClan)
+			clans.GET("/:id/members", h.getClanMembers)
+			clans.GET("/:id/invites", h.getClanInvites)
+			clans.POST("/:id/invites", h.inviteToClan)
+			clans.POST("/:id/requests", h.requestToJoinClan)
+			clans.POST("/:id/leave", h.leaveClan)
+			clans.DELETE("/:id/members/:userId", h.kickClanMember)
+			clans.POST("/:id/members/:userId/promote", h.promoteClanMember)
+			clans.POST("/:id/members/:userId/demote", h.demoteClanMember)
+			clans.GET("/:id/roles", h.getClanRoles)
+			clans.PUT("/:id/roles/:roleId", h.updateClanRole)
+		}
+
+		admin := api.Group("/admin", h.adminIdentify)
+		{
+			redeem := admin.Group("/redeem")
+			{
+				redeem.POST("/batches", h.createRedeemBatch)
+				redeem.POST("/batches/:id/export", h.exportRedeemBatch)
+				redeem.GET("/exports/:exportId", h.getRedeemExport)
+			}
+			admin.POST("/leaderboards/rebuild", h.rebuildLeaderboards)
+			admin.GET("/jobs", h.getJobs)
+			admin.GET("/tasks/dead", h.getDeadTasks)
+			// Метрики (в том числе деградированного режима лимитеров, планировщика и очереди)
+			admin.GET("/debug/vars", gin.WrapH(expvar.Handler()))
 		}
 	}
 
@@ -0,0 +1,203 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/ArtemChadaev/go"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	idempotencyHeader = "Idempotency-Key"
+
+	// Сколько храним ответ для повторов
+	idempotencyTTL = 24 * time.Hour
+	// Сколько держим "замок" на запрос в обработке, если процесс упадет - он снимется сам.
+	// Пока запрос выполняется, замок продлевается каждую треть срока
+	idempotencyLockTTL = time.Minute
+	// Ограничение длины ключа от клиента
+	idempotencyKeyMaxLen = 255
+)
+
+// Продлевает замок, только если он все еще принадлежит этому запросу.
+var idempotencyRenewScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0`)
+
+// Снимает замок, только если он все еще принадлежит этому запросу.
+var idempotencyReleaseScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`)
+
+// idempotencyRecord то, что лежит в Redis по ключу идемпотентности.
+type idempotencyRecord struct {
+	// Хеш метода, пути и тела первого запроса
+	RequestHash string `json:"requestHash"`
+	// Уникален для каждого замка, чтобы не продлить и не снять чужой
+	Lock string `json:"lock,omitempty"`
+	// Пока ответа нет, запрос еще обрабатывается
+	Done        bool   `json:"done"`
+	Status      int    `json:"status,omitempty"`
+	ContentType string `json:"contentType,omitempty"`
+	Body        []byte `json:"body,omitempty"`
+}
+
+// responseRecorder копирует тело ответа, чтобы его можно было сохранить.
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *responseRecorder) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *responseRecorder) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// idempotency - middleware для запросов, меняющих монеты или подписку.
+// Если клиент прислал Idempotency-Key, первый ответ сохраняется и отдается на повторы,
+// параллельный дубль получает 409, а тот же ключ с другим телом - 422.
+func (h *Handler) idempotency(c *gin.Context) {
+	idempotencyKey := c.GetHeader(idempotencyHeader)
+	if idempotencyKey == "" {
+		c.Next()
+		return
+	}
+	if len(idempotencyKey) > idempotencyKeyMaxLen {
+		handleError(c, rest.NewInvalidRequestError(errors.New("idempotency key is too long")))
+		return
+	}
+
+	userId, err := getUserID(c)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		handleError(c, rest.NewInvalidRequestError(err))
+		return
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+	sum := sha256.New()
+	sum.Write([]byte(c.Request.Method + " " + c.FullPath() + "\n"))
+	sum.Write(body)
+	requestHash := hex.EncodeToString(sum.Sum(nil))
+
+	ctx := context.Background()
+	key := "idempotency:" + strconv.Itoa(userId) + ":" + idempotencyKey
+
+	// Пытаемся занять ключ. Деньги важнее доступности: без Redis такие запросы не выполняем.
+	lock, _ := json.Marshal(idempotencyRecord{RequestHash: requestHash, Lock: uuid.NewString()})
+	acquired, err := h.redis.SetNX(ctx, key, lock, idempotencyLockTTL).Result()
+	if err != nil {
+		handleError(c, rest.NewInternalServerError(err))
+		return
+	}
+
+	if !acquired {
+		h.replayIdempotent(c, key, requestHash)
+		return
+	}
+
+	recorder := &responseRecorder{ResponseWriter: c.Writer}
+	c.Writer = recorder
+	stopRenew := h.keepIdempotencyLock(key, lock)
+	c.Next()
+	stopRenew()
+
+	// После ошибки сервера клиент должен иметь возможность повторить запрос
+	if recorder.Status() >= 500 {
+		idempotencyReleaseScript.Run(ctx, h.redis, []string{key}, lock)
+		return
+	}
+
+	record, _ := json.Marshal(idempotencyRecord{
+		RequestHash: requestHash,
+		Done:        true,
+		Status:      recorder.Status(),
+		ContentType: recorder.Header().Get("Content-Type"),
+		Body:        recorder.body.Bytes(),
+	})
+	h.redis.Set(ctx, key, record, idempotencyTTL)
+}
+
+// keepIdempotencyLock продлевает замок, пока запрос выполняется, иначе медленный запрос
+// пережил бы замок и дубль выполнился бы второй раз. Возвращает функцию, которая останавливает продление.
+func (h *Handler) keepIdempotencyLock(key string, lock []byte) (stop func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(idempotencyLockTTL / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			err := idempotencyRenewScript.Run(ctx, h.redis, []string{key}, lock, idempotencyLockTTL.Milliseconds()).Err()
+			if err != nil && ctx.Err() == nil {
+				logrus.Errorf("idempotency: can't renew lock %s: %v", key, err)
+			}
+		}
+	}()
+
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+// replayIdempotent отвечает на повтор уже известного запроса.
+func (h *Handler) replayIdempotent(c *gin.Context, key, requestHash string) {
+	data, err := h.redis.Get(context.Background(), key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		// Первый запрос только что завершился ошибкой сервера и освободил ключ
+		handleError(c, rest.ErrIdempotencyRequestInProgress)
+		return
+	}
+	if err != nil {
+		handleError(c, rest.NewInternalServerError(err))
+		return
+	}
+
+	var record idempotencyRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		handleError(c, rest.NewInternalServerError(err))
+		return
+	}
+
+	switch {
+	case record.RequestHash != requestHash:
+		handleError(c, rest.ErrIdempotencyKeyReused)
+	case !record.Done:
+		handleError(c, rest.ErrIdempotencyRequestInProgress)
+	default:
+		c.Header("Idempotent-Replayed", "true")
+		c.Data(record.Status, record.ContentType, record.Body)
+		c.Abort()
+	}
+}
@@ -0,0 +1,42 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/ArtemChadaev/go"
+	"github.com/gin-gonic/gin"
+)
+
+// Сколько недоставленных задач показываем по умолчанию
+const defaultDeadTasksLimit = 100
+
+// getJobs Состояние фоновых задач для администратора
+func (h *Handler) getJobs(c *gin.Context) {
+	status, err := h.services.JobsStatus(c.Request.Context())
+	if err != nil {
+		handleError(c, rest.NewInternalServerError(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, status)
+}
+
+// getDeadTasks Задачи очереди, исчерпавшие попытки, параметр ?limit=
+func (h *Handler) getDeadTasks(c *gin.Context) {
+	limit, err := queryInt(c, "limit")
+	if err != nil {
+		handleError(c, rest.NewInvalidRequestError(err))
+		return
+	}
+	if limit <= 0 {
+		limit = defaultDeadTasksLimit
+	}
+
+	tasks, err := h.services.DeadLetters(c.Request.Context(), limit)
+	if err != nil {
+		handleError(c, rest.NewInternalServerError(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, tasks)
+}
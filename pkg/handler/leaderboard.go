@@ -0,0 +1,42 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/ArtemChadaev/go"
+	"github.com/gin-gonic/gin"
+)
+
+// getLeaderboard Рейтинг по монетам: топ, место пользователя и соседи
+func (h *Handler) getLeaderboard(c *gin.Context) {
+	userId, err := getUserID(c)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	var query rest.LeaderboardQuery
+	if err := c.BindQuery(&query); err != nil {
+		handleError(c, rest.NewInvalidRequestError(err))
+		return
+	}
+	query.Board = c.Param("board")
+
+	leaderboard, err := h.services.GetLeaderboard(userId, query)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, leaderboard)
+}
+
+// rebuildLeaderboards Пересчет рейтингов из базы администратором
+func (h *Handler) rebuildLeaderboards(c *gin.Context) {
+	if err := h.services.RebuildLeaderboards(); err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
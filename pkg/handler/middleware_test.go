@@ -0,0 +1,85 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ArtemChadaev/go"
+	"github.com/ArtemChadaev/go/pkg/service"
+	"github.com/gin-gonic/gin"
+)
+
+// fakeEntitlements тариф пользователя дает только perks, остальное предлагается в тарифе plan.
+type fakeEntitlements struct {
+	service.UserSettings
+	perks rest.PlanPerks
+	plan  string
+}
+
+func (f fakeEntitlements) RequireEntitlement(_ int, feature string) error {
+	if f.perks.Has(feature) {
+		return nil
+	}
+	return rest.NewEntitlementRequiredError(feature, f.plan)
+}
+
+func TestRequireEntitlement(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name       string
+		perks      rest.PlanPerks
+		wantStatus int
+	}{
+		{"plan has feature", rest.PlanPerks{rest.PerkBigAvatar: true}, http.StatusOK},
+		{"plan lacks feature", rest.PlanPerks{rest.PerkStreakFreeze: true}, http.StatusPaymentRequired},
+		{"no plan", nil, http.StatusPaymentRequired},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &Handler{services: &service.Service{
+				UserSettings: fakeEntitlements{perks: tt.perks, plan: "premium"},
+			}}
+			router := gin.New()
+			router.GET("/feature", func(c *gin.Context) { c.Set(userCtx, 1) },
+				h.requireEntitlement(rest.PerkBigAvatar), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/feature", nil))
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if tt.wantStatus == http.StatusOK {
+				return
+			}
+			var body OauthError
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			if body.ErrorField != "subscription_required" {
+				t.Errorf("error = %q, want subscription_required", body.ErrorField)
+			}
+			if !strings.Contains(body.ErrorDescription, `"premium"`) {
+				t.Errorf("description %q does not name the required plan", body.ErrorDescription)
+			}
+		})
+	}
+}
+
+func TestRequireEntitlementWithoutUser(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	h := &Handler{services: &service.Service{UserSettings: fakeEntitlements{plan: "premium"}}}
+	router := gin.New()
+	router.GET("/feature", h.requireEntitlement(rest.PerkBigAvatar), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/feature", nil))
+
+	if w.Code == http.StatusOK {
+		t.Error("request without user passed the entitlement check")
+	}
+}
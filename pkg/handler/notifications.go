@@ -0,0 +1,58 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/ArtemChadaev/go"
+	"github.com/gin-gonic/gin"
+)
+
+// getNotifications Уведомления пользователя, параметры ?limit=&offset=
+func (h *Handler) getNotifications(c *gin.Context) {
+	userId, err := getUserID(c)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	limit, err := queryInt(c, "limit")
+	if err != nil {
+		handleError(c, rest.NewInvalidRequestError(err))
+		return
+	}
+	offset, err := queryInt(c, "offset")
+	if err != nil {
+		handleError(c, rest.NewInvalidRequestError(err))
+		return
+	}
+
+	notifications, err := h.services.GetNotifications(userId, limit, offset)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, notifications)
+}
+
+// readNotifications Отметить уведомления прочитанными, без ids - все
+func (h *Handler) readNotifications(c *gin.Context) {
+	userId, err := getUserID(c)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	var input rest.NotificationsReadInput
+	if err := c.BindJSON(&input); err != nil {
+		handleError(c, rest.NewInvalidRequestError(err))
+		return
+	}
+
+	if err := h.services.MarkNotificationsRead(userId, input.IDs); err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,74 @@
+package handler
+
+import (
+	"io"
+	"net/http"
+
+	"github.com/ArtemChadaev/go"
+	"github.com/gin-gonic/gin"
+)
+
+// Больше уведомление провайдера быть не может
+const maxWebhookBodySize = 1 << 20
+
+// getCoinPacks Наборы монет, которые можно купить
+func (h *Handler) getCoinPacks(c *gin.Context) {
+	c.JSON(http.StatusOK, h.services.GetCoinPacks())
+}
+
+// buyCoins Оплата набора монет: создает платеж и возвращает ссылку на страницу оплаты
+func (h *Handler) buyCoins(c *gin.Context) {
+	userId, err := getUserID(c)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	var input rest.CoinPackPurchaseInput
+	if err := c.BindJSON(&input); err != nil {
+		handleError(c, rest.NewInvalidRequestError(err))
+		return
+	}
+
+	payment, err := h.services.CreateCoinsCheckout(userId, input.PackCode)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, payment)
+}
+
+// getPayment Статус платежа пользователя
+func (h *Handler) getPayment(c *gin.Context) {
+	userId, err := getUserID(c)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	payment, err := h.services.GetPayment(userId, c.Param("id"))
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, payment)
+}
+
+// paymentWebhook Уведомление провайдера о смене статуса платежа.
+// Подпись считается по телу как есть, поэтому оно читается без разбора JSON.
+func (h *Handler) paymentWebhook(c *gin.Context) {
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxWebhookBodySize))
+	if err != nil {
+		handleError(c, rest.NewInvalidRequestError(err))
+		return
+	}
+
+	if err := h.services.HandlePaymentWebhook(c.Param("provider"), c.Request.Header, body); err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
@@ -0,0 +1,348 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ArtemChadaev/go"
+	"github.com/ArtemChadaev/go/pkg/repository"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+)
+
+// Источники ключа, по которому считаются запросы
+const (
+	rateLimitKeyUser   = "user"
+	rateLimitKeyIP     = "ip"
+	rateLimitKeyAPIKey = "apiKey"
+	rateLimitKeyRoute  = "route"
+
+	// ID проверенного API-ключа в контексте запроса, ставит аутентификация по ключу
+	apiKeyCtx = "apiKeyId"
+
+	// Результат самой строгой из пройденных политик, из него берутся заголовки
+	rateLimitResultCtx = "rateLimitResult"
+)
+
+// RateLimitPolicy именованная политика ограничения частоты запросов из конфига.
+type RateLimitPolicy struct {
+	// Сколько "единиц" можно потратить за окно
+	Limit int `mapstructure:"limit"`
+	// Размер окна
+	Window time.Duration `mapstructure:"window"`
+	// По чему считаем: user, ip, apiKey, route
+	Key string `mapstructure:"key"`
+	// Лимит для пользователей с платной подпиской, если 0 - как у всех
+	PaidLimit int `mapstructure:"paidLimit"`
+	// Стоимость отдельных маршрутов, по умолчанию запрос стоит 1
+	Costs []RateLimitCost `mapstructure:"costs"`
+}
+
+// RateLimitCost стоимость маршрута вида "PUT /api/settings/".
+type RateLimitCost struct {
+	Route string `mapstructure:"route"`
+	Cost  int    `mapstructure:"cost"`
+}
+
+// cost возвращает стоимость запроса для маршрута.
+func (p RateLimitPolicy) cost(route string) int {
+	for _, c := range p.Costs {
+		if c.Route == route && c.Cost > 0 {
+			return c.Cost
+		}
+	}
+	return 1
+}
+
+// RateLimitAllowlist клиенты, которых не ограничиваем: внутренние инструменты, нагрузочные тесты.
+type RateLimitAllowlist struct {
+	// IP или подсети, например "10.0.0.0/8" или "127.0.0.1"
+	CIDRs []string `mapstructure:"cidrs"`
+	// ID пользователей
+	Users []int `mapstructure:"users"`
+}
+
+// RateLimitConfig секция rateLimit из конфига.
+type RateLimitConfig struct {
+	Policies  map[string]RateLimitPolicy `mapstructure:"policies"`
+	Allowlist RateLimitAllowlist         `mapstructure:"allowlist"`
+}
+
+// rateLimitPolicies хранит политики и allowlist, их можно заменить на лету при изменении конфига.
+type rateLimitPolicies struct {
+	mu       sync.RWMutex
+	policies map[string]RateLimitPolicy
+	nets     []*net.IPNet
+	users    map[int]bool
+}
+
+func newRateLimitPolicies(cfg RateLimitConfig) (*rateLimitPolicies, error) {
+	p := &rateLimitPolicies{}
+	return p, p.set(cfg)
+}
+
+func (p *rateLimitPolicies) get(name string) (RateLimitPolicy, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	policy, ok := p.policies[name]
+	return policy, ok
+}
+
+func (p *rateLimitPolicies) set(cfg RateLimitConfig) error {
+	for name, policy := range cfg.Policies {
+		for _, c := range policy.Costs {
+			// Такой запрос не поместится даже в пустое ведро
+			if c.Cost > policy.Limit {
+				return fmt.Errorf("rate limit policy %s: cost %d of %s exceeds limit %d", name, c.Cost, c.Route, policy.Limit)
+			}
+		}
+	}
+	nets, err := parseCIDRs(cfg.Allowlist.CIDRs)
+	if err != nil {
+		return err
+	}
+	users := make(map[int]bool, len(cfg.Allowlist.Users))
+	for _, id := range cfg.Allowlist.Users {
+		users[id] = true
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.policies = cfg.Policies
+	p.nets = nets
+	p.users = users
+	return nil
+}
+
+// parseCIDRs разбирает список IP и подсетей вида "10.0.0.0/8" или "127.0.0.1".
+func parseCIDRs(cidrs []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		// Одиночный адрес превращаем в подсеть из одного адреса
+		if !strings.Contains(cidr, "/") {
+			if ip := net.ParseIP(cidr); ip != nil && ip.To4() != nil {
+				cidr += "/32"
+			} else {
+				cidr += "/128"
+			}
+		}
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, err
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets, nil
+}
+
+// allowed проверяет, входит ли клиент в allowlist.
+func (p *rateLimitPolicies) allowed(c *gin.Context) bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if userId, err := getUserID(c); err == nil && p.users[userId] {
+		return true
+	}
+	ip := net.ParseIP(c.ClientIP())
+	for _, ipNet := range p.nets {
+		if ip != nil && ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// SetRateLimitConfig заменяет политики и allowlist без перезапуска сервера.
+func (h *Handler) SetRateLimitConfig(cfg RateLimitConfig) error {
+	return h.rateLimits.set(cfg)
+}
+
+// rateLimitKey возвращает идентификатор клиента для политики и ошибку, которую отдадим при превышении.
+func rateLimitKey(c *gin.Context, source string) (string, *rest.AppError) {
+	switch source {
+	case rateLimitKeyIP:
+	case rateLimitKeyUser:
+		if userId, err := getUserID(c); err == nil {
+			return "user:" + strconv.Itoa(userId), rest.ErrTooManyRequestsByUser
+		}
+	case rateLimitKeyAPIKey:
+		// Только проверенный ключ: по заголовку клиент получал бы новое ведро на каждый запрос.
+		// Без ключа считаем по пользователю, а если его нет - по IP
+		if apiKeyId := c.GetString(apiKeyCtx); apiKeyId != "" {
+			return "api_key:" + apiKeyId, rest.ErrTooManyRequests
+		}
+		if userId, err := getUserID(c); err == nil {
+			return "user:" + strconv.Itoa(userId), rest.ErrTooManyRequestsByUser
+		}
+	case rateLimitKeyRoute:
+		return "route:" + c.Request.Method + " " + c.FullPath(), rest.ErrTooManyRequests
+	}
+	// По умолчанию, и если нужного идентификатора нет, считаем по IP
+	return "ip:" + c.ClientIP(), rest.ErrTooManyRequestsByIp
+}
+
+// gcraScript атомарно реализует GCRA (generic cell rate algorithm, он же token bucket).
+// Храним одно число - TAT (theoretical arrival time), время, когда "ведро" снова станет пустым.
+// Время берем у самого Redis, чтобы у всех реплик были одинаковые часы.
+// KEYS[1] - ключ, ARGV[1] - лимит, ARGV[2] - окно в мс, ARGV[3] - стоимость запроса.
+// Возвращает {разрешено, осталось, через сколько мс ведро опустеет, через сколько мс можно повторить}.
+var gcraScript = redis.NewScript(`
+local limit = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local cost = tonumber(ARGV[3])
+local interval = window / limit
+
+local t = redis.call("TIME")
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+
+local tat = tonumber(redis.call("GET", KEYS[1]))
+if not tat or tat < now then
+	tat = now
+end
+
+local newTat = tat + interval * cost
+local allowAt = newTat - window
+if allowAt > now then
+	local remaining = math.floor((now - (tat - window)) / interval)
+	if remaining < 0 then
+		remaining = 0
+	end
+	return {0, remaining, math.ceil(tat - now), math.ceil(allowAt - now)}
+end
+
+redis.call("SET", KEYS[1], math.ceil(newTat), "PX", math.ceil(newTat - now))
+local remaining = math.floor((now - allowAt) / interval)
+return {1, remaining, math.ceil(newTat - now), 0}
+`)
+
+// rateLimitResult результат проверки лимита, из него формируются заголовки ответа.
+type rateLimitResult struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	Reset      time.Duration
+	RetryAfter time.Duration
+}
+
+// allowRedis списывает cost единиц из "ведра" key в Redis.
+func (h *Handler) allowRedis(ctx context.Context, key string, policy RateLimitPolicy, cost int) (rateLimitResult, error) {
+	values, err := gcraScript.Run(ctx, h.limiterRedis, []string{key},
+		policy.Limit, policy.Window.Milliseconds(), cost).Int64Slice()
+	if err != nil {
+		return rateLimitResult{}, err
+	}
+
+	return rateLimitResult{
+		Allowed:    values[0] == 1,
+		Limit:      policy.Limit,
+		Remaining:  int(values[1]),
+		Reset:      time.Duration(values[2]) * time.Millisecond,
+		RetryAfter: time.Duration(values[3]) * time.Millisecond,
+	}, nil
+}
+
+// stricter из двух результатов выбирает тот, что раньше приведет к отказу.
+func (r rateLimitResult) stricter(other rateLimitResult) rateLimitResult {
+	switch {
+	case r.Allowed != other.Allowed:
+		if !r.Allowed {
+			return r
+		}
+		return other
+	case r.Remaining != other.Remaining:
+		if r.Remaining < other.Remaining {
+			return r
+		}
+		return other
+	case r.Reset >= other.Reset:
+		return r
+	default:
+		return other
+	}
+}
+
+// setRateLimitHeaders выставляет заголовки RateLimit-* и Retry-After (в секундах).
+// Если запрос прошел несколько политик, заголовки описывают самую строгую из них.
+func setRateLimitHeaders(c *gin.Context, res rateLimitResult) {
+	if prev, ok := c.Get(rateLimitResultCtx); ok {
+		res = res.stricter(prev.(rateLimitResult))
+	}
+	c.Set(rateLimitResultCtx, res)
+
+	c.Header("RateLimit-Limit", strconv.Itoa(res.Limit))
+	c.Header("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+	c.Header("RateLimit-Reset", strconv.Itoa(ceilSeconds(res.Reset)))
+	c.Header("Retry-After", strconv.Itoa(ceilSeconds(res.RetryAfter)))
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int((d + time.Second - 1) / time.Second)
+}
+
+// rateLimit - это middleware, ограничивающее частоту запросов по политике с именем name.
+func (h *Handler) rateLimit(name string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		policy, ok := h.rateLimits.get(name)
+		if !ok || policy.Limit <= 0 || policy.Window <= 0 {
+			logrus.Errorf("rate limit policy %q is not configured", name)
+			c.Next()
+			return
+		}
+
+		if h.rateLimits.allowed(c) {
+			c.Next()
+			return
+		}
+
+		id, limitErr := rateLimitKey(c, policy.Key)
+		key := "rate_limit:" + name + ":" + id
+		policy = h.userTierPolicy(c, policy)
+		cost := policy.cost(c.Request.Method + " " + c.FullPath())
+
+		res, err := h.allowRedis(context.Background(), key, policy, cost)
+		if err != nil {
+			// Если Redis недоступен, считаем в памяти процесса, чтобы не остаться без защиты.
+			if !errors.Is(err, repository.ErrCircuitOpen) {
+				logrus.Errorf("rate limit: redis error, using local limiter: %v", err)
+			}
+			rateLimitDegraded.Add(1)
+			res = h.localRateLimiter.allow(key, policy, cost)
+		}
+
+		setRateLimitHeaders(c, res)
+		if !res.Allowed {
+			handleError(c, rest.NewTooManyRequestsError(limitErr, res.RetryAfter))
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// userTierPolicy повышает лимит подписчикам, чей тариф это дает, если политика это предусматривает.
+func (h *Handler) userTierPolicy(c *gin.Context, policy RateLimitPolicy) RateLimitPolicy {
+	if policy.PaidLimit <= 0 {
+		return policy
+	}
+	userId, err := getUserID(c)
+	if err != nil {
+		return policy
+	}
+
+	entitlements, err := h.services.GetEntitlements(userId)
+	if err != nil {
+		logrus.Errorf("rate limit: can't resolve user tier: %v", err)
+		return policy
+	}
+	if entitlements.Perks.Has(rest.PerkPaidRateLimit) {
+		policy.Limit = policy.PaidLimit
+	}
+	return policy
+}
@@ -0,0 +1,99 @@
+package handler
+
+import (
+	"container/list"
+	"expvar"
+	"sync"
+	"time"
+)
+
+// Сколько ключей держит локальный лимитер, самые старые вытесняются
+const localRateLimitKeys = 10000
+
+// Метрика: сколько запросов проверено локально, пока Redis недоступен
+var rateLimitDegraded = expvar.NewInt("rate_limit_degraded_requests")
+
+// localRateLimiter - запасной лимитер в памяти процесса на время недоступности Redis.
+// Алгоритм тот же GCRA, ключи хранятся в LRU ограниченного размера.
+// Лимиты считаются на каждую реплику отдельно, но это лучше, чем не ограничивать совсем.
+type localRateLimiter struct {
+	mu    sync.Mutex
+	size  int
+	order *list.List
+	items map[string]*list.Element
+	// Часы, в тестах подменяются
+	now func() time.Time
+}
+
+type localRateLimitItem struct {
+	key string
+	tat time.Time
+}
+
+func newLocalRateLimiter(size int) *localRateLimiter {
+	return &localRateLimiter{
+		size:  size,
+		order: list.New(),
+		items: make(map[string]*list.Element, size),
+		now:   time.Now,
+	}
+}
+
+// allow повторяет логику gcraScript.
+func (l *localRateLimiter) allow(key string, policy RateLimitPolicy, cost int) rateLimitResult {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	interval := policy.Window / time.Duration(policy.Limit)
+
+	item := l.get(key)
+	tat := now
+	if item != nil && item.tat.After(now) {
+		tat = item.tat
+	}
+
+	newTat := tat.Add(interval * time.Duration(cost))
+	allowAt := newTat.Add(-policy.Window)
+	if allowAt.After(now) {
+		return rateLimitResult{
+			Allowed:    false,
+			Limit:      policy.Limit,
+			Remaining:  max(0, int(now.Sub(tat.Add(-policy.Window))/interval)),
+			Reset:      tat.Sub(now),
+			RetryAfter: allowAt.Sub(now),
+		}
+	}
+
+	l.set(key, newTat)
+	return rateLimitResult{
+		Allowed:   true,
+		Limit:     policy.Limit,
+		Remaining: int(now.Sub(allowAt) / interval),
+		Reset:     newTat.Sub(now),
+	}
+}
+
+func (l *localRateLimiter) get(key string) *localRateLimitItem {
+	el, ok := l.items[key]
+	if !ok {
+		return nil
+	}
+	l.order.MoveToFront(el)
+	return el.Value.(*localRateLimitItem)
+}
+
+func (l *localRateLimiter) set(key string, tat time.Time) {
+	if el, ok := l.items[key]; ok {
+		el.Value.(*localRateLimitItem).tat = tat
+		l.order.MoveToFront(el)
+		return
+	}
+
+	l.items[key] = l.order.PushFront(&localRateLimitItem{key: key, tat: tat})
+	if l.order.Len() > l.size {
+		oldest := l.order.Back()
+		l.order.Remove(oldest)
+		delete(l.items, oldest.Value.(*localRateLimitItem).key)
+	}
+}
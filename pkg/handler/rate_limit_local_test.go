@@ -0,0 +1,108 @@
+package handler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// Шаг сценария: через after после предыдущего запроса списываем cost единиц
+type rateLimitStep struct {
+	after time.Duration
+	cost  int
+	want  rateLimitResult
+}
+
+// 10 запросов в минуту - одна единица восстанавливается за 6 секунд
+var rateLimitTestPolicy = RateLimitPolicy{Limit: 10, Window: time.Minute}
+
+func rateLimitScenario() []rateLimitStep {
+	steps := make([]rateLimitStep, 0, 16)
+	// Полное ведро: можно потратить весь лимит сразу
+	for i := 1; i <= 10; i++ {
+		steps = append(steps, rateLimitStep{cost: 1, want: rateLimitResult{
+			Allowed: true, Limit: 10, Remaining: 10 - i, Reset: time.Duration(i) * 6 * time.Second,
+		}})
+	}
+	return append(steps,
+		// Лимит исчерпан, следующая единица через 6 секунд
+		rateLimitStep{cost: 1, want: rateLimitResult{
+			Allowed: false, Limit: 10, Remaining: 0, Reset: time.Minute, RetryAfter: 6 * time.Second,
+		}},
+		rateLimitStep{after: 3 * time.Second, cost: 1, want: rateLimitResult{
+			Allowed: false, Limit: 10, Remaining: 0, Reset: 57 * time.Second, RetryAfter: 3 * time.Second,
+		}},
+		rateLimitStep{after: 3 * time.Second, cost: 1, want: rateLimitResult{
+			Allowed: true, Limit: 10, Remaining: 0, Reset: time.Minute,
+		}},
+		// Дорогой запрос ждет, пока восстановится вся его стоимость
+		rateLimitStep{after: 12 * time.Second, cost: 5, want: rateLimitResult{
+			Allowed: false, Limit: 10, Remaining: 2, Reset: 48 * time.Second, RetryAfter: 18 * time.Second,
+		}},
+		rateLimitStep{after: 18 * time.Second, cost: 5, want: rateLimitResult{
+			Allowed: true, Limit: 10, Remaining: 0, Reset: time.Minute,
+		}},
+		// Простой дольше окна не копит больше лимита
+		rateLimitStep{after: time.Hour, cost: 1, want: rateLimitResult{
+			Allowed: true, Limit: 10, Remaining: 9, Reset: 6 * time.Second,
+		}},
+	)
+}
+
+func TestLocalRateLimiter(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	limiter := newLocalRateLimiter(10)
+	limiter.now = func() time.Time { return now }
+
+	for i, step := range rateLimitScenario() {
+		now = now.Add(step.after)
+		if got := limiter.allow("key", rateLimitTestPolicy, step.cost); got != step.want {
+			t.Fatalf("step %d: allow() = %+v, want %+v", i, got, step.want)
+		}
+	}
+}
+
+func TestLocalRateLimiterEvictsOldestKey(t *testing.T) {
+	limiter := newLocalRateLimiter(2)
+	policy := RateLimitPolicy{Limit: 1, Window: time.Minute}
+
+	for _, key := range []string{"a", "b", "a", "c"} {
+		limiter.allow(key, policy, 1)
+	}
+
+	if _, ok := limiter.items["b"]; ok {
+		t.Error("least recently used key b was not evicted")
+	}
+	if got := limiter.allow("a", policy, 1); got.Allowed {
+		t.Error("key a was evicted instead of b")
+	}
+	if got := limiter.allow("b", policy, 1); !got.Allowed {
+		t.Error("evicted key b starts with an empty bucket")
+	}
+}
+
+// Скрипт в Redis и локальный лимитер должны давать одинаковые ответы
+func TestGCRAScript(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+	h := &Handler{limiterRedis: client}
+
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i, step := range rateLimitScenario() {
+		now = now.Add(step.after)
+		mr.SetTime(now)
+		mr.FastForward(step.after)
+
+		got, err := h.allowRedis(context.Background(), "rate_limit:test", rateLimitTestPolicy, step.cost)
+		if err != nil {
+			t.Fatalf("step %d: %v", i, err)
+		}
+		if got != step.want {
+			t.Fatalf("step %d: allowRedis() = %+v, want %+v", i, got, step.want)
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ArtemChadaev/go"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestRateLimitPolicyCost(t *testing.T) {
+	policy := RateLimitPolicy{Costs: []RateLimitCost{
+		{Route: "PUT /api/settings/", Cost: 5},
+		{Route: "POST /api/coins/buy", Cost: 0},
+	}}
+
+	tests := []struct {
+		route string
+		want  int
+	}{
+		{"PUT /api/settings/", 5},
+		{"GET /api/settings/", 1},
+		// Нулевая стоимость в конфиге не делает запрос бесплатным
+		{"POST /api/coins/buy", 1},
+	}
+	for _, tt := range tests {
+		if got := policy.cost(tt.route); got != tt.want {
+			t.Errorf("cost(%q) = %d, want %d", tt.route, got, tt.want)
+		}
+	}
+}
+
+func TestRateLimitKey(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name   string
+		source string
+		userId int
+		apiKey string
+		// ID ключа, который проверила аутентификация
+		apiKeyId string
+		want     string
+		wantErr  *rest.AppError
+	}{
+		{name: "ip", source: rateLimitKeyIP, userId: 7, want: "ip:192.0.2.1", wantErr: rest.ErrTooManyRequestsByIp},
+		{name: "user", source: rateLimitKeyUser, userId: 7, want: "user:7", wantErr: rest.ErrTooManyRequestsByUser},
+		{name: "user without identity", source: rateLimitKeyUser, want: "ip:192.0.2.1", wantErr: rest.ErrTooManyRequestsByIp},
+		{name: "validated api key", source: rateLimitKeyAPIKey, apiKey: "secret", apiKeyId: "42", userId: 7, want: "api_key:42", wantErr: rest.ErrTooManyRequests},
+		// Непроверенный заголовок не дает нового ведра
+		{name: "unvalidated api key of user", source: rateLimitKeyAPIKey, apiKey: "random", userId: 7, want: "user:7", wantErr: rest.ErrTooManyRequestsByUser},
+		{name: "unvalidated api key", source: rateLimitKeyAPIKey, apiKey: "random", want: "ip:192.0.2.1", wantErr: rest.ErrTooManyRequestsByIp},
+		{name: "route", source: rateLimitKeyRoute, userId: 7, want: "route:GET /api/leaderboards/:board", wantErr: rest.ErrTooManyRequests},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.New()
+			var got string
+			var gotErr *rest.AppError
+			router.GET("/api/leaderboards/:board", func(c *gin.Context) {
+				if tt.userId != 0 {
+					c.Set(userCtx, tt.userId)
+				}
+				if tt.apiKeyId != "" {
+					c.Set(apiKeyCtx, tt.apiKeyId)
+				}
+				got, gotErr = rateLimitKey(c, tt.source)
+			})
+
+			req := httptest.NewRequest("GET", "/api/leaderboards/weekly", nil)
+			req.RemoteAddr = "192.0.2.1:1234"
+			if tt.apiKey != "" {
+				req.Header.Set("X-API-Key", tt.apiKey)
+			}
+			router.ServeHTTP(httptest.NewRecorder(), req)
+
+			if got != tt.want || gotErr != tt.wantErr {
+				t.Errorf("rateLimitKey() = %q, %v, want %q, %v", got, gotErr, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRateLimitAllowlist(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := RateLimitConfig{Allowlist: RateLimitAllowlist{CIDRs: []string{"10.0.0.0/8", "192.0.2.7"}, Users: []int{42}}}
+
+	tests := []struct {
+		name           string
+		trustedProxies []string
+		remoteAddr     string
+		forwardedFor   string
+		userId         int
+		want           bool
+	}{
+		{name: "allowlisted subnet", remoteAddr: "10.1.2.3:1234", want: true},
+		{name: "allowlisted address", remoteAddr: "192.0.2.7:1234", want: true},
+		{name: "other address", remoteAddr: "192.0.2.8:1234", want: false},
+		{name: "allowlisted user", remoteAddr: "192.0.2.8:1234", userId: 42, want: true},
+		// Без доверенных прокси заголовок не помогает попасть в allowlist
+		{name: "spoofed forwarded for", remoteAddr: "203.0.113.5:1234", forwardedFor: "10.1.2.3", want: false},
+		{name: "untrusted proxy", trustedProxies: []string{"198.51.100.0/24"}, remoteAddr: "203.0.113.5:1234", forwardedFor: "10.1.2.3", want: false},
+		{name: "trusted proxy", trustedProxies: []string{"203.0.113.5"}, remoteAddr: "203.0.113.5:1234", forwardedFor: "10.1.2.3", want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, err := NewHandler(nil, nil, cfg, tt.trustedProxies)
+			if err != nil {
+				t.Fatal(err)
+			}
+			router := h.InitRoutes()
+			var got bool
+			router.GET("/test", func(c *gin.Context) {
+				if tt.userId != 0 {
+					c.Set(userCtx, tt.userId)
+				}
+				got = h.rateLimits.allowed(c)
+			})
+
+			req := httptest.NewRequest("GET", "/test", nil)
+			req.RemoteAddr = tt.remoteAddr
+			if tt.forwardedFor != "" {
+				req.Header.Set("X-Forwarded-For", tt.forwardedFor)
+			}
+			router.ServeHTTP(httptest.NewRecorder(), req)
+
+			if got != tt.want {
+				t.Errorf("allowed() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewHandlerRejectsInvalidProxies(t *testing.T) {
+	if _, err := NewHandler(nil, nil, RateLimitConfig{}, []string{"not an ip"}); err == nil {
+		t.Error("invalid trusted proxy accepted")
+	}
+}
+
+func TestRateLimitConfigRejectsUnaffordableCost(t *testing.T) {
+	cfg := RateLimitConfig{Policies: map[string]RateLimitPolicy{
+		"api": {Limit: 5, Window: time.Minute, Costs: []RateLimitCost{{Route: "PUT /api/settings/", Cost: 6}}},
+	}}
+	if _, err := NewHandler(nil, nil, cfg, nil); err == nil {
+		t.Fatal("cost above the policy limit accepted on load")
+	}
+
+	h, err := NewHandler(nil, nil, RateLimitConfig{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := h.SetRateLimitConfig(cfg); err == nil {
+		t.Error("cost above the policy limit accepted on reload")
+	}
+}
+
+// Заголовки описывают политику, которая первой откажет, а не последнюю проверенную
+func TestRateLimitHeadersShowStrictestPolicy(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+
+	h, err := NewHandler(nil, client, RateLimitConfig{Policies: map[string]RateLimitPolicy{
+		"api":    {Limit: 2, Window: time.Minute, Key: rateLimitKeyIP},
+		"upload": {Limit: 10, Window: time.Hour, Key: rateLimitKeyIP},
+	}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	router := gin.New()
+	router.PUT("/upload", h.rateLimit("api"), h.rateLimit("upload"), func(c *gin.Context) {})
+
+	wantRemaining := []string{"1", "0"}
+	for i, want := range wantRemaining {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("PUT", "/upload", nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("request %d: status %d", i, w.Code)
+		}
+		if got := w.Header().Get("RateLimit-Remaining"); got != want {
+			t.Errorf("request %d: RateLimit-Remaining = %s, want %s", i, got, want)
+		}
+		if got := w.Header().Get("RateLimit-Limit"); got != "2" {
+			t.Errorf("request %d: RateLimit-Limit = %s, want the api limit 2", i, got)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("PUT", "/upload", nil))
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "0" {
+		t.Errorf("third request: status %d, Retry-After %s, want 429 with a delay", w.Code, w.Header().Get("Retry-After"))
+	}
+}
@@ -0,0 +1,93 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/ArtemChadaev/go"
+	"github.com/gin-gonic/gin"
+)
+
+// redeemCode Активация промокода пользователем
+func (h *Handler) redeemCode(c *gin.Context) {
+	userId, err := getUserID(c)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	var input rest.RedeemInput
+	if err := c.BindJSON(&input); err != nil {
+		handleError(c, rest.NewInvalidRequestError(err))
+		return
+	}
+
+	result, err := h.services.RedeemCode(userId, input.Code)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// createRedeemBatch Выпуск партии промокодов администратором
+func (h *Handler) createRedeemBatch(c *gin.Context) {
+	adminId, err := getUserID(c)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	var input rest.RedeemBatchInput
+	if err := c.BindJSON(&input); err != nil {
+		handleError(c, rest.NewInvalidRequestError(err))
+		return
+	}
+
+	batch, err := h.services.CreateRedeemBatch(adminId, input)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, batch)
+}
+
+// exportRedeemBatch Выгрузка кодов партии в CSV для маркетинга. Файл собирается в очереди,
+// забирать его через getRedeemExport
+func (h *Handler) exportRedeemBatch(c *gin.Context) {
+	batchId, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		handleError(c, rest.NewInvalidRequestError(err))
+		return
+	}
+
+	export, err := h.services.ExportRedeemBatch(batchId)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, export)
+}
+
+// getRedeemExport Готовая выгрузка отдается файлом, пока она собирается - ее состояние
+func (h *Handler) getRedeemExport(c *gin.Context) {
+	export, file, err := h.services.GetRedeemExport(c.Param("exportId"))
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	switch export.Status {
+	case rest.RedeemExportReady:
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=redeem_batch_%d.csv", export.BatchID))
+		c.Data(http.StatusOK, "text/csv; charset=utf-8", file)
+	case rest.RedeemExportPending:
+		c.JSON(http.StatusAccepted, export)
+	default:
+		c.JSON(http.StatusOK, export)
+	}
+}
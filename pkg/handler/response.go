@@ -14,6 +14,7 @@ import (
 type OauthError struct {
 	ErrorField       string `json:"error"`
 	ErrorDescription string `json:"error_description,omitempty"`
+	RetryAfter       int    `json:"retry_after,omitempty"`
 }
 
 // handleError обрабатывает любую ошибку, пришедшую из слоев ниже.
@@ -33,6 +34,7 @@ func handleError(c *gin.Context, err error) {
 		c.AbortWithStatusJSON(appErr.HTTPStatus, OauthError{
 			ErrorField:       appErr.Code,
 			ErrorDescription: appErr.Message,
+			RetryAfter:       int(appErr.RetryAfter.Seconds()),
 		})
 	} else {
 		// Если это неизвестная, непредвиденная ошибка.
@@ -0,0 +1,122 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/ArtemChadaev/go"
+	"github.com/gin-gonic/gin"
+)
+
+// getSubscriptionPlans Тарифы подписки, которые можно купить
+func (h *Handler) getSubscriptionPlans(c *gin.Context) {
+	plans, err := h.services.GetSubscriptionPlans()
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, plans)
+}
+
+// buySubscription Оплата подписки по тарифу: создает платеж и возвращает ссылку на страницу оплаты.
+// Подписка начислится, когда провайдер сообщит об успешной оплате.
+func (h *Handler) buySubscription(c *gin.Context) {
+	userId, err := getUserID(c)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	var input rest.SubscriptionPurchaseInput
+	if err := c.BindJSON(&input); err != nil {
+		handleError(c, rest.NewInvalidRequestError(err))
+		return
+	}
+
+	payment, err := h.services.CreateSubscriptionCheckout(userId, input.PlanCode, input.AutoRenew)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, payment)
+}
+
+// buySubscriptionWithCoins Покупка или продление подписки за монеты
+func (h *Handler) buySubscriptionWithCoins(c *gin.Context) {
+	userId, err := getUserID(c)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	var input rest.SubscriptionPurchaseInput
+	if err := c.BindJSON(&input); err != nil {
+		handleError(c, rest.NewInvalidRequestError(err))
+		return
+	}
+
+	subscription, err := h.services.BuySubscriptionWithCoins(userId, input.PlanCode)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, subscription)
+}
+
+// startTrial Пробный период, один раз на аккаунт
+func (h *Handler) startTrial(c *gin.Context) {
+	userId, err := getUserID(c)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	subscription, err := h.services.StartTrial(userId)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, subscription)
+}
+
+// cancelSubscription Отмена подписки, доступ остается до конца оплаченного срока
+func (h *Handler) cancelSubscription(c *gin.Context) {
+	userId, err := getUserID(c)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	subscription, err := h.services.CancelSubscription(userId)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, subscription)
+}
+
+// setAutoRenew Включение и отключение автопродления подписки
+func (h *Handler) setAutoRenew(c *gin.Context) {
+	userId, err := getUserID(c)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	var input rest.AutoRenewInput
+	if err := c.BindJSON(&input); err != nil {
+		handleError(c, rest.NewInvalidRequestError(err))
+		return
+	}
+
+	if err := h.services.SetAutoRenew(userId, *input.AutoRenew); err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -10,6 +10,15 @@ import (
 	"github.com/google/uuid"
 )
 
+const (
+	// Размер аватара без подписки
+	maxIconSize = 1 << 20
+	// Размер аватара с возможностью bigAvatar
+	maxBigIconSize = 8 << 20
+	// Запас на имя и заголовки multipart-формы сверх файла
+	maxIconFormOverhead = 64 << 10
+)
+
 // getUserID извлекает ID пользователя из контекста.
 // Это вспомогательная функция, чтобы не дублировать код в каждом обработчике.
 func getUserID(c *gin.Context) (int, error) {
@@ -54,6 +63,16 @@ func (h *Handler) setNameIcon(c *gin.Context) {
 		return
 	}
 
+	// Не даем прочитать тело больше самого большого аватара, пока форма не разобрана
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBigIconSize+maxIconFormOverhead)
+	if _, err := c.MultipartForm(); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			handleError(c, rest.ErrImgTooLarge)
+			return
+		}
+	}
+
 	// 1. Получаем имя из поля формы
 	// c.PostForm() извлечет значение поля "name" из multipart-формы
 	newName := c.PostForm("name")
@@ -74,6 +93,18 @@ func (h *Handler) setNameIcon(c *gin.Context) {
 
 	// Если err == nil, значит файл был прислан.
 	if err == nil {
+		// Большой аватар доступен только по подписке
+		if file.Size > maxBigIconSize {
+			handleError(c, rest.ErrImgTooLarge)
+			return
+		}
+		if file.Size > maxIconSize {
+			if err := h.services.RequireEntitlement(userId, rest.PerkBigAvatar); err != nil {
+				handleError(c, err)
+				return
+			}
+		}
+
 		// Генерируем уникальное имя файла
 		ext := filepath.Ext(file.Filename)
 		uniqueFilename := uuid.New().String() + ext
@@ -86,7 +117,7 @@ func (h *Handler) setNameIcon(c *gin.Context) {
 		}
 		// Формируем URL для сохранения в БД
 		iconUrl = "/static/icons/" + uniqueFilename
-	} else if errors.Is(err, http.ErrMissingFile) {
+	} else if !errors.Is(err, http.ErrMissingFile) {
 		// Если ошибка - это НЕ "файл отсутствует", значит произошла другая проблема.
 		handleError(c, rest.NewInternalServerError(err))
 		return
@@ -104,7 +135,29 @@ func (h *Handler) setNameIcon(c *gin.Context) {
 	})
 }
 
-// dayCoin Получить n монеток
+// setTimezone Смена часового пояса, от него считается день ежедневной награды
+func (h *Handler) setTimezone(c *gin.Context) {
+	userId, err := getUserID(c)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	var input rest.TimezoneInput
+	if err := c.BindJSON(&input); err != nil {
+		handleError(c, rest.NewInvalidRequestError(err))
+		return
+	}
+
+	if err := h.services.SetTimezone(userId, input.Timezone); err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, input)
+}
+
+// dayCoin Получить ежедневную награду, в ответе новый баланс и время следующей награды
 func (h *Handler) dayCoin(c *gin.Context) {
 	userId, err := getUserID(c)
 	if err != nil {
@@ -112,13 +165,45 @@ func (h *Handler) dayCoin(c *gin.Context) {
 		return
 	}
 
-	if err = h.services.GetGrantDailyReward(userId); err != nil {
+	claim, err := h.services.GetGrantDailyReward(userId)
+	if err != nil {
 		handleError(c, err)
 		return
 	}
 
-	c.JSON(http.StatusConflict, gin.H{})
+	c.JSON(http.StatusOK, claim)
 }
 
-// setCoin пока что так, но надо система с генерацией ключей чтобы не обманывать систему
-// func (h *Handler) setCoin(c *gin.Context) {}
+// getDayCoin Текущая серия ежедневных наград, следующая награда и время до смены дня
+func (h *Handler) getDayCoin(c *gin.Context) {
+	userId, err := getUserID(c)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	status, err := h.services.GetDailyRewardStatus(userId)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, status)
+}
+
+// getEntitlements Возможности текущей подписки пользователя
+func (h *Handler) getEntitlements(c *gin.Context) {
+	userId, err := getUserID(c)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	entitlements, err := h.services.GetEntitlements(userId)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, entitlements)
+}
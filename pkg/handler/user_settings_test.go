@@ -0,0 +1,34 @@
+package handler
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestSetNameIconRejectsOversizedBody(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	h := &Handler{}
+	router := gin.New()
+	router.PUT("/icon", func(c *gin.Context) { c.Set(userCtx, 1) }, h.setNameIcon)
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	_ = form.WriteField("name", "player")
+	icon, _ := form.CreateFormFile("icon", "icon.png")
+	_, _ = icon.Write(make([]byte, maxBigIconSize+maxIconFormOverhead))
+	_ = form.Close()
+
+	req := httptest.NewRequest(http.MethodPut, "/icon", &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusRequestEntityTooLarge)
+	}
+}
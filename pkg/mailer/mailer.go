@@ -0,0 +1,76 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Mailer отправляет письма пользователям.
+type Mailer interface {
+	Send(ctx context.Context, to, subject, body string) error
+}
+
+// SMTPConfig настройки почтового сервера.
+type SMTPConfig struct {
+	// Пустой host - письма только пишутся в лог
+	Host     string `mapstructure:"host"`
+	Port     int    `mapstructure:"port"`
+	Username string `mapstructure:"username"`
+	// Пароль берется из окружения
+	Password string `mapstructure:"-"`
+	From     string `mapstructure:"from"`
+}
+
+// New выбирает отправку через SMTP или в лог, если сервер не настроен.
+func New(cfg SMTPConfig) Mailer {
+	if cfg.Host == "" {
+		logrus.Warn("smtp is not configured, emails will be written to log")
+		return LogMailer{}
+	}
+	return &SMTPMailer{cfg: cfg}
+}
+
+// SMTPMailer отправка через SMTP с авторизацией PLAIN.
+type SMTPMailer struct {
+	cfg SMTPConfig
+}
+
+func (m *SMTPMailer) Send(ctx context.Context, to, subject, body string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	var auth smtp.Auth
+	if m.cfg.Username != "" {
+		auth = smtp.PlainAuth("", m.cfg.Username, m.cfg.Password, m.cfg.Host)
+	}
+	addr := net.JoinHostPort(m.cfg.Host, strconv.Itoa(m.cfg.Port))
+	return smtp.SendMail(addr, auth, m.cfg.From, []string{to}, message(m.cfg.From, to, subject, body))
+}
+
+func message(from, to, subject, body string) []byte {
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "From: %s\r\n", from)
+	fmt.Fprintf(&msg, "To: %s\r\n", to)
+	// Тема может быть на русском, в заголовке допустим только ASCII
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	msg.WriteString(body)
+	return []byte(msg.String())
+}
+
+// LogMailer пишет письма в лог, для разработки.
+type LogMailer struct{}
+
+func (LogMailer) Send(_ context.Context, to, subject, body string) error {
+	logrus.WithField("to", to).Infof("email %q: %s", subject, body)
+	return nil
+}
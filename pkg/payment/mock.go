@@ -0,0 +1,187 @@
+package payment
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// Имя встроенного тестового провайдера
+	MockProviderName = "mock"
+
+	// Заголовок с подписью уведомления: "t=<unix time>,v1=<hex HMAC-SHA256>"
+	mockSignatureHeader = "X-Mockpay-Signature"
+	// Насколько старое уведомление еще принимаем, защита от повторной отправки перехваченного
+	mockSignatureTolerance = 5 * time.Minute
+
+	mockRequestTimeout = 10 * time.Second
+)
+
+// MockConfig настройки тестового провайдера.
+type MockConfig struct {
+	// Адрес сервера cmd/mockpay
+	URL string `mapstructure:"url"`
+	// Общий секрет для API и подписи уведомлений, берется из окружения
+	Secret string `mapstructure:"-"`
+}
+
+// mockWebhook тело уведомления тестового провайдера.
+type mockWebhook struct {
+	ID        string `json:"id"`
+	PaymentID string `json:"paymentId"`
+	Reference string `json:"reference"`
+	Status    string `json:"status"`
+}
+
+// mockCheckout запрос и ответ API создания оплаты.
+type mockCheckout struct {
+	ID          string `json:"id,omitempty"`
+	URL         string `json:"url,omitempty"`
+	Status      string `json:"status,omitempty"`
+	Reference   string `json:"reference"`
+	Amount      int    `json:"amount"`
+	Currency    string `json:"currency"`
+	Description string `json:"description"`
+	// Прошлый платеж, способ оплаты которого используется при списании
+	PaymentMethod string `json:"paymentMethod,omitempty"`
+}
+
+// MockProvider клиент тестового провайдера, который запускается локально (cmd/mockpay).
+// Позволяет пройти весь путь оплаты без настоящей платежной системы.
+type MockProvider struct {
+	cfg    MockConfig
+	client *http.Client
+}
+
+func NewMockProvider(cfg MockConfig) *MockProvider {
+	return &MockProvider{
+		cfg:    cfg,
+		client: &http.Client{Timeout: mockRequestTimeout},
+	}
+}
+
+func (p *MockProvider) Name() string {
+	return MockProviderName
+}
+
+func (p *MockProvider) CreateCheckout(ctx context.Context, request CheckoutRequest) (CheckoutSession, error) {
+	var checkout mockCheckout
+	err := p.call(ctx, http.MethodPost, "/v1/checkout", mockCheckout{
+		Reference:   request.PaymentID,
+		Amount:      request.Amount,
+		Currency:    request.Currency,
+		Description: request.Description,
+	}, &checkout)
+	if err != nil {
+		return CheckoutSession{}, err
+	}
+	return CheckoutSession{ExternalID: checkout.ID, URL: checkout.URL}, nil
+}
+
+func (p *MockProvider) Charge(ctx context.Context, request ChargeRequest) (ChargeResult, error) {
+	var checkout mockCheckout
+	err := p.call(ctx, http.MethodPost, "/v1/charges", mockCheckout{
+		Reference:     request.PaymentID,
+		Amount:        request.Amount,
+		Currency:      request.Currency,
+		Description:   request.Description,
+		PaymentMethod: request.PaymentMethod,
+	}, &checkout)
+	if err != nil {
+		return ChargeResult{}, err
+	}
+	return ChargeResult{ExternalID: checkout.ID, Status: checkout.Status}, nil
+}
+
+func (p *MockProvider) GetPaymentStatus(ctx context.Context, externalId string) (string, error) {
+	var checkout mockCheckout
+	err := p.call(ctx, http.MethodGet, "/v1/payments/"+externalId, nil, &checkout)
+	return checkout.Status, err
+}
+
+func (p *MockProvider) VerifyWebhook(header http.Header, body []byte) (WebhookEvent, error) {
+	if !verifyMockSignature(p.cfg.Secret, header.Get(mockSignatureHeader), body, time.Now()) {
+		return WebhookEvent{}, ErrInvalidSignature
+	}
+
+	var webhook mockWebhook
+	if err := json.Unmarshal(body, &webhook); err != nil {
+		return WebhookEvent{}, err
+	}
+	return WebhookEvent{
+		ExternalID: webhook.PaymentID,
+		PaymentID:  webhook.Reference,
+		Status:     webhook.Status,
+	}, nil
+}
+
+// call выполняет запрос к API тестового провайдера.
+func (p *MockProvider) call(ctx context.Context, method, path string, in, out interface{}) error {
+	var body bytes.Buffer
+	if in != nil {
+		if err := json.NewEncoder(&body).Encode(in); err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(p.cfg.URL, "/")+path, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+p.cfg.Secret)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("mockpay: %s %s: status %d", method, path, resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// signMock подписывает тело уведомления, подпись покрывает и время отправки.
+func signMock(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10) + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func mockSignature(secret string, body []byte, now time.Time) string {
+	timestamp := now.Unix()
+	return fmt.Sprintf("t=%d,v1=%s", timestamp, signMock(secret, timestamp, body))
+}
+
+func verifyMockSignature(secret, header string, body []byte, now time.Time) bool {
+	if secret == "" {
+		return false
+	}
+	var timestamp int64
+	var signature string
+	for _, part := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch key {
+		case "t":
+			timestamp, _ = strconv.ParseInt(value, 10, 64)
+		case "v1":
+			signature = value
+		}
+	}
+	sent := time.Unix(timestamp, 0)
+	if timestamp == 0 || now.Sub(sent).Abs() > mockSignatureTolerance {
+		return false
+	}
+	return hmac.Equal([]byte(signature), []byte(signMock(secret, timestamp, body)))
+}
@@ -0,0 +1,240 @@
+package payment
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ArtemChadaev/go"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// Сколько раз тестовый провайдер пытается доставить уведомление
+	mockWebhookAttempts = 5
+	mockWebhookBackoff  = 2 * time.Second
+)
+
+// MockServerConfig настройки локального тестового провайдера.
+type MockServerConfig struct {
+	// Адрес, по которому пользователь откроет страницу оплаты
+	PublicURL string
+	// Куда отправлять уведомления, например http://localhost:8080/webhooks/payments/mock
+	WebhookURL string
+	Secret     string
+	// Отклонять все списания сохраненным способом оплаты, чтобы проверить неудачное автопродление
+	DeclineCharges bool
+}
+
+// MockServer - локальная платежная система для разработки. Хранит платежи в памяти,
+// показывает страницу оплаты с кнопками "Оплатить" и "Отклонить" и шлет подписанные уведомления.
+type MockServer struct {
+	cfg    MockServerConfig
+	client *http.Client
+
+	mu       sync.Mutex
+	payments map[string]*mockCheckout
+}
+
+func NewMockServer(cfg MockServerConfig) *MockServer {
+	return &MockServer{
+		cfg:      cfg,
+		client:   &http.Client{Timeout: mockRequestTimeout},
+		payments: make(map[string]*mockCheckout),
+	}
+}
+
+func (s *MockServer) Handler() http.Handler {
+	mux := http.NewServeMux()
+	// API для сервиса
+	mux.HandleFunc("POST /v1/checkout", s.authorized(s.createCheckout))
+	mux.HandleFunc("POST /v1/charges", s.authorized(s.charge))
+	mux.HandleFunc("GET /v1/payments/{id}", s.authorized(s.getPayment))
+	mux.HandleFunc("POST /v1/payments/{id}/refund", s.authorized(s.refund))
+	// Страница оплаты для пользователя
+	mux.HandleFunc("GET /checkout/{id}", s.checkoutPage)
+	mux.HandleFunc("POST /checkout/{id}/pay", s.complete(rest.PaymentStatusSucceeded))
+	mux.HandleFunc("POST /checkout/{id}/decline", s.complete(rest.PaymentStatusFailed))
+	return mux
+}
+
+func (s *MockServer) authorized(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(s.cfg.Secret)) != 1 {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
+
+func (s *MockServer) createCheckout(w http.ResponseWriter, r *http.Request) {
+	var checkout mockCheckout
+	if err := json.NewDecoder(r.Body).Decode(&checkout); err != nil || checkout.Amount <= 0 {
+		http.Error(w, "invalid checkout", http.StatusBadRequest)
+		return
+	}
+	checkout.ID = uuid.New().String()
+	checkout.URL = strings.TrimSuffix(s.cfg.PublicURL, "/") + "/checkout/" + checkout.ID
+	checkout.Status = rest.PaymentStatusPending
+
+	s.mu.Lock()
+	s.payments[checkout.ID] = &checkout
+	s.mu.Unlock()
+
+	writeJSON(w, checkout)
+}
+
+// charge списание без страницы оплаты: проходит, если прошлый платеж был успешным.
+func (s *MockServer) charge(w http.ResponseWriter, r *http.Request) {
+	var checkout mockCheckout
+	if err := json.NewDecoder(r.Body).Decode(&checkout); err != nil || checkout.Amount <= 0 {
+		http.Error(w, "invalid charge", http.StatusBadRequest)
+		return
+	}
+	checkout.ID = uuid.New().String()
+	checkout.Status = rest.PaymentStatusFailed
+	if method, ok := s.get(checkout.PaymentMethod); ok && method.Status == rest.PaymentStatusSucceeded && !s.cfg.DeclineCharges {
+		checkout.Status = rest.PaymentStatusSucceeded
+	}
+
+	s.mu.Lock()
+	s.payments[checkout.ID] = &checkout
+	s.mu.Unlock()
+
+	go s.sendWebhook(checkout)
+	writeJSON(w, checkout)
+}
+
+func (s *MockServer) getPayment(w http.ResponseWriter, r *http.Request) {
+	checkout, ok := s.get(r.PathValue("id"))
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	writeJSON(w, checkout)
+}
+
+func (s *MockServer) refund(w http.ResponseWriter, r *http.Request) {
+	checkout, ok := s.setStatus(r.PathValue("id"), rest.PaymentStatusSucceeded, rest.PaymentStatusRefunded)
+	if !ok {
+		http.Error(w, "payment can't be refunded", http.StatusConflict)
+		return
+	}
+	go s.sendWebhook(checkout)
+	writeJSON(w, checkout)
+}
+
+var checkoutTemplate = template.Must(template.New("checkout").Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>Mockpay</title></head>
+<body style="font-family: sans-serif; max-width: 420px; margin: 40px auto">
+<h2>Тестовая оплата</h2>
+<p>{{.Description}}</p>
+<p><b>{{.Price}} {{.Currency}}</b></p>
+{{if eq .Status "pending"}}
+<form method="post" action="/checkout/{{.ID}}/pay" style="display:inline"><button>Оплатить</button></form>
+<form method="post" action="/checkout/{{.ID}}/decline" style="display:inline"><button>Отклонить</button></form>
+{{else}}
+<p>Статус: {{.Status}}</p>
+{{end}}
+</body></html>`))
+
+func (s *MockServer) checkoutPage(w http.ResponseWriter, r *http.Request) {
+	checkout, ok := s.get(r.PathValue("id"))
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	data := struct {
+		mockCheckout
+		Price string
+	}{checkout, formatPrice(checkout.Amount)}
+	if err := checkoutTemplate.Execute(w, data); err != nil {
+		logrus.Errorf("mockpay: can't render checkout: %v", err)
+	}
+}
+
+// complete - действие пользователя на странице оплаты.
+func (s *MockServer) complete(status string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("id")
+		checkout, ok := s.setStatus(id, rest.PaymentStatusPending, status)
+		if !ok {
+			http.Error(w, "payment is already completed", http.StatusConflict)
+			return
+		}
+		go s.sendWebhook(checkout)
+		http.Redirect(w, r, "/checkout/"+id, http.StatusSeeOther)
+	}
+}
+
+func (s *MockServer) get(id string) (mockCheckout, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	checkout, ok := s.payments[id]
+	if !ok {
+		return mockCheckout{}, false
+	}
+	return *checkout, true
+}
+
+func (s *MockServer) setStatus(id, from, to string) (mockCheckout, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	checkout, ok := s.payments[id]
+	if !ok || checkout.Status != from {
+		return mockCheckout{}, false
+	}
+	checkout.Status = to
+	return *checkout, true
+}
+
+// sendWebhook доставляет уведомление с повторами, как это делают настоящие провайдеры.
+func (s *MockServer) sendWebhook(checkout mockCheckout) {
+	body, _ := json.Marshal(mockWebhook{
+		ID:        uuid.New().String(),
+		PaymentID: checkout.ID,
+		Reference: checkout.Reference,
+		Status:    checkout.Status,
+	})
+
+	for attempt := 1; attempt <= mockWebhookAttempts; attempt++ {
+		req, err := http.NewRequest(http.MethodPost, s.cfg.WebhookURL, bytes.NewReader(body))
+		if err != nil {
+			logrus.Errorf("mockpay: invalid webhook url: %v", err)
+			return
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(mockSignatureHeader, mockSignature(s.cfg.Secret, body, time.Now()))
+
+		resp, err := s.client.Do(req)
+		if err == nil {
+			_ = resp.Body.Close()
+			if resp.StatusCode < 300 {
+				logrus.Infof("mockpay: webhook %s for payment %s delivered", checkout.Status, checkout.ID)
+				return
+			}
+			err = fmt.Errorf("unexpected status %d", resp.StatusCode)
+		}
+		logrus.Warnf("mockpay: webhook attempt %d for payment %s failed: %v", attempt, checkout.ID, err)
+		time.Sleep(mockWebhookBackoff * time.Duration(attempt))
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// formatPrice копейки в рубли: 29900 -> "299.00".
+func formatPrice(amount int) string {
+	return fmt.Sprintf("%d.%02d", amount/100, amount%100)
+}
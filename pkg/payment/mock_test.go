@@ -0,0 +1,56 @@
+package payment
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestVerifyMockSignature(t *testing.T) {
+	const secret = "secret"
+	body := []byte(`{"id":"evt_1","reference":"pay_1","status":"succeeded"}`)
+	now := time.Unix(1700000000, 0)
+	valid := mockSignature(secret, body, now)
+
+	tests := []struct {
+		name   string
+		secret string
+		header string
+		body   []byte
+		want   bool
+	}{
+		{"valid", secret, valid, body, true},
+		{"spaces after comma", secret, fmt.Sprintf("t=%d, v1=%s", now.Unix(), signMock(secret, now.Unix(), body)), body, true},
+		{"tampered body", secret, valid, []byte(`{"id":"evt_1","reference":"pay_1","status":"refunded"}`), false},
+		{"wrong secret", "other", valid, body, false},
+		{"empty secret", "", mockSignature("", body, now), body, false},
+		{"missing t", secret, "v1=" + signMock(secret, 0, body), body, false},
+		{"zero t", secret, "t=0,v1=" + signMock(secret, 0, body), body, false},
+		{"missing signature", secret, fmt.Sprintf("t=%d", now.Unix()), body, false},
+		{"signature for other time", secret, fmt.Sprintf("t=%d,v1=%s", now.Unix(), signMock(secret, now.Unix()-1, body)), body, false},
+		{"too old", secret, mockSignature(secret, body, now.Add(-mockSignatureTolerance-time.Second)), body, false},
+		{"too far in future", secret, mockSignature(secret, body, now.Add(mockSignatureTolerance+time.Second)), body, false},
+		{"old within tolerance", secret, mockSignature(secret, body, now.Add(-mockSignatureTolerance)), body, true},
+		{"empty header", secret, "", body, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := verifyMockSignature(tt.secret, tt.header, tt.body, now); got != tt.want {
+				t.Errorf("verifyMockSignature(%q) = %v, want %v", tt.header, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSignMock(t *testing.T) {
+	body := []byte("{}")
+	if signMock("secret", 1, body) == signMock("secret", 2, body) {
+		t.Error("signature does not cover the timestamp")
+	}
+	if signMock("secret", 1, body) == signMock("other", 1, body) {
+		t.Error("signature does not depend on the secret")
+	}
+	if signMock("secret", 1, body) != signMock("secret", 1, []byte("{}")) {
+		t.Error("signature is not deterministic")
+	}
+}
@@ -0,0 +1,35 @@
+package payment
+
+import (
+	"testing"
+
+	"github.com/ArtemChadaev/go"
+)
+
+func TestCanTransitionPayment(t *testing.T) {
+	tests := []struct {
+		from, to string
+		want     bool
+	}{
+		{rest.PaymentStatusPending, rest.PaymentStatusSucceeded, true},
+		{rest.PaymentStatusPending, rest.PaymentStatusFailed, true},
+		{rest.PaymentStatusSucceeded, rest.PaymentStatusRefunded, true},
+
+		{rest.PaymentStatusPending, rest.PaymentStatusPending, false},
+		{rest.PaymentStatusPending, rest.PaymentStatusRefunded, false},
+		{rest.PaymentStatusSucceeded, rest.PaymentStatusPending, false},
+		{rest.PaymentStatusSucceeded, rest.PaymentStatusFailed, false},
+		{rest.PaymentStatusSucceeded, rest.PaymentStatusSucceeded, false},
+		{rest.PaymentStatusFailed, rest.PaymentStatusSucceeded, false},
+		{rest.PaymentStatusFailed, rest.PaymentStatusPending, false},
+		{rest.PaymentStatusRefunded, rest.PaymentStatusSucceeded, false},
+		{rest.PaymentStatusRefunded, rest.PaymentStatusPending, false},
+		{"", rest.PaymentStatusSucceeded, false},
+		{rest.PaymentStatusPending, "unknown", false},
+	}
+	for _, tt := range tests {
+		if got := rest.CanTransitionPayment(tt.from, tt.to); got != tt.want {
+			t.Errorf("CanTransitionPayment(%q, %q) = %v, want %v", tt.from, tt.to, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"net/http"
+)
+
+// ErrInvalidSignature подпись уведомления провайдера не прошла проверку.
+var ErrInvalidSignature = errors.New("invalid webhook signature")
+
+// CheckoutRequest что нужно оплатить.
+type CheckoutRequest struct {
+	// Наш ID платежа, провайдер вернет его в уведомлении
+	PaymentID   string
+	Amount      int
+	Currency    string
+	Description string
+}
+
+// CheckoutSession страница оплаты у провайдера.
+type CheckoutSession struct {
+	ExternalID string
+	URL        string
+}
+
+// ChargeRequest повторное списание без участия пользователя, например автопродление подписки.
+type ChargeRequest struct {
+	PaymentID   string
+	Amount      int
+	Currency    string
+	Description string
+	// ID прошлого успешного платежа у провайдера, с которого берется сохраненный способ оплаты
+	PaymentMethod string
+}
+
+// ChargeResult платеж, созданный списанием. Итоговый статус может прийти позже уведомлением.
+type ChargeResult struct {
+	ExternalID string
+	Status     string
+}
+
+// WebhookEvent уведомление провайдера об изменении статуса платежа.
+type WebhookEvent struct {
+	ExternalID string
+	PaymentID  string
+	// Один из rest.PaymentStatus*
+	Status string
+}
+
+// Provider платежный провайдер.
+type Provider interface {
+	// Name имя провайдера в URL уведомлений и в таблице payments
+	Name() string
+	// CreateCheckout создает страницу оплаты
+	CreateCheckout(ctx context.Context, request CheckoutRequest) (CheckoutSession, error)
+	// Charge списывает деньги сохраненным способом оплаты
+	Charge(ctx context.Context, request ChargeRequest) (ChargeResult, error)
+	// VerifyWebhook проверяет подпись уведомления и разбирает его
+	VerifyWebhook(header http.Header, body []byte) (WebhookEvent, error)
+	// GetPaymentStatus запрашивает текущий статус платежа, если уведомление потерялось
+	GetPaymentStatus(ctx context.Context, externalId string) (string, error)
+}
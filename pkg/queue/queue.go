@@ -0,0 +1,177 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+// Ключи Redis очереди
+const (
+	// Список ID задач, готовых к выполнению
+	readyKey = "tasks:ready"
+	// ZSET ID отложенных задач и повторов, score - когда выполнить
+	delayedKey = "tasks:delayed"
+	// ZSET ID выполняемых задач, score - когда истекает таймаут видимости
+	processingKey = "tasks:processing"
+	// Список задач, исчерпавших попытки
+	deadKey = "tasks:dead"
+	// Сама задача в JSON
+	taskKeyPrefix = "tasks:task:"
+
+	// Сколько последних задач хранится в списке недоставленных
+	deadLetterSize = 1000
+	// Сколько отложенных и зависших задач возвращается в очередь за раз
+	promoteBatch = 100
+)
+
+// Метрики: processed, retried, dead.
+var queueTasks = expvar.NewMap("queue_tasks")
+
+// Config секция queue из конфига.
+type Config struct {
+	// Сколько задач выполняется одновременно
+	Workers int `mapstructure:"workers"`
+	// Выполнять задачи в процессе API, а не только в cmd/worker
+	InProcess bool `mapstructure:"inProcess"`
+	// Задача, не завершенная за это время, считается потерянной и выдается снова
+	VisibilityTimeout time.Duration `mapstructure:"visibilityTimeout"`
+	// Сколько раз повторять упавшую задачу по умолчанию
+	MaxRetries int `mapstructure:"maxRetries"`
+	// Пауза перед первым повтором, дальше удваивается, но не больше MaxBackoff
+	Backoff    time.Duration `mapstructure:"backoff"`
+	MaxBackoff time.Duration `mapstructure:"maxBackoff"`
+	// Как часто проверяем очередь, когда она пуста
+	PollInterval time.Duration `mapstructure:"pollInterval"`
+}
+
+// Task задача в очереди.
+type Task struct {
+	ID         string          `json:"id"`
+	Type       string          `json:"type"`
+	Payload    json.RawMessage `json:"payload"`
+	Attempts   int             `json:"attempts"`
+	MaxRetries int             `json:"maxRetries"`
+	LastError  string          `json:"lastError,omitempty"`
+	CreatedAt  time.Time       `json:"createdAt"`
+	// Когда задача попала в список недоставленных
+	FailedAt *time.Time `json:"failedAt,omitempty"`
+}
+
+// Options параметры постановки задачи.
+type Options struct {
+	// Выполнить не раньше чем через Delay
+	Delay time.Duration
+	// 0 - значение из конфига
+	MaxRetries int
+}
+
+// Handler выполняет задачу. Задача может выполниться больше одного раза, поэтому обработчик должен быть идемпотентным.
+type Handler func(ctx context.Context, payload []byte) error
+
+// Queue надежная очередь задач в Redis: задача удаляется только после успешного выполнения,
+// упавшая повторяется с экспоненциальной паузой, а после всех попыток попадает в список недоставленных.
+type Queue struct {
+	redis    *redis.Client
+	cfg      Config
+	handlers map[string]Handler
+}
+
+func New(redis *redis.Client, cfg Config) (*Queue, error) {
+	// Без обработчиков задачи копились бы в Redis и не выполнялись
+	if cfg.Workers <= 0 {
+		return nil, errors.New("queue workers must be positive")
+	}
+	if cfg.MaxRetries < 0 {
+		return nil, errors.New("queue maxRetries must not be negative")
+	}
+	if cfg.VisibilityTimeout <= 0 || cfg.Backoff <= 0 || cfg.MaxBackoff < cfg.Backoff || cfg.PollInterval <= 0 {
+		return nil, errors.New("queue visibilityTimeout, backoff, maxBackoff and pollInterval must be positive")
+	}
+
+	return &Queue{
+		redis:    redis,
+		cfg:      cfg,
+		handlers: make(map[string]Handler),
+	}, nil
+}
+
+// Handle регистрирует обработчик задач типа taskType. Вызывается до Run.
+func (q *Queue) Handle(taskType string, handler Handler) {
+	q.handlers[taskType] = handler
+}
+
+// InProcess выполнять ли задачи в процессе API.
+func (q *Queue) InProcess() bool {
+	return q.cfg.InProcess
+}
+
+// Enqueue ставит задачу в очередь. payload сохраняется в JSON.
+func (q *Queue) Enqueue(ctx context.Context, taskType string, payload any, opts Options) (string, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+	if opts.MaxRetries <= 0 {
+		opts.MaxRetries = q.cfg.MaxRetries
+	}
+
+	task := Task{
+		ID:         uuid.NewString(),
+		Type:       taskType,
+		Payload:    data,
+		MaxRetries: opts.MaxRetries,
+		CreatedAt:  time.Now(),
+	}
+	data, err = json.Marshal(task)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = q.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, taskKeyPrefix+task.ID, data, 0)
+		if opts.Delay > 0 {
+			pipe.ZAdd(ctx, delayedKey, redis.Z{Score: float64(time.Now().Add(opts.Delay).UnixMilli()), Member: task.ID})
+		} else {
+			pipe.LPush(ctx, readyKey, task.ID)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("can't enqueue %s task: %w", taskType, err)
+	}
+	return task.ID, nil
+}
+
+// DeadLetters последние задачи, исчерпавшие попытки, новые сначала.
+func (q *Queue) DeadLetters(ctx context.Context, limit int) ([]Task, error) {
+	items, err := q.redis.LRange(ctx, deadKey, 0, int64(limit)-1).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	tasks := make([]Task, 0, len(items))
+	for _, item := range items {
+		var task Task
+		if err := json.Unmarshal([]byte(item), &task); err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, task)
+	}
+	return tasks, nil
+}
+
+// backoff пауза перед повтором после attempt-й неудачной попытки.
+func (q *Queue) backoff(attempt int) time.Duration {
+	delay := q.cfg.Backoff
+	for i := 1; i < attempt && delay < q.cfg.MaxBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, q.cfg.MaxBackoff)
+}
@@ -0,0 +1,314 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+var testConfig = Config{
+	Workers:           1,
+	VisibilityTimeout: time.Minute,
+	MaxRetries:        1,
+	Backoff:           time.Second,
+	MaxBackoff:        5 * time.Second,
+	PollInterval:      10 * time.Millisecond,
+}
+
+func newTestQueue(t *testing.T, cfg Config) (*miniredis.Miniredis, *Queue) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+
+	q, err := New(client, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return mr, q
+}
+
+func enqueue(t *testing.T, q *Queue, opts Options) string {
+	t.Helper()
+	id, err := q.Enqueue(context.Background(), "test", map[string]int{"n": 1}, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+func claim(t *testing.T, q *Queue) (Task, bool) {
+	t.Helper()
+	task, ok, err := q.claim(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return task, ok
+}
+
+// makeDue сдвигает срок задачи в ZSET в прошлое, как будто время ожидания прошло.
+func makeDue(t *testing.T, mr *miniredis.Miniredis, key, id string) {
+	t.Helper()
+	if _, err := mr.ZScore(key, id); err != nil {
+		t.Fatalf("task %s is not in %s", id, key)
+	}
+	if _, err := mr.ZAdd(key, float64(time.Now().Add(-time.Second).UnixMilli()), id); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func deadLetters(t *testing.T, q *Queue) []Task {
+	t.Helper()
+	tasks, err := q.DeadLetters(context.Background(), deadLetterSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tasks
+}
+
+func TestNewRejectsInvalidConfig(t *testing.T) {
+	tests := map[string]func(cfg *Config){
+		"no workers":        func(cfg *Config) { cfg.Workers = 0 },
+		"negative workers":  func(cfg *Config) { cfg.Workers = -1 },
+		"negative retries":  func(cfg *Config) { cfg.MaxRetries = -1 },
+		"no visibility":     func(cfg *Config) { cfg.VisibilityTimeout = 0 },
+		"no backoff":        func(cfg *Config) { cfg.Backoff = 0 },
+		"max below backoff": func(cfg *Config) { cfg.MaxBackoff = cfg.Backoff / 2 },
+		"no poll interval":  func(cfg *Config) { cfg.PollInterval = 0 },
+	}
+	for name, change := range tests {
+		cfg := testConfig
+		change(&cfg)
+		if _, err := New(nil, cfg); err == nil {
+			t.Errorf("%s: New() accepted invalid config", name)
+		}
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	q := &Queue{cfg: testConfig}
+	want := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}
+	for i, w := range want {
+		if got := q.backoff(i + 1); got != w {
+			t.Errorf("backoff(%d) = %v, want %v", i+1, got, w)
+		}
+	}
+}
+
+func TestClaimAndAck(t *testing.T) {
+	mr, q := newTestQueue(t, testConfig)
+	var got []byte
+	q.Handle("test", func(ctx context.Context, payload []byte) error {
+		got = payload
+		return nil
+	})
+	id := enqueue(t, q, Options{})
+
+	task, ok := claim(t, q)
+	if !ok || task.ID != id || task.Attempts != 1 || task.MaxRetries != testConfig.MaxRetries {
+		t.Fatalf("claim() = %+v, %v, want task %s on first attempt", task, ok, id)
+	}
+	if _, ok := claim(t, q); ok {
+		t.Fatal("task was claimed twice")
+	}
+
+	q.process(context.Background(), task)
+	if string(got) != `{"n":1}` {
+		t.Errorf("handler got payload %s", got)
+	}
+	if mr.Exists(taskKeyPrefix+id) || mr.Exists(processingKey) {
+		t.Error("acked task is still stored")
+	}
+}
+
+func TestDelayedTask(t *testing.T) {
+	mr, q := newTestQueue(t, testConfig)
+	id := enqueue(t, q, Options{Delay: time.Hour})
+
+	if _, ok := claim(t, q); ok {
+		t.Fatal("delayed task was claimed before its time")
+	}
+	makeDue(t, mr, delayedKey, id)
+	if task, ok := claim(t, q); !ok || task.ID != id {
+		t.Fatalf("claim() = %+v, %v, want due delayed task %s", task, ok, id)
+	}
+}
+
+func TestRetryThenBury(t *testing.T) {
+	mr, q := newTestQueue(t, testConfig)
+	q.Handle("test", func(ctx context.Context, payload []byte) error {
+		return errors.New("boom")
+	})
+	id := enqueue(t, q, Options{})
+
+	task, _ := claim(t, q)
+	before := time.Now().Truncate(time.Millisecond)
+	q.process(context.Background(), task)
+
+	score, err := mr.ZScore(delayedKey, id)
+	if err != nil {
+		t.Fatal("failed task was not scheduled for retry")
+	}
+	if retryAt := time.UnixMilli(int64(score)); retryAt.Before(before.Add(testConfig.Backoff)) {
+		t.Errorf("retry scheduled at %v, want at least %v later", retryAt, testConfig.Backoff)
+	}
+	var stored Task
+	data, _ := mr.Get(taskKeyPrefix + id)
+	if err := json.Unmarshal([]byte(data), &stored); err != nil || stored.LastError != "boom" || stored.Attempts != 1 {
+		t.Errorf("stored task = %+v, %v, want last error after one attempt", stored, err)
+	}
+
+	// Последняя попытка тоже падает
+	makeDue(t, mr, delayedKey, id)
+	task, _ = claim(t, q)
+	q.process(context.Background(), task)
+
+	dead := deadLetters(t, q)
+	if len(dead) != 1 || dead[0].ID != id || dead[0].Attempts != 2 || dead[0].LastError != "boom" || dead[0].FailedAt == nil {
+		t.Fatalf("dead letters = %+v, want task %s after 2 attempts", dead, id)
+	}
+	if mr.Exists(taskKeyPrefix+id) || mr.Exists(processingKey) || mr.Exists(delayedKey) {
+		t.Error("buried task is still queued")
+	}
+}
+
+func TestPanicAndUnknownTypeFail(t *testing.T) {
+	cfg := testConfig
+	cfg.MaxRetries = 0
+	_, q := newTestQueue(t, cfg)
+	q.Handle("test", func(ctx context.Context, payload []byte) error {
+		panic("handler bug")
+	})
+	enqueue(t, q, Options{})
+	if _, err := q.Enqueue(context.Background(), "unknown", nil, Options{}); err != nil {
+		t.Fatal(err)
+	}
+
+	for range 2 {
+		task, ok := claim(t, q)
+		if !ok {
+			t.Fatal("task was not claimed")
+		}
+		q.process(context.Background(), task)
+	}
+
+	dead := deadLetters(t, q)
+	if len(dead) != 2 {
+		t.Fatalf("dead letters = %+v, want both tasks", dead)
+	}
+	reasons := map[string]string{}
+	for _, task := range dead {
+		reasons[task.Type] = task.LastError
+	}
+	if reasons["test"] != "panic: handler bug" || reasons["unknown"] != "no handler for task type unknown" {
+		t.Errorf("dead letter reasons = %v", reasons)
+	}
+}
+
+func TestVisibilityTimeout(t *testing.T) {
+	mr, q := newTestQueue(t, testConfig)
+	id := enqueue(t, q, Options{})
+
+	// Обработчик взял задачу и пропал
+	claim(t, q)
+	makeDue(t, mr, processingKey, id)
+	task, ok := claim(t, q)
+	if !ok || task.ID != id || task.Attempts != 2 {
+		t.Fatalf("claim() = %+v, %v, want lost task %s on second attempt", task, ok, id)
+	}
+
+	// Попытки кончились, задача уходит в недоставленные без запуска
+	makeDue(t, mr, processingKey, id)
+	if _, ok := claim(t, q); ok {
+		t.Fatal("task was claimed after exhausting its attempts")
+	}
+	dead := deadLetters(t, q)
+	if len(dead) != 1 || dead[0].ID != id || dead[0].LastError != "visibility timeout expired too many times" {
+		t.Fatalf("dead letters = %+v, want lost task %s", dead, id)
+	}
+}
+
+func TestStaleWorkerCannotFinishTask(t *testing.T) {
+	mr, q := newTestQueue(t, testConfig)
+	q.Handle("test", func(ctx context.Context, payload []byte) error { return nil })
+	id := enqueue(t, q, Options{})
+
+	stale, _ := claim(t, q)
+	makeDue(t, mr, processingKey, id)
+	fresh, _ := claim(t, q)
+
+	// Зависший обработчик очнулся, когда задачу уже выполнил другой: повтор не ставится
+	q.process(context.Background(), fresh)
+	if err := q.fail(context.Background(), stale, errors.New("late")); err != nil {
+		t.Fatal(err)
+	}
+	if mr.Exists(delayedKey) || mr.Exists(taskKeyPrefix+id) {
+		t.Error("stale worker rescheduled a finished task")
+	}
+}
+
+func TestClaimSkipsFinishedTask(t *testing.T) {
+	mr, q := newTestQueue(t, testConfig)
+	// ID в очереди есть, а задачу уже завершил другой обработчик
+	if _, err := mr.Lpush(readyKey, "missing"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := claim(t, q); ok {
+		t.Fatal("claimed a task that no longer exists")
+	}
+	if mr.Exists(processingKey) {
+		t.Error("finished task left in processing")
+	}
+}
+
+func TestDeadLettersAreTrimmed(t *testing.T) {
+	mr, q := newTestQueue(t, testConfig)
+	for i := range deadLetterSize + 5 {
+		task := Task{ID: strconv.Itoa(i), Type: "test"}
+		if _, err := mr.ZAdd(processingKey, 0, task.ID); err != nil {
+			t.Fatal(err)
+		}
+		if err := q.bury(context.Background(), task, "boom"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	dead := deadLetters(t, q)
+	if len(dead) != deadLetterSize || dead[0].ID != strconv.Itoa(deadLetterSize+4) {
+		t.Errorf("dead letters has %d tasks starting with %s, want %d newest first", len(dead), dead[0].ID, deadLetterSize)
+	}
+}
+
+func TestRunProcessesUntilStopped(t *testing.T) {
+	_, q := newTestQueue(t, testConfig)
+	done := make(chan struct{})
+	q.Handle("test", func(ctx context.Context, payload []byte) error {
+		close(done)
+		return nil
+	})
+	enqueue(t, q, Options{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		q.Run(ctx)
+		close(stopped)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("task was not processed")
+	}
+	cancel()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("workers did not stop")
+	}
+}
@@ -0,0 +1,200 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+)
+
+// Забирает следующую задачу: сначала возвращает в очередь отложенные задачи, время которых пришло,
+// и задачи, у которых истек таймаут видимости (обработчик упал или завис), затем выдает одну задачу.
+var claimScript = redis.NewScript(`
+local due = redis.call("ZRANGEBYSCORE", KEYS[2], "-inf", ARGV[1], "LIMIT", 0, ARGV[3])
+for _, id in ipairs(due) do
+	redis.call("ZREM", KEYS[2], id)
+	redis.call("LPUSH", KEYS[1], id)
+end
+local lost = redis.call("ZRANGEBYSCORE", KEYS[3], "-inf", ARGV[1], "LIMIT", 0, ARGV[3])
+for _, id in ipairs(lost) do
+	redis.call("ZREM", KEYS[3], id)
+	redis.call("LPUSH", KEYS[1], id)
+end
+local id = redis.call("RPOP", KEYS[1])
+if not id then
+	return false
+end
+redis.call("ZADD", KEYS[3], ARGV[2], id)
+return id`)
+
+// Завершает задачу, только если она все еще выдана этому обработчику.
+var ackScript = redis.NewScript(`
+if redis.call("ZREM", KEYS[1], ARGV[1]) == 1 then
+	redis.call("DEL", KEYS[2])
+end
+return 0`)
+
+// Откладывает повтор задачи.
+var retryScript = redis.NewScript(`
+if redis.call("ZREM", KEYS[1], ARGV[1]) == 1 then
+	redis.call("SET", KEYS[3], ARGV[2])
+	redis.call("ZADD", KEYS[2], ARGV[3], ARGV[1])
+end
+return 0`)
+
+// Переносит задачу в список недоставленных.
+var buryScript = redis.NewScript(`
+if redis.call("ZREM", KEYS[1], ARGV[1]) == 1 then
+	redis.call("DEL", KEYS[3])
+	redis.call("LPUSH", KEYS[2], ARGV[2])
+	redis.call("LTRIM", KEYS[2], 0, ARGV[3] - 1)
+end
+return 0`)
+
+// Run запускает обработчиков и выполняет задачи, пока не отменен ctx.
+// Начатые задачи дорабатывают до конца, но не дольше таймаута видимости.
+func (q *Queue) Run(ctx context.Context) {
+	logrus.Infof("queue: %d workers started", q.cfg.Workers)
+
+	var wg sync.WaitGroup
+	for range q.cfg.Workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			q.work(ctx)
+		}()
+	}
+	wg.Wait()
+
+	logrus.Info("queue: workers stopped")
+}
+
+func (q *Queue) work(ctx context.Context) {
+	for ctx.Err() == nil {
+		task, ok, err := q.claim(ctx)
+		if err != nil && ctx.Err() == nil {
+			logrus.Errorf("queue: can't claim task: %v", err)
+		}
+		if !ok {
+			select {
+			case <-ctx.Done():
+			case <-time.After(q.cfg.PollInterval):
+			}
+			continue
+		}
+
+		// Остановка сервиса не прерывает задачу, иначе она выполнится заново
+		taskCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), q.cfg.VisibilityTimeout)
+		q.process(taskCtx, task)
+		cancel()
+	}
+}
+
+// claim забирает задачу и засчитывает попытку. Задача, которая уже исчерпала попытки
+// (например, каждый раз роняет обработчика), сразу уходит в недоставленные.
+func (q *Queue) claim(ctx context.Context) (Task, bool, error) {
+	now := time.Now()
+	id, err := claimScript.Run(ctx, q.redis, []string{readyKey, delayedKey, processingKey},
+		now.UnixMilli(), now.Add(q.cfg.VisibilityTimeout).UnixMilli(), promoteBatch).Text()
+	if errors.Is(err, redis.Nil) {
+		return Task{}, false, nil
+	}
+	if err != nil {
+		return Task{}, false, err
+	}
+
+	var task Task
+	data, err := q.redis.Get(ctx, taskKeyPrefix+id).Bytes()
+	if errors.Is(err, redis.Nil) {
+		// Задачу уже завершил обработчик, у которого истек таймаут видимости
+		return task, false, q.redis.ZRem(ctx, processingKey, id).Err()
+	}
+	if err == nil {
+		err = json.Unmarshal(data, &task)
+	}
+	if err != nil {
+		return task, false, err
+	}
+
+	task.Attempts++
+	if task.Attempts > task.MaxRetries+1 {
+		return task, false, q.bury(ctx, task, "visibility timeout expired too many times")
+	}
+	data, err = json.Marshal(task)
+	if err == nil {
+		err = q.redis.Set(ctx, taskKeyPrefix+id, data, 0).Err()
+	}
+	return task, err == nil, err
+}
+
+func (q *Queue) process(ctx context.Context, task Task) {
+	handler, ok := q.handlers[task.Type]
+	if !ok {
+		if err := q.bury(ctx, task, "no handler for task type "+task.Type); err != nil {
+			logrus.Errorf("queue: can't bury task %s: %v", task.ID, err)
+		}
+		return
+	}
+
+	if err := runHandler(ctx, handler, task.Payload); err != nil {
+		if err := q.fail(ctx, task, err); err != nil {
+			logrus.Errorf("queue: can't fail task %s: %v", task.ID, err)
+		}
+		return
+	}
+
+	queueTasks.Add("processed", 1)
+	err := ackScript.Run(ctx, q.redis, []string{processingKey, taskKeyPrefix + task.ID}, task.ID).Err()
+	if err != nil {
+		logrus.Errorf("queue: can't ack task %s: %v", task.ID, err)
+	}
+}
+
+// runHandler выполняет задачу, паника считается ошибкой.
+func runHandler(ctx context.Context, handler Handler, payload []byte) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return handler(ctx, payload)
+}
+
+// fail откладывает повтор задачи или, если попытки кончились, переносит ее в недоставленные.
+func (q *Queue) fail(ctx context.Context, task Task, taskErr error) error {
+	if task.Attempts > task.MaxRetries {
+		return q.bury(ctx, task, taskErr.Error())
+	}
+
+	task.LastError = taskErr.Error()
+	delay := q.backoff(task.Attempts)
+	logrus.Warnf("queue: %s task %s failed (attempt %d), retry in %v: %v", task.Type, task.ID, task.Attempts, delay, taskErr)
+
+	data, err := json.Marshal(task)
+	if err != nil {
+		return err
+	}
+	queueTasks.Add("retried", 1)
+	return retryScript.Run(ctx, q.redis, []string{processingKey, delayedKey, taskKeyPrefix + task.ID},
+		task.ID, data, time.Now().Add(delay).UnixMilli()).Err()
+}
+
+func (q *Queue) bury(ctx context.Context, task Task, reason string) error {
+	now := time.Now()
+	task.LastError = reason
+	task.FailedAt = &now
+	logrus.Errorf("queue: %s task %s moved to dead letters after %d attempts: %s", task.Type, task.ID, task.Attempts, reason)
+
+	data, err := json.Marshal(task)
+	if err != nil {
+		return err
+	}
+	queueTasks.Add("dead", 1)
+	return buryScript.Run(ctx, q.redis, []string{processingKey, deadKey, taskKeyPrefix + task.ID},
+		task.ID, data, deadLetterSize).Err()
+}
@@ -0,0 +1,78 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/ArtemChadaev/go"
+	"github.com/jmoiron/sqlx"
+)
+
+type AchievementRepository struct {
+	db *sqlx.DB
+}
+
+func NewAchievementPostgres(db *sqlx.DB) *AchievementRepository {
+	return &AchievementRepository{db: db}
+}
+
+// ApplyAchievementEvent учитывает событие в статистике пользователя и возвращает всю его статистику.
+// Уже учтенное событие (повторная доставка) счетчики не меняет.
+func (r *AchievementRepository) ApplyAchievementEvent(event rest.Event) ([]rest.AchievementCounter, error) {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	query := "INSERT INTO achievement_processed_events (event_id) VALUES ($1) ON CONFLICT DO NOTHING"
+	res, err := tx.Exec(query, event.ID)
+	if err != nil {
+		return nil, err
+	}
+	if inserted, _ := res.RowsAffected(); inserted > 0 {
+		query = `INSERT INTO achievement_counters (user_id, event, count, total, max_value) VALUES ($1, $2, 1, $3, $3)
+				 ON CONFLICT (user_id, event) DO UPDATE SET
+				 count = achievement_counters.count + 1,
+				 total = achievement_counters.total + EXCLUDED.total,
+				 max_value = GREATEST(achievement_counters.max_value, EXCLUDED.max_value)`
+		if _, err := tx.Exec(query, event.UserID, event.Type, event.Value); err != nil {
+			return nil, err
+		}
+	}
+
+	var counters []rest.AchievementCounter
+	query = "SELECT * FROM achievement_counters WHERE user_id=$1"
+	if err := tx.Select(&counters, query, event.UserID); err != nil {
+		return nil, err
+	}
+
+	return counters, tx.Commit()
+}
+
+// UnlockAchievement отмечает достижение открытым, false - если оно уже было открыто.
+func (r *AchievementRepository) UnlockAchievement(userId int, code string) (bool, error) {
+	query := "INSERT INTO user_achievements (user_id, code) VALUES ($1, $2) ON CONFLICT DO NOTHING"
+	res, err := r.db.Exec(query, userId, code)
+	if err != nil {
+		return false, err
+	}
+	inserted, err := res.RowsAffected()
+	return inserted > 0, err
+}
+
+func (r *AchievementRepository) GetUserAchievements(userId int) ([]rest.UserAchievement, error) {
+	var achievements []rest.UserAchievement
+	query := "SELECT * FROM user_achievements WHERE user_id=$1 ORDER BY unlocked_at"
+	err := r.db.Select(&achievements, query, userId)
+	return achievements, err
+}
+
+// DeleteProcessedEventsBefore удаляет отметки об учтенных событиях старше before и возвращает, сколько удалено.
+func (r *AchievementRepository) DeleteProcessedEventsBefore(before time.Time) (int64, error) {
+	query := "DELETE FROM achievement_processed_events WHERE processed_at < $1"
+	res, err := r.db.Exec(query, before)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -13,14 +13,33 @@ func NewAuthPostgres(db *sqlx.DB) *AuthRepository {
 	return &AuthRepository{db: db}
 }
 
-func (r *AuthRepository) CreateUser(user rest.User) (int, error) {
+// CreateUser одной транзакцией создает пользователя, его начальные настройки и, если он пришел
+// по приглашению, запись о приглашении. Приглашение сверх limits сохраняется отклоненным.
+func (r *AuthRepository) CreateUser(user rest.User, settings rest.UserSettings, referral *rest.Referral, limits ReferralLimits) (int, error) {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
 	var id int
 	query := "INSERT INTO users (email, password_hash) VALUES ($1, $2) RETURNING id"
-	row := r.db.QueryRow(query, user.Email, user.Password)
-	if err := row.Scan(&id); err != nil {
+	if err := tx.QueryRow(query, user.Email, user.Password).Scan(&id); err != nil {
+		return 0, err
+	}
+	query = "INSERT INTO user_settings (user_id, name) VALUES ($1, $2)"
+	if _, err := tx.Exec(query, id, settings.Name); err != nil {
 		return 0, err
 	}
-	return id, nil
+
+	if referral != nil {
+		referral.RefereeID = id
+		if err := createReferral(tx, referral, limits); err != nil {
+			return 0, err
+		}
+	}
+
+	return id, tx.Commit()
 }
 
 func (r *AuthRepository) GetUser(email, password string) (int, error) {
@@ -94,3 +113,10 @@ func (r *AuthRepository) GetRefreshTokens(userId int) ([]rest.RefreshToken, erro
 	err := r.db.Select(&refresh, query, userId)
 	return refresh, err
 }
+
+func (r *AuthRepository) IsAdmin(userId int) (bool, error) {
+	var isAdmin bool
+	query := "SELECT is_admin FROM users WHERE id=$1"
+	err := r.db.Get(&isAdmin, query, userId)
+	return isAdmin, err
+}
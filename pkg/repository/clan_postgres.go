@@ -0,0 +1,333 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/ArtemChadaev/go"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+var (
+	// ErrClanNameTaken клан с таким именем уже есть
+	ErrClanNameTaken = errors.New("clan name taken")
+	// ErrAlreadyInClan пользователь уже состоит в клане
+	ErrAlreadyInClan = errors.New("user already in clan")
+	// ErrClanFull в клане нет мест
+	ErrClanFull = errors.New("clan is full")
+	// ErrClanInviteExists приглашение или заявка для этой пары клан-пользователь уже есть
+	ErrClanInviteExists = errors.New("clan invite exists")
+)
+
+type ClanRepository struct {
+	db *sqlx.DB
+}
+
+func NewClanPostgres(db *sqlx.DB) *ClanRepository {
+	return &ClanRepository{db: db}
+}
+
+// CreateClan создает клан, создатель становится его главой.
+func (r *ClanRepository) CreateClan(clan rest.Clan, leaderId int) (rest.Clan, error) {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return clan, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	query := "INSERT INTO clan (name, description, other) VALUES ($1, $2, $3) RETURNING id"
+	if err := tx.Get(&clan.ID, query, clan.Name, clan.Description, clan.Other); err != nil {
+		return clan, clanConstraintError(err)
+	}
+	query = "INSERT INTO clan_members (clan_id, user_id, role_id) VALUES ($1, $2, $3)"
+	if _, err := tx.Exec(query, clan.ID, leaderId, rest.ClanRoleLeader); err != nil {
+		return clan, clanConstraintError(err)
+	}
+	clan.MembersCount = 1
+
+	return clan, tx.Commit()
+}
+
+// clanConstraintError переводит нарушения уникальности в понятные ошибки.
+func clanConstraintError(err error) error {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) || pqErr.Code != "23505" {
+		return err
+	}
+	switch pqErr.Constraint {
+	case "clan_name_key":
+		return ErrClanNameTaken
+	case "clan_members_user_id_key":
+		return ErrAlreadyInClan
+	case "clan_invites_clan_id_user_id_key":
+		return ErrClanInviteExists
+	}
+	return err
+}
+
+func (r *ClanRepository) GetClan(clanId int) (rest.Clan, error) {
+	var clan rest.Clan
+	query := `SELECT c.id, c.name, c.description, c.other,
+					 (SELECT COUNT(*) FROM clan_members cm WHERE cm.clan_id = c.id) AS members_count
+			  FROM clan c WHERE c.id=$1`
+	err := r.db.Get(&clan, query, clanId)
+	return clan, err
+}
+
+// GetClanMemberRole роль пользователя в клане, sql.ErrNoRows - если он в нем не состоит.
+func (r *ClanRepository) GetClanMemberRole(clanId, userId int) (int, error) {
+	var roleId int
+	query := "SELECT role_id FROM clan_members WHERE clan_id=$1 AND user_id=$2"
+	err := r.db.Get(&roleId, query, clanId, userId)
+	return roleId, err
+}
+
+func (r *ClanRepository) UpdateClan(clan rest.Clan) error {
+	query := "UPDATE clan SET description=$1, other=$2 WHERE id=$3"
+	_, err := r.db.Exec(query, clan.Description, clan.Other, clan.ID)
+	return err
+}
+
+// DeleteClan распускает клан, участники и названия ролей удаляются каскадом.
+func (r *ClanRepository) DeleteClan(clanId int) error {
+	_, err := r.db.Exec("DELETE FROM clan WHERE id=$1", clanId)
+	return err
+}
+
+// GetUserClanRole клан и роль пользователя, sql.ErrNoRows - если он не состоит в клане.
+func (r *ClanRepository) GetUserClanRole(userId int) (clanId, roleId int, err error) {
+	query := "SELECT clan_id, role_id FROM clan_members WHERE user_id=$1"
+	err = r.db.QueryRow(query, userId).Scan(&clanId, &roleId)
+	return clanId, roleId, err
+}
+
+func (r *ClanRepository) GetClanLeaderId(clanId int) (int, error) {
+	var userId int
+	query := "SELECT user_id FROM clan_members WHERE clan_id=$1 AND role_id=$2"
+	err := r.db.Get(&userId, query, clanId, rest.ClanRoleLeader)
+	return userId, err
+}
+
+// GetClanRoles роли клана с названиями, заданными кланом, старшие сначала.
+func (r *ClanRepository) GetClanRoles(clanId int) ([]rest.ClanRole, error) {
+	roles := []rest.ClanRole{}
+	query := `SELECT r.id, COALESCE(n.custom_name, r.name) AS name, r.name AS default_name
+			  FROM roles r LEFT JOIN clan_role_names n ON n.clan_id=$1 AND n.role_id = r.id
+			  ORDER BY r.id`
+	err := r.db.Select(&roles, query, clanId)
+	return roles, err
+}
+
+// UpdateClanRole меняет название и права роли в одной транзакции, nil оставляет поле как есть.
+// Пустое название возвращает стандартное.
+func (r *ClanRepository) UpdateClanRole(clanId, roleId int, name *string, permissions *rest.ClanPermissions) error {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	switch {
+	case name == nil:
+	case *name == "":
+		_, err = tx.Exec("DELETE FROM clan_role_names WHERE clan_id=$1 AND role_id=$2", clanId, roleId)
+	default:
+		query := `INSERT INTO clan_role_names (clan_id, role_id, custom_name) VALUES ($1, $2, $3)
+				  ON CONFLICT (clan_id, role_id) DO UPDATE SET custom_name = EXCLUDED.custom_name`
+		_, err = tx.Exec(query, clanId, roleId, *name)
+	}
+	if err != nil {
+		return err
+	}
+
+	if permissions != nil {
+		query := `INSERT INTO clan_role_permissions
+				  (clan_id, role_id, invite, kick, edit_description, spend_treasury, manage_roles)
+				  VALUES ($1, $2, $3, $4, $5, $6, $7)
+				  ON CONFLICT (clan_id, role_id) DO UPDATE
+				  SET invite = EXCLUDED.invite, kick = EXCLUDED.kick,
+					  edit_description = EXCLUDED.edit_description, spend_treasury = EXCLUDED.spend_treasury,
+					  manage_roles = EXCLUDED.manage_roles`
+		_, err = tx.Exec(query, clanId, roleId, permissions.Invite, permissions.Kick,
+			permissions.EditDescription, permissions.SpendTreasury, permissions.ManageRoles)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// GetClanRolePermissions права ролей, настроенные кланом. Ролей с правами по умолчанию в ответе нет.
+func (r *ClanRepository) GetClanRolePermissions(clanId int) (map[int]rest.ClanPermissions, error) {
+	var rows []struct {
+		RoleID int `db:"role_id"`
+		rest.ClanPermissions
+	}
+	query := `SELECT role_id, invite, kick, edit_description, spend_treasury, manage_roles
+			  FROM clan_role_permissions WHERE clan_id=$1`
+	if err := r.db.Select(&rows, query, clanId); err != nil {
+		return nil, err
+	}
+
+	permissions := make(map[int]rest.ClanPermissions, len(rows))
+	for _, row := range rows {
+		permissions[row.RoleID] = row.ClanPermissions
+	}
+	return permissions, nil
+}
+
+// GetClanMembers участники клана, старшие роли сначала.
+func (r *ClanRepository) GetClanMembers(clanId int) ([]rest.ClanMember, error) {
+	members := []rest.ClanMember{}
+	query := `SELECT cm.clan_id, cm.user_id, us.name, us.icon, cm.role_id,
+					 COALESCE(n.custom_name, r.name) AS role_name, cm.joined_at
+			  FROM clan_members cm
+			  JOIN user_settings us ON us.user_id = cm.user_id
+			  JOIN roles r ON r.id = cm.role_id
+			  LEFT JOIN clan_role_names n ON n.clan_id = cm.clan_id AND n.role_id = cm.role_id
+			  WHERE cm.clan_id=$1 ORDER BY cm.role_id, cm.joined_at`
+	err := r.db.Select(&members, query, clanId)
+	return members, err
+}
+
+// RemoveClanMember исключает участника, если его роль все еще role. Иначе sql.ErrNoRows:
+// роль успела измениться, и проверку прав нужно повторить.
+func (r *ClanRepository) RemoveClanMember(clanId, userId, role int) error {
+	query := "DELETE FROM clan_members WHERE clan_id=$1 AND user_id=$2 AND role_id=$3"
+	result, err := r.db.Exec(query, clanId, userId, role)
+	if err != nil {
+		return err
+	}
+	return expectOneRow(result)
+}
+
+// SetClanMemberRole меняет роль участника с from на to, sql.ErrNoRows - если роль уже другая.
+func (r *ClanRepository) SetClanMemberRole(clanId, userId, from, to int) error {
+	query := "UPDATE clan_members SET role_id=$1 WHERE clan_id=$2 AND user_id=$3 AND role_id=$4"
+	result, err := r.db.Exec(query, to, clanId, userId, from)
+	if err != nil {
+		return err
+	}
+	return expectOneRow(result)
+}
+
+// TransferClanLeadership делает заместителя главой, а прежний глава получает вторую роль.
+func (r *ClanRepository) TransferClanLeadership(clanId, leaderId, userId int) error {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	query := "UPDATE clan_members SET role_id=$1 WHERE clan_id=$2 AND user_id=$3 AND role_id=$4"
+	result, err := tx.Exec(query, rest.ClanRoleLeader+1, clanId, leaderId, rest.ClanRoleLeader)
+	if err != nil {
+		return err
+	}
+	if err := expectOneRow(result); err != nil {
+		return err
+	}
+	// Главой становится только тот, кто все еще заместитель: его могли понизить или исключить
+	query = "UPDATE clan_members SET role_id=$1 WHERE clan_id=$2 AND user_id=$3 AND role_id=$4"
+	result, err = tx.Exec(query, rest.ClanRoleLeader, clanId, userId, rest.ClanRoleLeader+1)
+	if err != nil {
+		return err
+	}
+	if err := expectOneRow(result); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func expectOneRow(result sql.Result) error {
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (r *ClanRepository) CreateClanInvite(invite rest.ClanInvite) (rest.ClanInvite, error) {
+	query := `INSERT INTO clan_invites (clan_id, user_id, kind, invited_by)
+			  VALUES ($1, $2, $3, $4) RETURNING id, created_at`
+	err := r.db.QueryRow(query, invite.ClanID, invite.UserID, invite.Kind, invite.InvitedBy).
+		Scan(&invite.ID, &invite.CreatedAt)
+	return invite, clanConstraintError(err)
+}
+
+// Приглашения вместе с именами клана и пользователя
+const clanInvitesQuery = `SELECT ci.id, ci.clan_id, c.name AS clan_name, ci.user_id, us.name AS user_name,
+								 ci.kind, ci.invited_by, ci.created_at
+						  FROM clan_invites ci
+						  JOIN clan c ON c.id = ci.clan_id
+						  JOIN user_settings us ON us.user_id = ci.user_id`
+
+func (r *ClanRepository) GetClanInvite(inviteId int) (rest.ClanInvite, error) {
+	var invite rest.ClanInvite
+	err := r.db.Get(&invite, clanInvitesQuery+" WHERE ci.id=$1", inviteId)
+	return invite, err
+}
+
+// GetClanInvites приглашения и заявки клана, новые сначала.
+func (r *ClanRepository) GetClanInvites(clanId int) ([]rest.ClanInvite, error) {
+	invites := []rest.ClanInvite{}
+	err := r.db.Select(&invites, clanInvitesQuery+" WHERE ci.clan_id=$1 ORDER BY ci.id DESC", clanId)
+	return invites, err
+}
+
+// GetUserClanInvites приглашения и заявки пользователя, новые сначала.
+func (r *ClanRepository) GetUserClanInvites(userId int) ([]rest.ClanInvite, error) {
+	invites := []rest.ClanInvite{}
+	err := r.db.Select(&invites, clanInvitesQuery+" WHERE ci.user_id=$1 ORDER BY ci.id DESC", userId)
+	return invites, err
+}
+
+func (r *ClanRepository) DeleteClanInvite(inviteId int) error {
+	_, err := r.db.Exec("DELETE FROM clan_invites WHERE id=$1", inviteId)
+	return err
+}
+
+// AcceptClanInvite принимает приглашение или заявку: пользователь вступает в клан с младшей ролью,
+// если в клане есть место. Остальные его приглашения и заявки удаляются, в клане можно состоять только в одном.
+func (r *ClanRepository) AcceptClanInvite(invite rest.ClanInvite, memberLimit int) error {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	// Блокируем клан, чтобы одновременные вступления не превысили лимит
+	var members int
+	query := `SELECT (SELECT COUNT(*) FROM clan_members WHERE clan_id = c.id)
+			  FROM clan c WHERE c.id=$1 FOR UPDATE`
+	if err := tx.Get(&members, query, invite.ClanID); err != nil {
+		return err
+	}
+	if members >= memberLimit {
+		return ErrClanFull
+	}
+
+	query = "DELETE FROM clan_invites WHERE id=$1"
+	result, err := tx.Exec(query, invite.ID)
+	if err != nil {
+		return err
+	}
+	// Приглашение уже приняли или отклонили
+	if err := expectOneRow(result); err != nil {
+		return err
+	}
+
+	query = "INSERT INTO clan_members (clan_id, user_id, role_id) VALUES ($1, $2, $3)"
+	if _, err := tx.Exec(query, invite.ClanID, invite.UserID, rest.ClanRoleLowest); err != nil {
+		return clanConstraintError(err)
+	}
+	if _, err := tx.Exec("DELETE FROM clan_invites WHERE user_id=$1", invite.UserID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
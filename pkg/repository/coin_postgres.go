@@ -0,0 +1,139 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/ArtemChadaev/go"
+	"github.com/jmoiron/sqlx"
+)
+
+var (
+	// ErrNotEnoughCoins на балансе меньше монет, чем нужно списать
+	ErrNotEnoughCoins = errors.New("not enough coins")
+	// ErrTransferDailyCap перевод превысит дневной лимит отправителя
+	ErrTransferDailyCap = errors.New("transfer daily cap exceeded")
+)
+
+type CoinRepository struct {
+	db *sqlx.DB
+}
+
+func NewCoinPostgres(db *sqlx.DB) *CoinRepository {
+	return &CoinRepository{db: db}
+}
+
+// ChangeCoins атомарно меняет баланс и добавляет запись в журнал.
+func (r *CoinRepository) ChangeCoins(transaction rest.CoinTransaction) (rest.CoinTransaction, error) {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return transaction, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	transaction, err = changeCoinsTx(tx, transaction)
+	if err != nil {
+		return transaction, err
+	}
+
+	return transaction, tx.Commit()
+}
+
+// changeCoinsTx меняет баланс и пишет журнал внутри уже открытой транзакции,
+// чтобы другие репозитории могли менять монеты вместе со своими данными.
+func changeCoinsTx(tx *sqlx.Tx, transaction rest.CoinTransaction) (rest.CoinTransaction, error) {
+	// Проверка и изменение одним запросом, чтобы параллельные запросы не теряли обновления
+	query := "UPDATE user_settings SET coin = coin + $1 WHERE user_id=$2 AND coin + $1 >= 0 RETURNING coin"
+	err := tx.Get(&transaction.BalanceAfter, query, transaction.Amount, transaction.UserID)
+	if errors.Is(err, sql.ErrNoRows) {
+		// Либо пользователя нет, либо не хватает монет
+		var exists bool
+		if err := tx.Get(&exists, "SELECT EXISTS(SELECT 1 FROM user_settings WHERE user_id=$1)", transaction.UserID); err != nil {
+			return transaction, err
+		}
+		if exists {
+			return transaction, ErrNotEnoughCoins
+		}
+		return transaction, sql.ErrNoRows
+	}
+	if err != nil {
+		return transaction, err
+	}
+
+	query = `INSERT INTO coin_transactions (user_id, amount, reason, reference_id, balance_after)
+			 VALUES ($1, $2, $3, $4, $5) RETURNING id, created_at`
+	err = tx.QueryRowx(query, transaction.UserID, transaction.Amount, transaction.Reason,
+		transaction.ReferenceID, transaction.BalanceAfter).Scan(&transaction.ID, &transaction.CreatedAt)
+	return transaction, err
+}
+
+// TransferCoins переводит amount монет от одного пользователя другому, комиссия fee списывается с отправителя.
+// Все в одной транзакции с блокировкой обеих строк, поэтому баланс не уйдет в минус.
+// dailyCap - сколько отправитель может перевести за текущие сутки (UTC), 0 - без ограничений.
+func (r *CoinRepository) TransferCoins(transfer rest.CoinTransfer, dailyCap int) (rest.CoinTransfer, error) {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return transfer, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	// Блокируем строки всегда в одном порядке, чтобы встречные переводы не ловили дедлок
+	var locked []int
+	query := "SELECT user_id FROM user_settings WHERE user_id IN ($1, $2) ORDER BY user_id FOR UPDATE"
+	if err := tx.Select(&locked, query, transfer.FromUser, transfer.ToUser); err != nil {
+		return transfer, err
+	}
+	if len(locked) != 2 {
+		return transfer, sql.ErrNoRows
+	}
+
+	if dailyCap > 0 {
+		var sent int
+		query = `SELECT COALESCE(SUM(-amount), 0) FROM coin_transactions
+				 WHERE user_id=$1 AND reason=$2 AND created_at >= date_trunc('day', NOW() AT TIME ZONE 'UTC') AT TIME ZONE 'UTC'`
+		if err := tx.Get(&sent, query, transfer.FromUser, rest.CoinReasonTransferOut); err != nil {
+			return transfer, err
+		}
+		// Сумма sent+amount могла бы переполниться и пройти проверку
+		if transfer.Amount > dailyCap-sent {
+			return transfer, ErrTransferDailyCap
+		}
+	}
+
+	entries := []rest.CoinTransaction{
+		{UserID: transfer.FromUser, Amount: -transfer.Amount, Reason: rest.CoinReasonTransferOut},
+		{UserID: transfer.FromUser, Amount: -transfer.Fee, Reason: rest.CoinReasonTransferFee},
+		{UserID: transfer.ToUser, Amount: transfer.Amount, Reason: rest.CoinReasonTransferIn},
+	}
+	for _, entry := range entries {
+		if entry.Amount == 0 {
+			continue
+		}
+		entry.ReferenceID = &transfer.ID
+		entry, err = changeCoinsTx(tx, entry)
+		if err != nil {
+			return transfer, err
+		}
+		if entry.UserID == transfer.FromUser {
+			transfer.BalanceAfter = entry.BalanceAfter
+		} else {
+			transfer.ToBalanceAfter = entry.BalanceAfter
+		}
+	}
+
+	return transfer, tx.Commit()
+}
+
+func (r *CoinRepository) GetCoinTransactions(userId, limit, offset int) ([]rest.CoinTransaction, error) {
+	transactions := []rest.CoinTransaction{}
+	query := "SELECT * FROM coin_transactions WHERE user_id=$1 ORDER BY id DESC LIMIT $2 OFFSET $3"
+	err := r.db.Select(&transactions, query, userId, limit, offset)
+	return transactions, err
+}
+
+func (r *CoinRepository) CountCoinTransactions(userId int) (int, error) {
+	var count int
+	query := "SELECT COUNT(*) FROM coin_transactions WHERE user_id=$1"
+	err := r.db.Get(&count, query, userId)
+	return count, err
+}
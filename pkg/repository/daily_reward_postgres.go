@@ -0,0 +1,98 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/ArtemChadaev/go"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// ErrDailyRewardClaimed награда за этот день уже получена (или серия изменилась параллельным запросом)
+var ErrDailyRewardClaimed = errors.New("daily reward already claimed")
+
+type DailyRewardRepository struct {
+	db *sqlx.DB
+}
+
+func NewDailyRewardPostgres(db *sqlx.DB) *DailyRewardRepository {
+	return &DailyRewardRepository{db: db}
+}
+
+// GetDailyRewardStreak возвращает серию, если наград еще не было - пустую.
+func (r *DailyRewardRepository) GetDailyRewardStreak(userId int) (rest.DailyRewardStreak, error) {
+	streak := rest.DailyRewardStreak{UserID: userId}
+	query := "SELECT * FROM daily_reward_streaks WHERE user_id=$1"
+	err := r.db.Get(&streak, query, userId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return streak, nil
+	}
+	return streak, err
+}
+
+// ClaimDailyReward в одной транзакции записывает получение награды, обновляет серию и выдает награду.
+// prevClaimDate - последний день получения, по которому сервис посчитал новую серию:
+// если серию успел изменить параллельный запрос, вернется ErrDailyRewardClaimed.
+func (r *DailyRewardRepository) ClaimDailyReward(claim rest.DailyRewardClaim, streak rest.DailyRewardStreak, prevClaimDate *time.Time) (rest.DailyRewardClaim, error) {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return claim, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	query := `INSERT INTO daily_reward_claims (user_id, claim_date, streak_day, coins, subscription_days)
+			  VALUES ($1, $2, $3, $4, $5) RETURNING id, claimed_at`
+	err = tx.QueryRowx(query, claim.UserID, claim.ClaimDate, claim.StreakDay, claim.Coins, claim.SubscriptionDays).
+		Scan(&claim.ID, &claim.ClaimedAt)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		return claim, ErrDailyRewardClaimed
+	}
+	if err != nil {
+		return claim, err
+	}
+
+	query = `INSERT INTO daily_reward_streaks (user_id, current_streak, longest_streak, last_claim_date, last_freeze_date)
+			 VALUES ($1, $2, $3, $4, $5)
+			 ON CONFLICT (user_id) DO UPDATE SET current_streak=$2, longest_streak=$3, last_claim_date=$4,
+			     last_freeze_date=$5, updated_at=NOW()
+			 WHERE daily_reward_streaks.last_claim_date IS NOT DISTINCT FROM $6`
+	res, err := tx.Exec(query, streak.UserID, streak.CurrentStreak, streak.LongestStreak,
+		streak.LastClaimDate, streak.LastFreezeDate, prevClaimDate)
+	if err != nil {
+		return claim, err
+	}
+	if updated, err := res.RowsAffected(); err != nil {
+		return claim, err
+	} else if updated == 0 {
+		return claim, ErrDailyRewardClaimed
+	}
+
+	date := claim.ClaimDate.Format("2006-01-02")
+	if claim.Coins > 0 {
+		transaction, err := changeCoinsTx(tx, rest.CoinTransaction{
+			UserID:      claim.UserID,
+			Amount:      claim.Coins,
+			Reason:      rest.CoinReasonDailyReward,
+			ReferenceID: &date,
+		})
+		if err != nil {
+			return claim, err
+		}
+		claim.Balance = transaction.BalanceAfter
+	} else if err := tx.Get(&claim.Balance, "SELECT coin FROM user_settings WHERE user_id=$1", claim.UserID); err != nil {
+		return claim, err
+	}
+
+	if claim.SubscriptionDays > 0 {
+		until, err := grantSubscriptionDays(tx, claim.UserID, claim.SubscriptionDays, &date)
+		if err != nil {
+			return claim, err
+		}
+		claim.SubscriptionUntil = &until
+	}
+
+	return claim, tx.Commit()
+}
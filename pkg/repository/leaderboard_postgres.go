@@ -0,0 +1,68 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/ArtemChadaev/go"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+type LeaderboardRepository struct {
+	db *sqlx.DB
+}
+
+func NewLeaderboardPostgres(db *sqlx.DB) *LeaderboardRepository {
+	return &LeaderboardRepository{db: db}
+}
+
+// GetUserClanId клан пользователя, 0 - если он не состоит в клане.
+func (r *LeaderboardRepository) GetUserClanId(userId int) (int, error) {
+	var clanId int
+	query := "SELECT clan_id FROM clan_members WHERE user_id=$1 LIMIT 1"
+	err := r.db.Get(&clanId, query, userId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	return clanId, err
+}
+
+// GetBalanceScores текущие балансы всех пользователей для пересчета рейтинга.
+func (r *LeaderboardRepository) GetBalanceScores() ([]rest.LeaderboardScore, error) {
+	var scores []rest.LeaderboardScore
+	query := `SELECT us.user_id, cm.clan_id, us.coin AS score
+			  FROM user_settings us LEFT JOIN clan_members cm ON cm.user_id = us.user_id`
+	err := r.db.Select(&scores, query)
+	return scores, err
+}
+
+// GetEarnedScores сколько монет заработал каждый пользователь начиная с since.
+// Записи журнала с причинами excludeReasons (например, полученные переводы) не считаются заработком.
+func (r *LeaderboardRepository) GetEarnedScores(since time.Time, excludeReasons []string) ([]rest.LeaderboardScore, error) {
+	var scores []rest.LeaderboardScore
+	query := `SELECT ct.user_id, cm.clan_id, SUM(ct.amount) AS score
+			  FROM coin_transactions ct LEFT JOIN clan_members cm ON cm.user_id = ct.user_id
+			  WHERE ct.amount > 0 AND ct.created_at >= $1 AND NOT (ct.reason = ANY($2))
+			  GROUP BY ct.user_id, cm.clan_id`
+	err := r.db.Select(&scores, query, since, pq.Array(excludeReasons))
+	return scores, err
+}
+
+func (r *LeaderboardRepository) HasLeaderboardArchive(week, board string) (bool, error) {
+	var exists bool
+	query := "SELECT EXISTS(SELECT 1 FROM leaderboard_archives WHERE week=$1 AND board=$2)"
+	err := r.db.Get(&exists, query, week, board)
+	return exists, err
+}
+
+func (r *LeaderboardRepository) SaveLeaderboardArchive(entries []rest.LeaderboardArchiveEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	query := `INSERT INTO leaderboard_archives (week, board, rank, user_id, score)
+			  VALUES (:week, :board, :rank, :user_id, :score) ON CONFLICT DO NOTHING`
+	_, err := r.db.NamedExec(query, entries)
+	return err
+}
@@ -0,0 +1,69 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/ArtemChadaev/go"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+type NotificationRepository struct {
+	db *sqlx.DB
+}
+
+func NewNotificationPostgres(db *sqlx.DB) *NotificationRepository {
+	return &NotificationRepository{db: db}
+}
+
+// CreateNotification сохраняет уведомление. Если уведомление с тем же ключом уже есть, возвращает false.
+func (r *NotificationRepository) CreateNotification(notification rest.Notification) (rest.Notification, bool, error) {
+	query := `INSERT INTO notifications (user_id, type, title, body, dedup_key)
+			  VALUES ($1, $2, $3, $4, $5)
+			  ON CONFLICT (user_id, dedup_key) DO NOTHING
+			  RETURNING id, created_at`
+	err := r.db.QueryRow(query, notification.UserID, notification.Type, notification.Title, notification.Body,
+		notification.DedupKey).Scan(&notification.ID, &notification.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return notification, false, nil
+	}
+	return notification, err == nil, err
+}
+
+func (r *NotificationRepository) MarkNotificationEmailed(notificationId int64) error {
+	_, err := r.db.Exec("UPDATE notifications SET email_sent_at=NOW() WHERE id=$1", notificationId)
+	return err
+}
+
+func (r *NotificationRepository) GetNotifications(userId, limit, offset int) ([]rest.Notification, error) {
+	notifications := []rest.Notification{}
+	query := "SELECT * FROM notifications WHERE user_id=$1 ORDER BY id DESC LIMIT $2 OFFSET $3"
+	err := r.db.Select(&notifications, query, userId, limit, offset)
+	return notifications, err
+}
+
+func (r *NotificationRepository) CountNotifications(userId int) (total, unread int, err error) {
+	query := "SELECT COUNT(*), COUNT(*) FILTER (WHERE read_at IS NULL) FROM notifications WHERE user_id=$1"
+	err = r.db.QueryRow(query, userId).Scan(&total, &unread)
+	return total, unread, err
+}
+
+// MarkNotificationsRead отмечает уведомления прочитанными, пустой ids - все.
+func (r *NotificationRepository) MarkNotificationsRead(userId int, ids []int64) error {
+	query := `UPDATE notifications SET read_at=NOW()
+			  WHERE user_id=$1 AND read_at IS NULL AND (cardinality($2::bigint[]) = 0 OR id = ANY($2))`
+	_, err := r.db.Exec(query, userId, pq.Array(ids))
+	return err
+}
+
+// GetExpiringSubscriptions подписки без автопродления, которые закончатся в ближайшие within.
+func (r *NotificationRepository) GetExpiringSubscriptions(within time.Duration) ([]rest.SubscriptionExpiry, error) {
+	expiring := []rest.SubscriptionExpiry{}
+	query := `SELECT user_id, date_of_paid_subscription AS ends_at FROM user_settings
+			  WHERE paid_subscription AND NOT auto_renew
+				AND date_of_paid_subscription > NOW() AND date_of_paid_subscription <= NOW() + make_interval(secs => $1)`
+	err := r.db.Select(&expiring, query, within.Seconds())
+	return expiring, err
+}
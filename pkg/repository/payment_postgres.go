@@ -0,0 +1,192 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/ArtemChadaev/go"
+	"github.com/jmoiron/sqlx"
+)
+
+// ErrInvalidPaymentTransition платеж не может перейти в запрошенный статус.
+var ErrInvalidPaymentTransition = errors.New("invalid payment status transition")
+
+type PaymentRepository struct {
+	db *sqlx.DB
+}
+
+func NewPaymentPostgres(db *sqlx.DB) *PaymentRepository {
+	return &PaymentRepository{db: db}
+}
+
+func (r *PaymentRepository) CreatePayment(payment rest.Payment) (rest.Payment, error) {
+	query := `INSERT INTO payments (id, user_id, provider, kind, plan_id, coins, amount, currency, status, renewal, auto_renew)
+			  VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11) RETURNING created_at, updated_at`
+	err := r.db.QueryRow(query, payment.ID, payment.UserID, payment.Provider, payment.Kind, payment.PlanID,
+		payment.Coins, payment.Amount, payment.Currency, payment.Status, payment.Renewal, payment.AutoRenew).
+		Scan(&payment.CreatedAt, &payment.UpdatedAt)
+	return payment, err
+}
+
+// ClaimSubscriptionRenewal создает платеж автопродления за срок payment.RenewalPeriod.
+// Если платеж для этой попытки уже создал другой запуск задачи, возвращает false: списывать второй раз нельзя.
+func (r *PaymentRepository) ClaimSubscriptionRenewal(payment rest.Payment) (rest.Payment, bool, error) {
+	query := `INSERT INTO payments (id, user_id, provider, kind, plan_id, amount, currency, status, renewal,
+									renewal_period, renewal_attempt)
+			  VALUES ($1, $2, $3, $4, $5, $6, $7, $8, true, $9, $10)
+			  ON CONFLICT (user_id, renewal_period, renewal_attempt) WHERE renewal DO NOTHING
+			  RETURNING created_at, updated_at`
+	err := r.db.QueryRow(query, payment.ID, payment.UserID, payment.Provider, payment.Kind, payment.PlanID,
+		payment.Amount, payment.Currency, payment.Status, payment.RenewalPeriod, payment.RenewalAttempt).
+		Scan(&payment.CreatedAt, &payment.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return payment, false, nil
+	}
+	payment.Renewal = true
+	return payment, err == nil, err
+}
+
+// SetPaymentCheckout сохраняет страницу оплаты, созданную провайдером.
+// У списаний автопродления страницы нет, тогда checkoutURL пустой.
+func (r *PaymentRepository) SetPaymentCheckout(paymentId, externalId, checkoutURL string) error {
+	query := "UPDATE payments SET external_id=$1, checkout_url=NULLIF($2, '') WHERE id=$3"
+	_, err := r.db.Exec(query, externalId, checkoutURL, paymentId)
+	return err
+}
+
+func (r *PaymentRepository) GetPayment(paymentId string) (rest.Payment, error) {
+	var payment rest.Payment
+	query := "SELECT * FROM payments WHERE id=$1"
+	err := r.db.Get(&payment, query, paymentId)
+	return payment, err
+}
+
+// UpdatePaymentStatus переводит платеж в новый статус и в той же транзакции применяет последствия:
+// успешная оплата выдает подписку или монеты, возврат их забирает.
+// Повтор уже примененного статуса ничего не меняет, поэтому повторные уведомления безопасны.
+func (r *PaymentRepository) UpdatePaymentStatus(paymentId, status string) (rest.Payment, bool, error) {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return rest.Payment{}, false, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var payment rest.Payment
+	if err := tx.Get(&payment, "SELECT * FROM payments WHERE id=$1 FOR UPDATE", paymentId); err != nil {
+		return payment, false, err
+	}
+	if payment.Status == status {
+		return payment, false, nil
+	}
+	if !rest.CanTransitionPayment(payment.Status, status) {
+		return payment, false, ErrInvalidPaymentTransition
+	}
+
+	switch {
+	case status == rest.PaymentStatusSucceeded && payment.Kind == rest.PaymentKindSubscription:
+		err = r.grantPaidSubscription(tx, &payment)
+	case status == rest.PaymentStatusSucceeded && payment.Kind == rest.PaymentKindCoins:
+		err = r.creditPaidCoins(tx, &payment)
+	case status == rest.PaymentStatusRefunded && payment.Kind == rest.PaymentKindSubscription:
+		err = r.revokePaidSubscription(tx, &payment)
+	case status == rest.PaymentStatusRefunded && payment.Kind == rest.PaymentKindCoins:
+		err = r.revokePaidCoins(tx, &payment)
+	}
+	if err != nil {
+		return payment, false, err
+	}
+
+	query := "UPDATE payments SET status=$1 WHERE id=$2 RETURNING updated_at"
+	if err := tx.Get(&payment.UpdatedAt, query, status, payment.ID); err != nil {
+		return payment, false, err
+	}
+	payment.Status = status
+
+	return payment, true, tx.Commit()
+}
+
+func (r *PaymentRepository) grantPaidSubscription(tx *sqlx.Tx, payment *rest.Payment) error {
+	var plan rest.SubscriptionPlan
+	if err := tx.Get(&plan, "SELECT * FROM subscription_plans WHERE id=$1", *payment.PlanID); err != nil {
+		return err
+	}
+	subscription, err := purchaseSubscriptionTx(tx, payment.UserID, plan, payment.ID)
+	payment.Subscription = &subscription
+	if err != nil {
+		return err
+	}
+
+	// Автопродление включается, только если пользователь выбрал его при покупке.
+	// Платеж автопродления настройку не трогает
+	if !payment.AutoRenew {
+		return nil
+	}
+	_, err = tx.Exec("UPDATE user_settings SET auto_renew=true WHERE user_id=$1", payment.UserID)
+	return err
+}
+
+// revokePaidSubscription при возврате денег сокращает подписку на срок купленного тарифа.
+func (r *PaymentRepository) revokePaidSubscription(tx *sqlx.Tx, payment *rest.Payment) error {
+	var days int
+	if err := tx.Get(&days, "SELECT duration_days FROM subscription_plans WHERE id=$1", *payment.PlanID); err != nil {
+		return err
+	}
+
+	subscription := rest.Subscription{
+		UserID:      payment.UserID,
+		PlanID:      payment.PlanID,
+		Action:      rest.SubscriptionActionRefund,
+		Days:        -days,
+		ReferenceID: &payment.ID,
+	}
+	query := `UPDATE user_settings
+			  SET date_of_paid_subscription = date_of_paid_subscription - make_interval(days => $1),
+				  paid_subscription = date_of_paid_subscription - make_interval(days => $1) > NOW()
+			  WHERE user_id=$2 AND date_of_paid_subscription IS NOT NULL
+			  RETURNING date_of_paid_subscription`
+	var until sql.NullTime
+	err := tx.Get(&until, query, days, payment.UserID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	if until.Valid {
+		subscription.EndsAt = &until.Time
+	}
+
+	recorded, err := recordSubscription(tx, subscription)
+	payment.Subscription = &recorded
+	return err
+}
+
+func (r *PaymentRepository) creditPaidCoins(tx *sqlx.Tx, payment *rest.Payment) error {
+	transaction, err := changeCoinsTx(tx, rest.CoinTransaction{
+		UserID:      payment.UserID,
+		Amount:      *payment.Coins,
+		Reason:      rest.CoinReasonPurchase,
+		ReferenceID: &payment.ID,
+	})
+	payment.Transaction = &transaction
+	return err
+}
+
+// revokePaidCoins при возврате денег забирает купленные монеты, но не больше текущего баланса:
+// потраченное уже не вернуть, а баланс не может уйти в минус.
+func (r *PaymentRepository) revokePaidCoins(tx *sqlx.Tx, payment *rest.Payment) error {
+	var balance int
+	if err := tx.Get(&balance, "SELECT coin FROM user_settings WHERE user_id=$1 FOR UPDATE", payment.UserID); err != nil {
+		return err
+	}
+	amount := min(*payment.Coins, balance)
+	if amount <= 0 {
+		return nil
+	}
+
+	transaction, err := changeCoinsTx(tx, rest.CoinTransaction{
+		UserID:      payment.UserID,
+		Amount:      -amount,
+		Reason:      rest.CoinReasonRefund,
+		ReferenceID: &payment.ID,
+	})
+	payment.Transaction = &transaction
+	return err
+}
@@ -0,0 +1,143 @@
+package repository
+
+import (
+	"errors"
+	"time"
+
+	"github.com/ArtemChadaev/go"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+var (
+	// ErrRedeemCodeExpired срок действия кода истек
+	ErrRedeemCodeExpired = errors.New("redeem code expired")
+	// ErrRedeemCodeExhausted код активирован максимальное число раз
+	ErrRedeemCodeExhausted = errors.New("redeem code exhausted")
+	// ErrRedeemCodeAlreadyUsed пользователь уже получал награду из этой партии
+	ErrRedeemCodeAlreadyUsed = errors.New("redeem code already used")
+)
+
+type RedeemRepository struct {
+	db *sqlx.DB
+}
+
+func NewRedeemPostgres(db *sqlx.DB) *RedeemRepository {
+	return &RedeemRepository{db: db}
+}
+
+// CreateRedeemBatch сохраняет партию вместе со всеми кодами.
+func (r *RedeemRepository) CreateRedeemBatch(batch rest.RedeemBatch, codes []string) (rest.RedeemBatch, error) {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return batch, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	query := `INSERT INTO redeem_batches (name, reward_type, reward_amount, max_uses, expires_at, created_by)
+			  VALUES ($1, $2, $3, $4, $5, $6) RETURNING id, created_at`
+	err = tx.QueryRowx(query, batch.Name, batch.RewardType, batch.RewardAmount, batch.MaxUses,
+		batch.ExpiresAt, batch.CreatedBy).Scan(&batch.ID, &batch.CreatedAt)
+	if err != nil {
+		return batch, err
+	}
+
+	// Коды вставляются одним запросом из массива
+	query = "INSERT INTO redeem_codes (batch_id, code) SELECT $1, unnest($2::text[])"
+	if _, err := tx.Exec(query, batch.ID, pq.Array(codes)); err != nil {
+		return batch, err
+	}
+
+	batch.Codes = make([]rest.RedeemCode, 0, len(codes))
+	for _, code := range codes {
+		batch.Codes = append(batch.Codes, rest.RedeemCode{BatchID: batch.ID, Code: code})
+	}
+	return batch, tx.Commit()
+}
+
+func (r *RedeemRepository) GetRedeemBatch(batchId int) (rest.RedeemBatch, error) {
+	var batch rest.RedeemBatch
+	query := "SELECT * FROM redeem_batches WHERE id=$1"
+	if err := r.db.Get(&batch, query, batchId); err != nil {
+		return batch, err
+	}
+
+	query = "SELECT * FROM redeem_codes WHERE batch_id=$1 ORDER BY id"
+	err := r.db.Select(&batch.Codes, query, batchId)
+	return batch, err
+}
+
+// RedeemCode активирует код и сразу выдает награду в той же транзакции.
+func (r *RedeemRepository) RedeemCode(userId int, code string) (rest.RedeemResult, error) {
+	var result rest.RedeemResult
+
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return result, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var redeem struct {
+		rest.RedeemCode
+		Batch rest.RedeemBatch `db:"batch"`
+	}
+	query := `SELECT c.id, c.batch_id, c.code, c.uses,
+				     b.id AS "batch.id", b.name AS "batch.name", b.reward_type AS "batch.reward_type",
+				     b.reward_amount AS "batch.reward_amount", b.max_uses AS "batch.max_uses",
+				     b.expires_at AS "batch.expires_at", b.created_by AS "batch.created_by",
+				     b.created_at AS "batch.created_at"
+			  FROM redeem_codes c JOIN redeem_batches b ON b.id = c.batch_id
+			  WHERE c.code=$1 FOR UPDATE OF c`
+	if err := tx.Get(&redeem, query, code); err != nil {
+		return result, err
+	}
+
+	if redeem.Batch.ExpiresAt != nil && redeem.Batch.ExpiresAt.Before(time.Now()) {
+		return result, ErrRedeemCodeExpired
+	}
+	if redeem.Uses >= redeem.Batch.MaxUses {
+		return result, ErrRedeemCodeExhausted
+	}
+
+	query = `INSERT INTO redeem_code_uses (batch_id, code_id, user_id) VALUES ($1, $2, $3)
+			 ON CONFLICT DO NOTHING`
+	res, err := tx.Exec(query, redeem.BatchID, redeem.ID, userId)
+	if err != nil {
+		return result, err
+	}
+	if inserted, err := res.RowsAffected(); err != nil {
+		return result, err
+	} else if inserted == 0 {
+		return result, ErrRedeemCodeAlreadyUsed
+	}
+
+	if _, err := tx.Exec("UPDATE redeem_codes SET uses = uses + 1 WHERE id=$1", redeem.ID); err != nil {
+		return result, err
+	}
+
+	result.RewardType = redeem.Batch.RewardType
+	result.RewardAmount = redeem.Batch.RewardAmount
+	switch redeem.Batch.RewardType {
+	case rest.RedeemRewardCoins:
+		transaction, err := changeCoinsTx(tx, rest.CoinTransaction{
+			UserID:      userId,
+			Amount:      redeem.Batch.RewardAmount,
+			Reason:      rest.CoinReasonRedeemCode,
+			ReferenceID: &redeem.Code,
+		})
+		if err != nil {
+			return result, err
+		}
+		result.Balance = &transaction.BalanceAfter
+	case rest.RedeemRewardSubscriptionDays:
+		until, err := grantSubscriptionDays(tx, userId, redeem.Batch.RewardAmount, &redeem.Code)
+		if err != nil {
+			return result, err
+		}
+		result.SubscriptionUntil = &until
+	default:
+		return result, errors.New("unknown redeem reward type: " + redeem.Batch.RewardType)
+	}
+
+	return result, tx.Commit()
+}
@@ -25,3 +25,12 @@ func NewRedisClient(cfg RedisConfig) (*redis.Client, error) {
 
 	return rdb, nil
 }
+
+// WithCircuitBreaker отдельный клиент к тому же Redis, запросы которого при недоступности Redis
+// сразу падают с ErrCircuitOpen. Нужен только там, где есть запасной вариант без Redis,
+// как у лимитера запросов: остальные пользователи Redis не должны отказывать из-за него.
+func WithCircuitBreaker(rdb *redis.Client) *redis.Client {
+	client := redis.NewClient(rdb.Options())
+	client.AddHook(NewCircuitBreaker())
+	return client
+}
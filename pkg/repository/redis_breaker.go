@@ -0,0 +1,139 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// После стольких ошибок подряд перестаем ходить в Redis
+	breakerFailureThreshold = 5
+	// Сколько ждем, прежде чем снова попробовать
+	breakerCooldown = 10 * time.Second
+)
+
+// ErrCircuitOpen возвращается вместо похода в Redis, пока он считается недоступным.
+var ErrCircuitOpen = errors.New("redis circuit breaker is open")
+
+// Метрика состояния: 1 - Redis недоступен, работаем в деградированном режиме.
+var redisCircuitOpen = expvar.NewInt("redis_circuit_open")
+
+// CircuitBreaker - хук go-redis, который после серии сетевых ошибок
+// на время отключает все запросы клиента к Redis, чтобы они сразу падали, а не ждали таймаутов.
+// Ставится через WithCircuitBreaker.
+type CircuitBreaker struct {
+	mu       sync.Mutex
+	failures int
+	open     bool
+	openedAt time.Time
+	// После cooldown в Redis идет один пробный запрос, остальные ждут его результата
+	probing bool
+}
+
+func NewCircuitBreaker() *CircuitBreaker {
+	return &CircuitBreaker{}
+}
+
+// allow говорит, можно ли сейчас отправить запрос. После cooldown пропускает один пробный запрос (probe).
+func (b *CircuitBreaker) allow() (ok, probe bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !b.open {
+		return true, false
+	}
+	if b.probing || time.Since(b.openedAt) < breakerCooldown {
+		return false, false
+	}
+	b.probing = true
+	return true, true
+}
+
+// done учитывает результат запроса.
+func (b *CircuitBreaker) done(err error, probe bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.open && !probe {
+		// Запрос ушел до того, как Redis признали недоступным, решает только пробный
+		return
+	}
+	b.probing = false
+
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		// Запрос отменил вызывающий, о доступности Redis это ничего не говорит
+		return
+	}
+	if !isConnectionError(err) {
+		b.failures = 0
+		if b.open {
+			b.open = false
+			redisCircuitOpen.Set(0)
+			logrus.Info("redis is available again, circuit breaker closed")
+		}
+		return
+	}
+
+	b.failures++
+	if b.open {
+		// Пробный запрос не удался - ждем еще cooldown
+		b.openedAt = time.Now()
+		return
+	}
+	if b.failures >= breakerFailureThreshold {
+		b.open = true
+		b.openedAt = time.Now()
+		redisCircuitOpen.Set(1)
+		logrus.Errorf("redis is unavailable, circuit breaker opened: %v", err)
+	}
+}
+
+// isConnectionError отличает недоступность Redis от обычных ответов вроде redis.Nil или ошибок скрипта.
+func isConnectionError(err error) bool {
+	if err == nil || errors.Is(err, redis.Nil) {
+		return false
+	}
+	var redisErr redis.Error
+	return !errors.As(err, &redisErr)
+}
+
+func (b *CircuitBreaker) DialHook(next redis.DialHook) redis.DialHook {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return next(ctx, network, addr)
+	}
+}
+
+func (b *CircuitBreaker) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		ok, probe := b.allow()
+		if !ok {
+			cmd.SetErr(ErrCircuitOpen)
+			return ErrCircuitOpen
+		}
+		err := next(ctx, cmd)
+		b.done(err, probe)
+		return err
+	}
+}
+
+func (b *CircuitBreaker) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		ok, probe := b.allow()
+		if !ok {
+			for _, cmd := range cmds {
+				cmd.SetErr(ErrCircuitOpen)
+			}
+			return ErrCircuitOpen
+		}
+		err := next(ctx, cmds)
+		b.done(err, probe)
+		return err
+	}
+}
@@ -0,0 +1,145 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+var errConnRefused = errors.New("dial tcp 127.0.0.1:6379: connect: connection refused")
+
+// replyError ошибка из ответа Redis, как ее видит go-redis
+type replyError string
+
+func (e replyError) Error() string { return string(e) }
+func (replyError) RedisError()     {}
+
+// openBreaker открывает выключатель серией сетевых ошибок.
+func openBreaker(t *testing.T) *CircuitBreaker {
+	t.Helper()
+	b := NewCircuitBreaker()
+	for range breakerFailureThreshold {
+		ok, probe := b.allow()
+		if !ok || probe {
+			t.Fatal("closed breaker rejected a request")
+		}
+		b.done(errConnRefused, probe)
+	}
+	if ok, _ := b.allow(); ok {
+		t.Fatalf("breaker is closed after %d connection errors", breakerFailureThreshold)
+	}
+	return b
+}
+
+func TestCircuitBreakerIgnoresRedisReplies(t *testing.T) {
+	b := NewCircuitBreaker()
+	for range breakerFailureThreshold * 2 {
+		b.done(redis.Nil, false)
+		b.done(replyError("ERR wrong number of arguments"), false)
+	}
+	if ok, _ := b.allow(); !ok {
+		t.Error("redis replies opened the breaker")
+	}
+}
+
+func TestCircuitBreakerResetsFailuresOnSuccess(t *testing.T) {
+	b := NewCircuitBreaker()
+	for range breakerFailureThreshold - 1 {
+		b.done(errConnRefused, false)
+	}
+	b.done(nil, false)
+	b.done(errConnRefused, false)
+	if ok, _ := b.allow(); !ok {
+		t.Error("failures are not reset by a successful request")
+	}
+}
+
+func TestCircuitBreakerSingleProbe(t *testing.T) {
+	b := openBreaker(t)
+	b.openedAt = time.Now().Add(-breakerCooldown)
+
+	ok, probe := b.allow()
+	if !ok || !probe {
+		t.Fatal("half-open breaker did not let a probe through")
+	}
+	if ok, _ := b.allow(); ok {
+		t.Fatal("half-open breaker let a second request through while the probe is running")
+	}
+
+	// Запрос, отправленный до открытия, не закрывает выключатель
+	b.done(nil, false)
+	if ok, _ := b.allow(); ok {
+		t.Fatal("non-probe request closed the breaker")
+	}
+
+	b.done(nil, probe)
+	if ok, probe := b.allow(); !ok || probe {
+		t.Error("successful probe did not close the breaker")
+	}
+}
+
+func TestCircuitBreakerFailedProbe(t *testing.T) {
+	b := openBreaker(t)
+	b.openedAt = time.Now().Add(-breakerCooldown)
+
+	_, probe := b.allow()
+	b.done(errConnRefused, probe)
+
+	if ok, _ := b.allow(); ok {
+		t.Fatal("breaker let requests through right after a failed probe")
+	}
+	b.openedAt = time.Now().Add(-breakerCooldown)
+	if ok, probe := b.allow(); !ok || !probe {
+		t.Error("breaker did not probe again after another cooldown")
+	}
+}
+
+func TestCircuitBreakerIgnoresContextErrors(t *testing.T) {
+	b := NewCircuitBreaker()
+	for range breakerFailureThreshold * 2 {
+		b.done(context.Canceled, false)
+		b.done(fmt.Errorf("redis: %w", context.DeadlineExceeded), false)
+	}
+	if ok, _ := b.allow(); !ok {
+		t.Fatal("cancelled requests opened the breaker")
+	}
+
+	// Отмененная проба не закрывает выключатель, но и не мешает следующей
+	b = openBreaker(t)
+	b.openedAt = time.Now().Add(-breakerCooldown)
+	_, probe := b.allow()
+	b.done(context.Canceled, probe)
+	if ok, probe := b.allow(); !ok || !probe {
+		t.Error("breaker did not probe again after a cancelled probe")
+	}
+}
+
+// Выключатель стоит только на своем клиенте и не роняет общий
+func TestWithCircuitBreakerKeepsSharedClient(t *testing.T) {
+	mr := miniredis.RunT(t)
+	shared := redis.NewClient(&redis.Options{Addr: mr.Addr(), MaxRetries: -1})
+	t.Cleanup(func() { _ = shared.Close() })
+	limiter := WithCircuitBreaker(shared)
+	t.Cleanup(func() { _ = limiter.Close() })
+	ctx := context.Background()
+
+	mr.Close()
+	for range breakerFailureThreshold {
+		_ = limiter.Ping(ctx).Err()
+	}
+	if err := limiter.Ping(ctx).Err(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("limiter client error = %v, want %v", err, ErrCircuitOpen)
+	}
+
+	if err := mr.Restart(); err != nil {
+		t.Fatal(err)
+	}
+	if err := shared.Ping(ctx).Err(); err != nil {
+		t.Errorf("shared client failed while the limiter breaker is open: %v", err)
+	}
+}
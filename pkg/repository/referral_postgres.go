@@ -0,0 +1,134 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/ArtemChadaev/go"
+	"github.com/jmoiron/sqlx"
+)
+
+type ReferralRepository struct {
+	db *sqlx.DB
+}
+
+func NewReferralPostgres(db *sqlx.DB) *ReferralRepository {
+	return &ReferralRepository{db: db}
+}
+
+// GetReferralCode код пользователя, пустая строка - если его еще нет.
+func (r *ReferralRepository) GetReferralCode(userId int) (string, error) {
+	var code string
+	query := "SELECT COALESCE(referral_code, '') FROM users WHERE id=$1"
+	err := r.db.Get(&code, query, userId)
+	return code, err
+}
+
+// SetReferralCode сохраняет код, если у пользователя его еще нет.
+func (r *ReferralRepository) SetReferralCode(userId int, code string) error {
+	query := "UPDATE users SET referral_code=$1 WHERE id=$2 AND referral_code IS NULL"
+	_, err := r.db.Exec(query, code, userId)
+	return err
+}
+
+func (r *ReferralRepository) GetUserIdByReferralCode(code string) (int, error) {
+	var userId int
+	query := "SELECT id FROM users WHERE referral_code=$1"
+	err := r.db.Get(&userId, query, code)
+	return userId, err
+}
+
+// ReferralLimits защита от накруток: сколько приглашенных может зарегистрироваться
+// с одного IP и одного устройства начиная с Since, 0 - без ограничений.
+type ReferralLimits struct {
+	MaxPerIP     int
+	MaxPerDevice int
+	Since        time.Time
+}
+
+// createReferral сохраняет приглашение внутри транзакции регистрации. Если с этого IP или устройства
+// уже зарегистрировалось слишком много приглашенных, приглашение сохраняется отклоненным.
+// Подсчет и вставка идут под advisory-блокировкой по IP и устройству, поэтому параллельные
+// регистрации не могут одновременно пройти проверку.
+func createReferral(tx *sqlx.Tx, referral *rest.Referral, limits ReferralLimits) error {
+	var ip, fingerprint string
+	if referral.SignupIP != nil && limits.MaxPerIP > 0 {
+		ip = *referral.SignupIP
+	}
+	if referral.DeviceFingerprint != nil && limits.MaxPerDevice > 0 {
+		fingerprint = *referral.DeviceFingerprint
+	}
+
+	// Блокировки всегда берутся в одном порядке: сначала IP, потом устройство
+	locks := make([]string, 0, 2)
+	if ip != "" {
+		locks = append(locks, "referral_signup:ip:"+ip)
+	}
+	if fingerprint != "" {
+		locks = append(locks, "referral_signup:device:"+fingerprint)
+	}
+	for _, lock := range locks {
+		if _, err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext($1))", lock); err != nil {
+			return err
+		}
+	}
+
+	if len(locks) > 0 {
+		var byIP, byDevice int
+		query := `SELECT COUNT(*) FILTER (WHERE signup_ip = $1),
+						 COUNT(*) FILTER (WHERE device_fingerprint = $2)
+				  FROM referrals WHERE created_at >= $3 AND (signup_ip = $1 OR device_fingerprint = $2)`
+		if err := tx.QueryRow(query, ip, fingerprint, limits.Since).Scan(&byIP, &byDevice); err != nil {
+			return err
+		}
+
+		var reason string
+		switch {
+		case ip != "" && byIP >= limits.MaxPerIP:
+			reason = rest.ReferralRejectIPLimit
+		case fingerprint != "" && byDevice >= limits.MaxPerDevice:
+			reason = rest.ReferralRejectDeviceLimit
+		}
+		if reason != "" {
+			referral.Status = rest.ReferralStatusRejected
+			referral.RejectReason = &reason
+		}
+	}
+
+	query := `INSERT INTO referrals (referee_id, referrer_id, status, reject_reason, signup_ip, device_fingerprint)
+			  VALUES (:referee_id, :referrer_id, :status, :reject_reason, :signup_ip, :device_fingerprint)`
+	_, err := tx.NamedExec(query, referral)
+	return err
+}
+
+func (r *ReferralRepository) GetReferral(refereeId int) (rest.Referral, error) {
+	var referral rest.Referral
+	query := `SELECT r.*, COALESCE(us.name, '') AS name
+			  FROM referrals r LEFT JOIN user_settings us ON us.user_id = r.referee_id
+			  WHERE r.referee_id=$1`
+	err := r.db.Get(&referral, query, refereeId)
+	return referral, err
+}
+
+func (r *ReferralRepository) QualifyReferral(refereeId int) error {
+	query := "UPDATE referrals SET status=$1, qualified_at=NOW() WHERE referee_id=$2 AND status=$3"
+	_, err := r.db.Exec(query, rest.ReferralStatusQualified, refereeId, rest.ReferralStatusPending)
+	return err
+}
+
+// GetReferrals все приглашенные пользователем, новые первыми.
+func (r *ReferralRepository) GetReferrals(referrerId int) ([]rest.Referral, error) {
+	referrals := []rest.Referral{}
+	query := `SELECT r.*, COALESCE(us.name, '') AS name
+			  FROM referrals r LEFT JOIN user_settings us ON us.user_id = r.referee_id
+			  WHERE r.referrer_id=$1 ORDER BY r.created_at DESC`
+	err := r.db.Select(&referrals, query, referrerId)
+	return referrals, err
+}
+
+// GetReferralCoins сколько монет пользователь получил за приглашения.
+func (r *ReferralRepository) GetReferralCoins(referrerId int) (int, error) {
+	var coins int
+	query := "SELECT COALESCE(SUM(amount), 0) FROM coin_transactions WHERE user_id=$1 AND reason=$2"
+	err := r.db.Get(&coins, query, referrerId, rest.CoinReasonReferrerBonus)
+	return coins, err
+}
@@ -8,7 +8,7 @@ import (
 )
 
 type Autorization interface {
-	CreateUser(user rest.User) (int, error)
+	CreateUser(user rest.User, settings rest.UserSettings, referral *rest.Referral, limits ReferralLimits) (int, error)
 	GetUser(username, password string) (int, error)
 	GetUserEmailFromId(id int) (string, error)
 	UpdateUserPassword(user rest.User) error
@@ -19,24 +19,141 @@ type Autorization interface {
 	DeleteRefreshToken(tokenId int) error
 	DeleteAllUserRefreshTokens(userId int) error
 	GetRefreshTokens(userId int) ([]rest.RefreshToken, error)
+	IsAdmin(userId int) (bool, error)
 }
 type UserSettings interface {
-	CreateUserSettings(settings rest.UserSettings) error
 	GetUserSettings(userId int) (rest.UserSettings, error)
+	GetUsersSettings(userIds []int) ([]rest.UserSettings, error)
+	GetUserIdsByName(name string) ([]int, error)
 	UpdateUserSettings(settings rest.UserSettings) error
-	UpdateUserCoin(userId int, coin int) error
-	BuyPaidSubscription(userId int, time time.Time) error
-	DeactivateExpiredSubscriptions() (int64, error)
+	UpdateUserTimezone(userId int, timezone string) error
+	ExtendPaidSubscription(userId, days int) (time.Time, error)
+	DeactivateExpiredSubscriptions() ([]rest.SubscriptionExpiry, error)
+}
+type Coins interface {
+	ChangeCoins(transaction rest.CoinTransaction) (rest.CoinTransaction, error)
+	TransferCoins(transfer rest.CoinTransfer, dailyCap int) (rest.CoinTransfer, error)
+	GetCoinTransactions(userId, limit, offset int) ([]rest.CoinTransaction, error)
+	CountCoinTransactions(userId int) (int, error)
+}
+
+type Redeem interface {
+	CreateRedeemBatch(batch rest.RedeemBatch, codes []string) (rest.RedeemBatch, error)
+	GetRedeemBatch(batchId int) (rest.RedeemBatch, error)
+	RedeemCode(userId int, code string) (rest.RedeemResult, error)
+}
+
+type DailyRewards interface {
+	GetDailyRewardStreak(userId int) (rest.DailyRewardStreak, error)
+	ClaimDailyReward(claim rest.DailyRewardClaim, streak rest.DailyRewardStreak, prevClaimDate *time.Time) (rest.DailyRewardClaim, error)
+}
+
+type Leaderboards interface {
+	GetUserClanId(userId int) (int, error)
+	GetBalanceScores() ([]rest.LeaderboardScore, error)
+	GetEarnedScores(since time.Time, excludeReasons []string) ([]rest.LeaderboardScore, error)
+	HasLeaderboardArchive(week, board string) (bool, error)
+	SaveLeaderboardArchive(entries []rest.LeaderboardArchiveEntry) error
+}
+
+type Achievements interface {
+	ApplyAchievementEvent(event rest.Event) ([]rest.AchievementCounter, error)
+	UnlockAchievement(userId int, code string) (bool, error)
+	GetUserAchievements(userId int) ([]rest.UserAchievement, error)
+	DeleteProcessedEventsBefore(before time.Time) (int64, error)
+}
+
+type Referrals interface {
+	GetReferralCode(userId int) (string, error)
+	SetReferralCode(userId int, code string) error
+	GetUserIdByReferralCode(code string) (int, error)
+	GetReferral(refereeId int) (rest.Referral, error)
+	QualifyReferral(refereeId int) error
+	GetReferrals(referrerId int) ([]rest.Referral, error)
+	GetReferralCoins(referrerId int) (int, error)
+}
+
+type Subscriptions interface {
+	GetSubscriptionPlans() ([]rest.SubscriptionPlan, error)
+	GetSubscriptionPlan(code string) (rest.SubscriptionPlan, error)
+	GetSubscriptionPlanById(planId int) (rest.SubscriptionPlan, error)
+	PurchaseSubscription(userId int, plan rest.SubscriptionPlan, referenceId string) (rest.Subscription, error)
+	PurchaseSubscriptionWithCoins(userId int, plan rest.SubscriptionPlan) (rest.Subscription, error)
+	StartTrial(userId int, plan rest.SubscriptionPlan, days int) (rest.Subscription, error)
+	SetAutoRenew(userId int, autoRenew bool) error
+	CancelSubscription(userId int) (rest.Subscription, error)
+	GetSubscriptionsDueForRenewal(renewBefore, retryInterval time.Duration, attempts int) ([]rest.SubscriptionRenewal, error)
+	SetSubscriptionGrace(userId int, grace time.Duration) error
+}
+
+type Payments interface {
+	CreatePayment(payment rest.Payment) (rest.Payment, error)
+	SetPaymentCheckout(paymentId, externalId, checkoutURL string) error
+	GetPayment(paymentId string) (rest.Payment, error)
+	UpdatePaymentStatus(paymentId, status string) (rest.Payment, bool, error)
+	ClaimSubscriptionRenewal(payment rest.Payment) (rest.Payment, bool, error)
+}
+
+type Notifications interface {
+	CreateNotification(notification rest.Notification) (rest.Notification, bool, error)
+	MarkNotificationEmailed(notificationId int64) error
+	GetNotifications(userId, limit, offset int) ([]rest.Notification, error)
+	CountNotifications(userId int) (total, unread int, err error)
+	MarkNotificationsRead(userId int, ids []int64) error
+	GetExpiringSubscriptions(within time.Duration) ([]rest.SubscriptionExpiry, error)
+}
+
+type Clan interface {
+	CreateClan(clan rest.Clan, leaderId int) (rest.Clan, error)
+	GetClan(clanId int) (rest.Clan, error)
+	GetClanMemberRole(clanId, userId int) (int, error)
+	UpdateClan(clan rest.Clan) error
+	DeleteClan(clanId int) error
+	GetUserClanRole(userId int) (clanId, roleId int, err error)
+	GetClanLeaderId(clanId int) (int, error)
+	GetClanMembers(clanId int) ([]rest.ClanMember, error)
+	GetClanRoles(clanId int) ([]rest.ClanRole, error)
+	GetClanRolePermissions(clanId int) (map[int]rest.ClanPermissions, error)
+	UpdateClanRole(clanId, roleId int, name *string, permissions *rest.ClanPermissions) error
+	RemoveClanMember(clanId, userId, role int) error
+	SetClanMemberRole(clanId, userId, from, to int) error
+	TransferClanLeadership(clanId, leaderId, userId int) error
+	CreateClanInvite(invite rest.ClanInvite) (rest.ClanInvite, error)
+	GetClanInvite(inviteId int) (rest.ClanInvite, error)
+	GetClanInvites(clanId int) ([]rest.ClanInvite, error)
+	GetUserClanInvites(userId int) ([]rest.ClanInvite, error)
+	DeleteClanInvite(inviteId int) error
+	AcceptClanInvite(invite rest.ClanInvite, memberLimit int) error
 }
 
 type Repository struct {
 	Autorization
 	UserSettings
+	Coins
+	Redeem
+	DailyRewards
+	Leaderboards
+	Achievements
+	Referrals
+	Subscriptions
+	Payments
+	Notifications
+	Clan
 }
 
 func NewRepository(db *sqlx.DB) *Repository {
 	return &Repository{
-		Autorization: NewAuthPostgres(db),
-		UserSettings: NewUserSettingsPostgres(db),
+		Autorization:  NewAuthPostgres(db),
+		UserSettings:  NewUserSettingsPostgres(db),
+		Coins:         NewCoinPostgres(db),
+		Redeem:        NewRedeemPostgres(db),
+		DailyRewards:  NewDailyRewardPostgres(db),
+		Leaderboards:  NewLeaderboardPostgres(db),
+		Achievements:  NewAchievementPostgres(db),
+		Referrals:     NewReferralPostgres(db),
+		Subscriptions: NewSubscriptionPostgres(db),
+		Payments:      NewPaymentPostgres(db),
+		Notifications: NewNotificationPostgres(db),
+		Clan:          NewClanPostgres(db),
 	}
 }
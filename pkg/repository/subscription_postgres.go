@@ -0,0 +1,295 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/ArtemChadaev/go"
+	"github.com/jmoiron/sqlx"
+)
+
+var (
+	// ErrTrialUnavailable пробный период уже использован или подписка уже активна
+	ErrTrialUnavailable = errors.New("trial unavailable")
+	// ErrSubscriptionNotActive у пользователя нет активной подписки
+	ErrSubscriptionNotActive = errors.New("subscription is not active")
+)
+
+type SubscriptionRepository struct {
+	db *sqlx.DB
+}
+
+func NewSubscriptionPostgres(db *sqlx.DB) *SubscriptionRepository {
+	return &SubscriptionRepository{db: db}
+}
+
+// GetSubscriptionPlans тарифы, которые сейчас продаются.
+func (r *SubscriptionRepository) GetSubscriptionPlans() ([]rest.SubscriptionPlan, error) {
+	plans := []rest.SubscriptionPlan{}
+	query := "SELECT * FROM subscription_plans WHERE active ORDER BY duration_days, id"
+	err := r.db.Select(&plans, query)
+	return plans, err
+}
+
+// GetSubscriptionPlan тариф в продаже по коду.
+func (r *SubscriptionRepository) GetSubscriptionPlan(code string) (rest.SubscriptionPlan, error) {
+	var plan rest.SubscriptionPlan
+	query := "SELECT * FROM subscription_plans WHERE code=$1 AND active"
+	err := r.db.Get(&plan, query, code)
+	return plan, err
+}
+
+// GetSubscriptionPlanById тариф по id, в том числе снятый с продажи.
+func (r *SubscriptionRepository) GetSubscriptionPlanById(planId int) (rest.SubscriptionPlan, error) {
+	var plan rest.SubscriptionPlan
+	query := "SELECT * FROM subscription_plans WHERE id=$1"
+	err := r.db.Get(&plan, query, planId)
+	return plan, err
+}
+
+// PurchaseSubscription продлевает подписку на срок тарифа, делает его текущим и пишет историю.
+// Повторная покупка текущего тарифа при активной подписке считается продлением.
+func (r *SubscriptionRepository) PurchaseSubscription(userId int, plan rest.SubscriptionPlan, referenceId string) (rest.Subscription, error) {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return rest.Subscription{}, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	subscription, err := purchaseSubscriptionTx(tx, userId, plan, referenceId)
+	if err != nil {
+		return subscription, err
+	}
+	return subscription, tx.Commit()
+}
+
+// PurchaseSubscriptionWithCoins покупает тариф за монеты: списание и продление в одной транзакции.
+// Если монет не хватает, возвращается ErrNotEnoughCoins и подписка не меняется.
+func (r *SubscriptionRepository) PurchaseSubscriptionWithCoins(userId int, plan rest.SubscriptionPlan) (rest.Subscription, error) {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return rest.Subscription{}, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	subscription, err := purchaseSubscriptionTx(tx, userId, plan, "")
+	if err != nil {
+		return subscription, err
+	}
+
+	// Списание ссылается на запись истории подписки
+	referenceId := strconv.FormatInt(subscription.ID, 10)
+	transaction, err := changeCoinsTx(tx, rest.CoinTransaction{
+		UserID:      userId,
+		Amount:      -*plan.CoinPrice,
+		Reason:      rest.CoinReasonSubscription,
+		ReferenceID: &referenceId,
+	})
+	if err != nil {
+		return subscription, err
+	}
+	subscription.Transaction = &transaction
+
+	return subscription, tx.Commit()
+}
+
+// purchaseSubscriptionTx покупка тарифа внутри открытой транзакции.
+func purchaseSubscriptionTx(tx *sqlx.Tx, userId int, plan rest.SubscriptionPlan, referenceId string) (rest.Subscription, error) {
+	var current struct {
+		Active bool `db:"active"`
+		PlanID *int `db:"subscription_plan_id"`
+	}
+	query := `SELECT COALESCE(paid_subscription AND GREATEST(date_of_paid_subscription, subscription_grace_until) > NOW(), false) AS active,
+				  subscription_plan_id
+			  FROM user_settings WHERE user_id=$1 FOR UPDATE`
+	if err := tx.Get(&current, query, userId); err != nil {
+		return rest.Subscription{}, err
+	}
+
+	subscription := rest.Subscription{
+		UserID: userId,
+		PlanID: &plan.ID,
+		Action: rest.SubscriptionActionPurchase,
+		Days:   plan.DurationDays,
+	}
+	if current.Active && current.PlanID != nil && *current.PlanID == plan.ID {
+		subscription.Action = rest.SubscriptionActionRenewal
+	}
+	if referenceId != "" {
+		subscription.ReferenceID = &referenceId
+	}
+
+	until, err := extendPaidSubscription(tx, userId, plan.DurationDays)
+	if err != nil {
+		return rest.Subscription{}, err
+	}
+	subscription.EndsAt = &until
+	// Покупка снимает отмену и льготный период
+	query = `UPDATE user_settings
+			 SET subscription_plan_id=$1, subscription_canceled_at=NULL, subscription_grace_until=NULL
+			 WHERE user_id=$2`
+	if _, err := tx.Exec(query, plan.ID, userId); err != nil {
+		return rest.Subscription{}, err
+	}
+
+	if subscription, err = recordSubscription(tx, subscription); err != nil {
+		return subscription, err
+	}
+	subscription.Plan = &plan
+
+	return subscription, nil
+}
+
+// StartTrial дает пробный период по тарифу, один раз на аккаунт и только без активной подписки.
+func (r *SubscriptionRepository) StartTrial(userId int, plan rest.SubscriptionPlan, days int) (rest.Subscription, error) {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return rest.Subscription{}, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var available bool
+	query := `SELECT trial_used_at IS NULL
+				  AND NOT COALESCE(paid_subscription AND GREATEST(date_of_paid_subscription, subscription_grace_until) > NOW(), false)
+			  FROM user_settings WHERE user_id=$1 FOR UPDATE`
+	if err := tx.Get(&available, query, userId); err != nil {
+		return rest.Subscription{}, err
+	}
+	if !available {
+		return rest.Subscription{}, ErrTrialUnavailable
+	}
+
+	until, err := extendPaidSubscription(tx, userId, days)
+	if err != nil {
+		return rest.Subscription{}, err
+	}
+	query = `UPDATE user_settings
+			 SET subscription_plan_id=$1, trial_used_at=NOW(), subscription_canceled_at=NULL
+			 WHERE user_id=$2`
+	if _, err := tx.Exec(query, plan.ID, userId); err != nil {
+		return rest.Subscription{}, err
+	}
+
+	subscription, err := recordSubscription(tx, rest.Subscription{
+		UserID: userId,
+		PlanID: &plan.ID,
+		Action: rest.SubscriptionActionTrial,
+		Days:   days,
+		EndsAt: &until,
+	})
+	if err != nil {
+		return subscription, err
+	}
+	subscription.Plan = &plan
+
+	return subscription, tx.Commit()
+}
+
+// SetAutoRenew включает или выключает автопродление. Включение снимает отмену подписки.
+func (r *SubscriptionRepository) SetAutoRenew(userId int, autoRenew bool) error {
+	query := `UPDATE user_settings
+			  SET auto_renew=$1, subscription_canceled_at = CASE WHEN $1 THEN NULL ELSE subscription_canceled_at END
+			  WHERE user_id=$2`
+	_, err := r.db.Exec(query, autoRenew, userId)
+	return err
+}
+
+// CancelSubscription отменяет подписку: автопродление выключается, доступ остается до конца оплаченного срока.
+// В льготный период после неудачного автопродления отмена останавливает повторные списания.
+func (r *SubscriptionRepository) CancelSubscription(userId int) (rest.Subscription, error) {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return rest.Subscription{}, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	subscription := rest.Subscription{
+		UserID: userId,
+		Action: rest.SubscriptionActionCancel,
+	}
+	query := `UPDATE user_settings
+			  SET auto_renew=false, subscription_canceled_at=NOW()
+			  WHERE user_id=$1 AND paid_subscription
+				AND GREATEST(date_of_paid_subscription, subscription_grace_until) > NOW()
+			  RETURNING subscription_plan_id, GREATEST(date_of_paid_subscription, subscription_grace_until)`
+	err = tx.QueryRow(query, userId).Scan(&subscription.PlanID, &subscription.EndsAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return subscription, ErrSubscriptionNotActive
+	}
+	if err != nil {
+		return subscription, err
+	}
+
+	if subscription, err = recordSubscription(tx, subscription); err != nil {
+		return subscription, err
+	}
+	return subscription, tx.Commit()
+}
+
+// GetSubscriptionsDueForRenewal подписки с автопродлением, которые закончатся раньше чем через renewBefore
+// и за текущий срок которых еще не пытались списать оплату. Если списание не прошло, подписка возвращается
+// снова не раньше чем через retryInterval, пока идет льготный период и попыток меньше attempts.
+// Это только кандидаты: перед списанием попытку нужно занять через ClaimSubscriptionRenewal.
+func (r *SubscriptionRepository) GetSubscriptionsDueForRenewal(renewBefore, retryInterval time.Duration, attempts int) ([]rest.SubscriptionRenewal, error) {
+	renewals := []rest.SubscriptionRenewal{}
+	query := `SELECT us.user_id, us.subscription_plan_id AS plan_id, p.provider, p.external_id AS payment_method,
+					 us.date_of_paid_subscription AS period, COALESCE(last.attempt + 1, 0) AS attempt
+			  FROM user_settings us
+					   JOIN LATERAL (SELECT provider, external_id
+									 FROM payments
+									 WHERE user_id = us.user_id AND kind = $1 AND status = $2 AND external_id IS NOT NULL
+									 ORDER BY created_at DESC
+									 LIMIT 1) p ON true
+					   LEFT JOIN LATERAL (SELECT renewal_attempt AS attempt, status, created_at
+										  FROM payments
+										  WHERE user_id = us.user_id AND renewal
+											AND renewal_period = us.date_of_paid_subscription
+										  ORDER BY renewal_attempt DESC
+										  LIMIT 1) last ON true
+			  WHERE us.auto_renew AND us.paid_subscription AND us.subscription_plan_id IS NOT NULL
+				AND us.subscription_canceled_at IS NULL
+				AND us.date_of_paid_subscription < NOW() + make_interval(secs => $3)
+				AND (last.attempt IS NULL
+					OR last.status = $4 AND last.attempt + 1 < $6
+						AND last.created_at < NOW() - make_interval(secs => $5)
+						AND us.subscription_grace_until > NOW())`
+	err := r.db.Select(&renewals, query, rest.PaymentKindSubscription, rest.PaymentStatusSucceeded, renewBefore.Seconds(),
+		rest.PaymentStatusFailed, retryInterval.Seconds(), attempts)
+	return renewals, err
+}
+
+// SetSubscriptionGrace после неудачного автопродления оставляет подписку еще на grace после окончания.
+func (r *SubscriptionRepository) SetSubscriptionGrace(userId int, grace time.Duration) error {
+	query := `UPDATE user_settings
+			  SET subscription_grace_until = date_of_paid_subscription + make_interval(secs => $1)
+			  WHERE user_id=$2 AND paid_subscription AND subscription_grace_until IS NULL`
+	_, err := r.db.Exec(query, grace.Seconds(), userId)
+	return err
+}
+
+// grantSubscriptionDays дарит дни подписки (награды, промокоды) с записью в историю.
+func grantSubscriptionDays(tx *sqlx.Tx, userId, days int, referenceId *string) (time.Time, error) {
+	until, err := extendPaidSubscription(tx, userId, days)
+	if err != nil {
+		return until, err
+	}
+	_, err = recordSubscription(tx, rest.Subscription{
+		UserID:      userId,
+		Action:      rest.SubscriptionActionGrant,
+		Days:        days,
+		EndsAt:      &until,
+		ReferenceID: referenceId,
+	})
+	return until, err
+}
+
+// recordSubscription пишет операцию в историю подписки.
+func recordSubscription(tx *sqlx.Tx, subscription rest.Subscription) (rest.Subscription, error) {
+	query := `INSERT INTO subscriptions (user_id, plan_id, action, days, ends_at, reference_id)
+			  VALUES ($1, $2, $3, $4, $5, $6) RETURNING id, created_at`
+	err := tx.QueryRow(query, subscription.UserID, subscription.PlanID, subscription.Action, subscription.Days,
+		subscription.EndsAt, subscription.ReferenceID).Scan(&subscription.ID, &subscription.CreatedAt)
+	return subscription, err
+}
@@ -5,6 +5,7 @@ import (
 
 	"github.com/ArtemChadaev/go"
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 )
 
 type UserSettingsRepository struct {
@@ -15,12 +16,6 @@ func NewUserSettingsPostgres(db *sqlx.DB) *UserSettingsRepository {
 	return &UserSettingsRepository{db: db}
 }
 
-func (r *UserSettingsRepository) CreateUserSettings(settings rest.UserSettings) error {
-	query := "INSERT INTO user_settings (user_id, name) VALUES ($1, $2)"
-	_, err := r.db.Exec(query, settings.UserID, settings.Name)
-	return err
-}
-
 func (r *UserSettingsRepository) GetUserSettings(userId int) (rest.UserSettings, error) {
 	var settings rest.UserSettings
 	query := "SELECT * FROM user_settings WHERE user_id=$1"
@@ -28,35 +23,72 @@ func (r *UserSettingsRepository) GetUserSettings(userId int) (rest.UserSettings,
 	return settings, err
 }
 
+func (r *UserSettingsRepository) GetUsersSettings(userIds []int) ([]rest.UserSettings, error) {
+	var settings []rest.UserSettings
+	query := "SELECT * FROM user_settings WHERE user_id = ANY($1)"
+	err := r.db.Select(&settings, query, pq.Array(userIds))
+	return settings, err
+}
+
+// GetUserIdsByName имена не уникальны, двух найденных достаточно, чтобы понять, что выбрать нельзя.
+func (r *UserSettingsRepository) GetUserIdsByName(name string) ([]int, error) {
+	var ids []int
+	query := "SELECT user_id FROM user_settings WHERE name=$1 LIMIT 2"
+	err := r.db.Select(&ids, query, name)
+	return ids, err
+}
+
 func (r *UserSettingsRepository) UpdateUserSettings(settings rest.UserSettings) error {
 	query := "UPDATE user_settings SET name=$1, icon=$2 WHERE user_id=$3"
 	_, err := r.db.Exec(query, settings.Name, settings.Icon, settings.UserID)
 	return err
 }
 
-func (r *UserSettingsRepository) UpdateUserCoin(userId int, coin int) error {
-	query := "UPDATE user_settings SET coin=$1 WHERE user_id=$2"
-	_, err := r.db.Exec(query, coin, userId)
-	return err
-}
-func (r *UserSettingsRepository) BuyPaidSubscription(userId int, time time.Time) error {
-	query := "UPDATE user_settings SET paid_subscription=$1, date_of_paid_subscription=$2 WHERE user_id=$3"
-	_, err := r.db.Exec(query, true, time, userId)
+func (r *UserSettingsRepository) UpdateUserTimezone(userId int, timezone string) error {
+	query := "UPDATE user_settings SET timezone=$1, timezone_updated_at=NOW() WHERE user_id=$2"
+	_, err := r.db.Exec(query, timezone, userId)
 	return err
 }
-func (r *UserSettingsRepository) DeactivateExpiredSubscriptions() (int64, error) {
-	query := `UPDATE user_settings SET paid_subscription = false 
-			  WHERE paid_subscription = true AND date_of_paid_subscription < NOW()`
 
-	result, err := r.db.Exec(query)
+// ExtendPaidSubscription дарит days дней подписки и возвращает новую дату окончания.
+func (r *UserSettingsRepository) ExtendPaidSubscription(userId, days int) (time.Time, error) {
+	tx, err := r.db.Beginx()
 	if err != nil {
-		return 0, err
+		return time.Time{}, err
 	}
+	defer func() { _ = tx.Rollback() }()
 
-	rowsAffected, err := result.RowsAffected()
+	until, err := grantSubscriptionDays(tx, userId, days, nil)
 	if err != nil {
-		return 0, err
+		return until, err
 	}
+	return until, tx.Commit()
+}
+
+// extendPaidSubscription единое правило продления: если подписка активна и не истекла,
+// дни добавляются к дате окончания, иначе отсчитываются от текущего момента.
+// q может быть как базой, так и открытой транзакцией.
+func extendPaidSubscription(q sqlx.Queryer, userId, days int) (time.Time, error) {
+	var until time.Time
+	query := `UPDATE user_settings
+			  SET date_of_paid_subscription = CASE
+					  WHEN paid_subscription AND date_of_paid_subscription > NOW() THEN date_of_paid_subscription
+					  ELSE NOW() END + make_interval(days => $1),
+				  paid_subscription = true
+			  WHERE user_id=$2
+			  RETURNING date_of_paid_subscription`
+	err := sqlx.Get(q, &until, query, days, userId)
+	return until, err
+}
 
-	return rowsAffected, nil
+// DeactivateExpiredSubscriptions выключает истекшие подписки, у которых закончился и льготный период,
+// и возвращает, у кого они закончились.
+func (r *UserSettingsRepository) DeactivateExpiredSubscriptions() ([]rest.SubscriptionExpiry, error) {
+	expired := []rest.SubscriptionExpiry{}
+	query := `UPDATE user_settings SET paid_subscription = false, subscription_grace_until = NULL
+			  WHERE paid_subscription = true AND date_of_paid_subscription < NOW()
+				AND (subscription_grace_until IS NULL OR subscription_grace_until < NOW())
+			  RETURNING user_id, date_of_paid_subscription AS ends_at`
+	err := r.db.Select(&expired, query)
+	return expired, err
 }
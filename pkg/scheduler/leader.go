@@ -0,0 +1,96 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+// Ключ Redis, которым владеет текущий лидер
+const leaderKey = "scheduler:leader"
+
+// ErrNotLeader аренда ушла к другой реплике, задачу нужно прервать
+var ErrNotLeader = errors.New("scheduler: leadership lost")
+
+// Продлить аренду может только ее владелец
+var renewLeaseScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0`)
+
+// И отпустить тоже
+var releaseLeaseScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`)
+
+// leaderLease аренда лидерства в Redis. Лидер продлевает ее, пока жив,
+// а если реплика упала, аренда истекает и лидером становится другая.
+type leaderLease struct {
+	redis *redis.Client
+	id    string
+	ttl   time.Duration
+}
+
+func newLeaderLease(redis *redis.Client, ttl time.Duration) *leaderLease {
+	host, _ := os.Hostname()
+	return &leaderLease{
+		redis: redis,
+		id:    fmt.Sprintf("%s-%s", host, uuid.NewString()),
+		ttl:   ttl,
+	}
+}
+
+// acquire пытается стать лидером или продлить уже взятую аренду.
+func (l *leaderLease) acquire(ctx context.Context, leader bool) (bool, error) {
+	if leader {
+		renewed, err := renewLeaseScript.Run(ctx, l.redis, []string{leaderKey}, l.id, l.ttl.Milliseconds()).Int()
+		return renewed == 1, err
+	}
+	return l.redis.SetNX(ctx, leaderKey, l.id, l.ttl).Result()
+}
+
+// release отдает лидерство при остановке, чтобы другая реплика не ждала истечения аренды.
+func (l *leaderLease) release(ctx context.Context) error {
+	return releaseLeaseScript.Run(ctx, l.redis, []string{leaderKey}, l.id).Err()
+}
+
+// held проверяет, что аренда все еще принадлежит этой реплике.
+func (l *leaderLease) held(ctx context.Context) (bool, error) {
+	id, err := l.redis.Get(ctx, leaderKey).Result()
+	if errors.Is(err, redis.Nil) {
+		return false, nil
+	}
+	return id == l.id, err
+}
+
+type leaseCtxKey struct{}
+
+// EnsureLeader вызывается задачей перед каждым шагом с побочным эффектом: ctx не отменен
+// и аренда в Redis все еще у этой реплики. Отмена ctx при потере лидерства приходит только
+// со следующим продлением, а эта проверка не дает двум репликам выполнить один шаг.
+// Вне планировщика проверяется только ctx.
+func EnsureLeader(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	l, ok := ctx.Value(leaseCtxKey{}).(*leaderLease)
+	if !ok {
+		return nil
+	}
+	held, err := l.held(ctx)
+	if err != nil {
+		return fmt.Errorf("scheduler: can't check leadership: %w", err)
+	}
+	if !held {
+		return ErrNotLeader
+	}
+	return nil
+}
@@ -0,0 +1,172 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+const testLease = 30 * time.Second
+
+func newTestRedis(t *testing.T) (*miniredis.Miniredis, *redis.Client) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+	return mr, client
+}
+
+// acquire без ошибки Redis
+func mustAcquire(t *testing.T, l *leaderLease, leader bool) bool {
+	t.Helper()
+	ok, err := l.acquire(context.Background(), leader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ok
+}
+
+func TestLeaderLease(t *testing.T) {
+	mr, client := newTestRedis(t)
+	a := newLeaderLease(client, testLease)
+	b := newLeaderLease(client, testLease)
+
+	if !mustAcquire(t, a, false) {
+		t.Fatal("first replica did not become leader")
+	}
+	if mustAcquire(t, b, false) {
+		t.Fatal("second replica became leader while the lease is held")
+	}
+
+	// Продление сдвигает срок аренды
+	mr.FastForward(testLease * 2 / 3)
+	if !mustAcquire(t, a, true) {
+		t.Fatal("leader could not renew its lease")
+	}
+	mr.FastForward(testLease * 2 / 3)
+	if mustAcquire(t, b, false) {
+		t.Fatal("renewed lease expired")
+	}
+
+	// Лидер завис и не продлил аренду
+	mr.FastForward(testLease)
+	if !mustAcquire(t, b, false) {
+		t.Fatal("second replica did not take over an expired lease")
+	}
+	if mustAcquire(t, a, true) {
+		t.Fatal("old leader renewed a lease it lost")
+	}
+
+	// Чужую аренду отпустить нельзя
+	if err := a.release(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := mr.Get(leaderKey); got != b.id {
+		t.Fatalf("lease owner = %q after release by another replica, want %q", got, b.id)
+	}
+	if err := b.release(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if mr.Exists(leaderKey) {
+		t.Fatal("lease is still held after release")
+	}
+}
+
+func TestEnsureLeader(t *testing.T) {
+	mr, client := newTestRedis(t)
+	a := newLeaderLease(client, testLease)
+	b := newLeaderLease(client, testLease)
+	ctx := context.WithValue(context.Background(), leaseCtxKey{}, a)
+
+	if err := EnsureLeader(ctx); !errors.Is(err, ErrNotLeader) {
+		t.Errorf("EnsureLeader() without lease = %v, want %v", err, ErrNotLeader)
+	}
+	mustAcquire(t, a, false)
+	if err := EnsureLeader(ctx); err != nil {
+		t.Errorf("EnsureLeader() of the leader = %v", err)
+	}
+
+	mr.FastForward(testLease)
+	mustAcquire(t, b, false)
+	if err := EnsureLeader(ctx); !errors.Is(err, ErrNotLeader) {
+		t.Errorf("EnsureLeader() after losing the lease = %v, want %v", err, ErrNotLeader)
+	}
+
+	// Вне планировщика проверяется только ctx
+	if err := EnsureLeader(context.Background()); err != nil {
+		t.Errorf("EnsureLeader() outside scheduler = %v", err)
+	}
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := EnsureLeader(canceled); !errors.Is(err, context.Canceled) {
+		t.Errorf("EnsureLeader() with canceled ctx = %v, want %v", err, context.Canceled)
+	}
+}
+
+// runNow запускает задачи лидера, не дожидаясь расписания, и ждет их завершения.
+func runNow(s *Scheduler) {
+	now := time.Now()
+	for _, j := range s.jobs {
+		j.status.NextRunAt = &now
+	}
+	s.runDue(context.Background(), now)
+	s.wg.Wait()
+}
+
+func TestJobsStatusFromLeader(t *testing.T) {
+	mr, client := newTestRedis(t)
+	cfg := Config{LeaderLease: testLease, Jobs: map[string]string{"test": "@every 1m"}}
+	ctx := context.Background()
+
+	newScheduler := func() *Scheduler {
+		s, err := New(client, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.Register("test", func(ctx context.Context) error { return errors.New("boom") })
+		return s
+	}
+	leader, follower := newScheduler(), newScheduler()
+
+	if !leader.renewLeadership(ctx) {
+		t.Fatal("scheduler did not become leader")
+	}
+	runNow(leader)
+
+	status, err := follower.JobsStatus(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Leader || status.LeaderInstance != leader.lease.id {
+		t.Errorf("follower status leader = %v, %q, want false, %q", status.Leader, status.LeaderInstance, leader.lease.id)
+	}
+	if len(status.Jobs) != 1 {
+		t.Fatalf("follower sees %d jobs, want 1", len(status.Jobs))
+	}
+	job := status.Jobs[0]
+	if job.Runs != 1 || job.Failures != 1 || job.LastError != "boom" || job.Running || job.NextRunAt == nil {
+		t.Errorf("follower sees job status %+v, want one failed run", job)
+	}
+
+	// Новый лидер продолжает счетчики прошлого
+	mr.FastForward(testLease)
+	if !follower.renewLeadership(ctx) {
+		t.Fatal("follower did not take over an expired lease")
+	}
+	if leader.renewLeadership(ctx) {
+		t.Fatal("old leader kept leadership")
+	}
+	runNow(follower)
+
+	status, err = leader.JobsStatus(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job := status.Jobs[0]; job.Runs != 2 || job.Failures != 2 {
+		t.Errorf("old leader sees job status %+v, want two runs", job)
+	}
+}
@@ -0,0 +1,381 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ArtemChadaev/go"
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// Аренда лидерства по умолчанию, продлевается каждую треть срока
+	defaultLeaderLease = 30 * time.Second
+	// Как часто проверяем, не пора ли запускать задачи
+	schedulerTick = time.Second
+	// Состояние задач: пишет лидер, читает любая реплика
+	jobsStatusKey = "scheduler:jobs"
+	// Сколько ждем Redis при сохранении состояния
+	statusSaveTimeout = 5 * time.Second
+)
+
+// Состояние пишет только владелец аренды, иначе бывший лидер затрет запуски нового
+var saveStatusScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("HSET", KEYS[2], unpack(ARGV, 2))
+end
+return 0`)
+
+// Метрики: 1 - эта реплика лидер; по каждой задаче runs, failures, lastDurationMs.
+var (
+	schedulerLeader = expvar.NewInt("scheduler_leader")
+	schedulerJobs   = expvar.NewMap("scheduler_jobs")
+)
+
+// Job фоновая задача. ctx отменяется при остановке сервиса или потере лидерства,
+// перед побочными эффектами задача проверяет аренду через EnsureLeader.
+type Job func(ctx context.Context) error
+
+// Config секция scheduler из конфига.
+type Config struct {
+	LeaderLease time.Duration `mapstructure:"leaderLease"`
+	// Расписание по имени задачи, см. ParseSpec. Задача без расписания не запускается
+	Jobs map[string]string `mapstructure:"jobs"`
+}
+
+type job struct {
+	name     string
+	spec     string
+	schedule Schedule
+	run      Job
+	metrics  *expvar.Map
+	duration expvar.Int
+
+	status rest.JobStatus
+}
+
+// Scheduler запускает задачи по расписанию. Реплик может быть несколько,
+// задачи выполняет только та, что держит аренду лидерства в Redis.
+type Scheduler struct {
+	redis *redis.Client
+	lease *leaderLease
+	specs map[string]string
+
+	mu     sync.Mutex
+	jobs   []*job
+	leader bool
+	wg     sync.WaitGroup
+}
+
+// New проверяет расписания из конфига.
+func New(redis *redis.Client, cfg Config) (*Scheduler, error) {
+	for name, spec := range cfg.Jobs {
+		if _, err := ParseSpec(spec); err != nil {
+			return nil, fmt.Errorf("job %s: %w", name, err)
+		}
+	}
+	if cfg.LeaderLease <= 0 {
+		cfg.LeaderLease = defaultLeaderLease
+	}
+
+	return &Scheduler{
+		redis: redis,
+		lease: newLeaderLease(redis, cfg.LeaderLease),
+		specs: cfg.Jobs,
+	}, nil
+}
+
+// Register добавляет задачу с расписанием из конфига. Вызывается до Run.
+func (s *Scheduler) Register(name string, run Job) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	j := &job{
+		name:    name,
+		spec:    s.specs[name],
+		run:     run,
+		metrics: new(expvar.Map).Init(),
+		status:  rest.JobStatus{Name: name, Spec: s.specs[name]},
+	}
+	if j.spec == "" {
+		logrus.Warnf("scheduler: job %s has no schedule and is disabled", name)
+	} else {
+		// Расписание уже проверено в New
+		j.schedule, _ = ParseSpec(j.spec)
+	}
+	j.metrics.Set("lastDurationMs", &j.duration)
+	schedulerJobs.Set(name, j.metrics)
+	s.jobs = append(s.jobs, j)
+}
+
+// Run выполняет задачи, пока не отменен ctx, затем ждет запущенные задачи и отдает лидерство.
+func (s *Scheduler) Run(ctx context.Context) {
+	for name := range s.specs {
+		if !s.registered(name) {
+			logrus.Warnf("scheduler: unknown job %s in config", name)
+		}
+	}
+
+	// Контекст задач живет, пока реплика остается лидером
+	jobsCtx, cancelJobs := context.WithCancel(ctx)
+	ticker := time.NewTicker(schedulerTick)
+	defer ticker.Stop()
+
+	var lastRenew time.Time
+	for {
+		if time.Since(lastRenew) >= s.lease.ttl/3 {
+			lastRenew = time.Now()
+			if s.renewLeadership(ctx) {
+				if jobsCtx.Err() != nil {
+					jobsCtx, cancelJobs = context.WithCancel(ctx)
+				}
+			} else {
+				cancelJobs()
+			}
+		}
+		if s.isLeader() {
+			s.runDue(jobsCtx, time.Now())
+		}
+
+		select {
+		case <-ctx.Done():
+			cancelJobs()
+			s.wg.Wait()
+			s.stop()
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// renewLeadership берет или продлевает аренду. При ошибке Redis лидерство теряется:
+// без аренды нельзя быть уверенным, что задачи не выполняет кто-то еще.
+func (s *Scheduler) renewLeadership(ctx context.Context) bool {
+	s.mu.Lock()
+	wasLeader := s.leader
+	s.mu.Unlock()
+
+	leader, err := s.lease.acquire(ctx, wasLeader)
+	if ctx.Err() != nil {
+		// Сервис останавливается, аренду отпустит stop
+		return wasLeader
+	}
+	if err != nil {
+		logrus.Errorf("scheduler: can't renew leadership: %v", err)
+	}
+	var stored map[string]rest.JobStatus
+	if leader && !wasLeader {
+		// Счетчики и время запусков продолжаются с того места, где остановился прошлый лидер
+		if stored, err = s.loadStatus(ctx); err != nil {
+			logrus.Errorf("scheduler: can't load jobs status: %v", err)
+		}
+	}
+
+	s.mu.Lock()
+	s.leader = leader
+	if leader == wasLeader {
+		s.mu.Unlock()
+		return leader
+	}
+	var statuses []rest.JobStatus
+	if leader {
+		logrus.Infof("scheduler: %s became leader", s.lease.id)
+		schedulerLeader.Set(1)
+		// Отсчет расписания начинается заново, как будто задачи только что зарегистрированы
+		now := time.Now()
+		for _, j := range s.jobs {
+			if status, ok := stored[j.name]; ok {
+				j.status = status
+				j.status.Spec = j.spec
+				j.status.Running = false
+			}
+			j.status.NextRunAt = nil
+			if j.schedule != nil {
+				next := j.schedule.Next(now)
+				j.status.NextRunAt = &next
+			}
+			statuses = append(statuses, j.status)
+		}
+	} else {
+		logrus.Warnf("scheduler: %s lost leadership", s.lease.id)
+		schedulerLeader.Set(0)
+		for _, j := range s.jobs {
+			j.status.NextRunAt = nil
+		}
+	}
+	s.mu.Unlock()
+
+	s.saveStatus(statuses...)
+	return leader
+}
+
+// runDue запускает задачи, время которых пришло. Задача, которая еще выполняется, не запускается повторно.
+func (s *Scheduler) runDue(ctx context.Context, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, j := range s.jobs {
+		if j.status.NextRunAt == nil || j.status.Running || now.Before(*j.status.NextRunAt) {
+			continue
+		}
+		next := j.schedule.Next(now)
+		j.status.NextRunAt = &next
+		j.status.Running = true
+		j.status.LastStartedAt = &now
+
+		s.wg.Add(1)
+		go s.execute(context.WithValue(ctx, leaseCtxKey{}, s.lease), j, j.status)
+	}
+}
+
+// execute выполняет задачу. Состояние сохраняется здесь же, до и после запуска, чтобы записи не обгоняли друг друга.
+func (s *Scheduler) execute(ctx context.Context, j *job, status rest.JobStatus) {
+	defer s.wg.Done()
+	s.saveStatus(status)
+
+	err := runJob(ctx, j)
+	finished := time.Now()
+	duration := finished.Sub(*status.LastStartedAt)
+
+	s.mu.Lock()
+	defer func() {
+		status := j.status
+		s.mu.Unlock()
+		s.saveStatus(status)
+	}()
+	j.status.Running = false
+	j.status.LastFinishedAt = &finished
+	j.status.LastDurationMs = duration.Milliseconds()
+	j.status.Runs++
+	j.metrics.Add("runs", 1)
+	j.duration.Set(duration.Milliseconds())
+	if err != nil {
+		j.status.LastError = err.Error()
+		j.status.Failures++
+		j.metrics.Add("failures", 1)
+		logrus.Errorf("scheduler: job %s failed after %v: %v", j.name, duration, err)
+		return
+	}
+	j.status.LastError = ""
+	logrus.Infof("scheduler: job %s done in %v", j.name, duration)
+}
+
+// runJob выполняет задачу, паника считается ошибкой и не роняет сервис.
+func runJob(ctx context.Context, j *job) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return j.run(ctx)
+}
+
+func (s *Scheduler) stop() {
+	s.mu.Lock()
+	leader := s.leader
+	s.leader = false
+	s.mu.Unlock()
+	if !leader {
+		return
+	}
+
+	schedulerLeader.Set(0)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.lease.release(ctx); err != nil {
+		logrus.Errorf("scheduler: can't release leadership: %v", err)
+	}
+	logrus.Infof("scheduler: %s stopped", s.lease.id)
+}
+
+func (s *Scheduler) isLeader() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.leader
+}
+
+func (s *Scheduler) registered(name string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, j := range s.jobs {
+		if j.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// saveStatus сохраняет состояние задач в Redis, пока реплика держит аренду.
+// Ошибка только логируется: от нее зависит только админка.
+func (s *Scheduler) saveStatus(statuses ...rest.JobStatus) {
+	if len(statuses) == 0 {
+		return
+	}
+	args := []any{s.lease.id}
+	for _, status := range statuses {
+		data, _ := json.Marshal(status)
+		args = append(args, status.Name, data)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), statusSaveTimeout)
+	defer cancel()
+	if err := saveStatusScript.Run(ctx, s.redis, []string{leaderKey, jobsStatusKey}, args...).Err(); err != nil {
+		logrus.Errorf("scheduler: can't save jobs status: %v", err)
+	}
+}
+
+// loadStatus состояние задач, сохраненное лидером.
+func (s *Scheduler) loadStatus(ctx context.Context) (map[string]rest.JobStatus, error) {
+	values, err := s.redis.HGetAll(ctx, jobsStatusKey).Result()
+	if err != nil {
+		return nil, err
+	}
+	statuses := make(map[string]rest.JobStatus, len(values))
+	for name, data := range values {
+		var status rest.JobStatus
+		if err := json.Unmarshal([]byte(data), &status); err != nil {
+			return nil, fmt.Errorf("job %s: %w", name, err)
+		}
+		statuses[name] = status
+	}
+	return statuses, nil
+}
+
+// JobsStatus состояние планировщика и задач для админки. Задачи выполняет лидер,
+// остальные реплики показывают состояние, которое он сохранил в Redis.
+func (s *Scheduler) JobsStatus(ctx context.Context) (rest.SchedulerStatus, error) {
+	stored, err := s.loadStatus(ctx)
+	if err != nil {
+		return rest.SchedulerStatus{}, err
+	}
+	leaderId, err := s.redis.Get(ctx, leaderKey).Result()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return rest.SchedulerStatus{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	status := rest.SchedulerStatus{
+		Instance:       s.lease.id,
+		Leader:         s.leader,
+		LeaderInstance: leaderId,
+		Jobs:           make([]rest.JobStatus, 0, len(s.jobs)),
+	}
+	for _, j := range s.jobs {
+		job, ok := stored[j.name]
+		if s.leader || !ok {
+			job = j.status
+		}
+		status.Jobs = append(status.Jobs, job)
+	}
+	sort.Slice(status.Jobs, func(i, k int) bool { return status.Jobs[i].Name < status.Jobs[k].Name })
+	return status, nil
+}
@@ -0,0 +1,80 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseSpecErrors(t *testing.T) {
+	specs := []string{
+		"",
+		"@every",
+		"@every x",
+		"@every 500ms",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"a * * * *",
+		"1-x * * * *",
+		"1,,2 * * * *",
+	}
+	for _, spec := range specs {
+		if _, err := ParseSpec(spec); err == nil {
+			t.Errorf("ParseSpec(%q) accepted an invalid spec", spec)
+		}
+	}
+}
+
+func TestScheduleNext(t *testing.T) {
+	// 1 января 2026 - четверг
+	date := func(month time.Month, day, hour, min int) time.Time {
+		return time.Date(2026, month, day, hour, min, 0, 0, time.UTC)
+	}
+	moscow := time.FixedZone("MSK", 3*60*60)
+
+	tests := []struct {
+		spec  string
+		after time.Time
+		want  time.Time
+	}{
+		{"@every 10m", date(1, 1, 10, 7).Add(30 * time.Second), date(1, 1, 10, 17).Add(30 * time.Second)},
+		{" @every  1h ", date(1, 1, 10, 0), date(1, 1, 11, 0)},
+		{"*/15 * * * *", date(1, 1, 10, 7).Add(30 * time.Second), date(1, 1, 10, 15)},
+		// Следующий запуск строго позже after
+		{"5 10 * * *", date(1, 1, 10, 5), date(1, 2, 10, 5)},
+		{"0-30/10 * * * *", date(1, 1, 10, 31), date(1, 1, 11, 0)},
+		{"10/20 * * * *", date(1, 1, 10, 31), date(1, 1, 10, 50)},
+		{"0 9,18 * * *", date(1, 1, 9, 0), date(1, 1, 18, 0)},
+		// Пятница вечер - следующий будний день понедельник
+		{"0 */6 * * 1-5", date(1, 2, 19, 0), date(1, 5, 0, 0)},
+		// 7 - тоже воскресенье
+		{"30 8 * * 7", date(1, 1, 0, 0), date(1, 4, 8, 30)},
+		{"30 8 * * 0", date(1, 1, 0, 0), date(1, 4, 8, 30)},
+		// Заданы оба дня - подходит любой
+		{"0 12 10 * 0", date(1, 1, 13, 0), date(1, 4, 12, 0)},
+		{"0 12 2 * 0", date(1, 1, 13, 0), date(1, 2, 12, 0)},
+		{"0 0 1 1 *", date(6, 1, 0, 0), time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", date(1, 1, 0, 0), time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 0 31 * *", date(2, 1, 0, 0), date(3, 31, 0, 0)},
+		// Cron считается по UTC
+		{"0 0 * * *", time.Date(2026, 1, 1, 2, 0, 0, 0, moscow), date(1, 1, 0, 0)},
+		// Невозможное расписание никогда не наступает
+		{"0 0 31 2 *", date(1, 1, 0, 0), time.Time{}},
+	}
+	for _, tt := range tests {
+		schedule, err := ParseSpec(tt.spec)
+		if err != nil {
+			t.Errorf("ParseSpec(%q): %v", tt.spec, err)
+			continue
+		}
+		if got := schedule.Next(tt.after); !got.Equal(tt.want) {
+			t.Errorf("%q.Next(%v) = %v, want %v", tt.spec, tt.after, got, tt.want)
+		}
+	}
+}
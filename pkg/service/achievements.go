@@ -0,0 +1,208 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ArtemChadaev/go"
+	"github.com/ArtemChadaev/go/pkg/repository"
+	"github.com/ArtemChadaev/go/pkg/scheduler"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// Группа обработчиков потока событий, которая открывает достижения
+const achievementsGroup = "achievements"
+
+// Длина кода достижения ограничена колонкой user_achievements.code
+const maxAchievementCodeLength = 64
+
+// События, по которым можно задавать условия достижений
+var achievementEvents = map[string]bool{
+	rest.EventUserRegistered:        true,
+	rest.EventDailyRewardClaimed:    true,
+	rest.EventCoinsEarned:           true,
+	rest.EventSubscriptionPurchased: true,
+	rest.EventClanJoined:            true,
+}
+
+// AchievementsConfig секция achievements из конфига.
+type AchievementsConfig struct {
+	// Файл каталога достижений, YAML или JSON
+	CatalogFile string `mapstructure:"catalog"`
+	// Загруженный каталог, см. LoadAchievementCatalog
+	Catalog []rest.Achievement `mapstructure:"-"`
+}
+
+// LoadAchievementCatalog читает и проверяет каталог достижений. Формат определяется по расширению файла.
+func LoadAchievementCatalog(path string) ([]rest.Achievement, error) {
+	v := viper.New()
+	v.SetConfigFile(path)
+	if err := v.ReadInConfig(); err != nil {
+		return nil, err
+	}
+
+	var catalog []rest.Achievement
+	if err := v.UnmarshalKey("achievements", &catalog); err != nil {
+		return nil, err
+	}
+
+	codes := make(map[string]bool, len(catalog))
+	for _, achievement := range catalog {
+		switch {
+		case achievement.Code == "" || len(achievement.Code) > maxAchievementCodeLength:
+			return nil, fmt.Errorf("achievement code %q must be 1-%d characters", achievement.Code, maxAchievementCodeLength)
+		case codes[achievement.Code]:
+			return nil, fmt.Errorf("duplicate achievement %q", achievement.Code)
+		case achievement.Coins < 0:
+			return nil, fmt.Errorf("achievement %q: coins must not be negative", achievement.Code)
+		case len(achievement.Conditions) == 0:
+			return nil, fmt.Errorf("achievement %q has no conditions", achievement.Code)
+		}
+		for _, condition := range achievement.Conditions {
+			if !achievementEvents[condition.Event] {
+				return nil, fmt.Errorf("achievement %q: unknown event %q", achievement.Code, condition.Event)
+			}
+		}
+		codes[achievement.Code] = true
+	}
+	return catalog, nil
+}
+
+type AchievementService struct {
+	repo    repository.Achievements
+	coins   Coins
+	events  Events
+	catalog []rest.Achievement
+}
+
+func NewAchievementService(repo repository.Achievements, coins Coins, events Events, catalog []rest.Achievement) *AchievementService {
+	service := &AchievementService{
+		repo:    repo,
+		coins:   coins,
+		events:  events,
+		catalog: catalog,
+	}
+
+	if len(catalog) > 0 {
+		events.Subscribe(achievementsGroup, service.handleEvent)
+	}
+
+	return service
+}
+
+// conditionMet проверяет условие по статистике пользователя.
+func conditionMet(condition rest.AchievementCondition, counter rest.AchievementCounter) bool {
+	return counter.Count > 0 &&
+		counter.Count >= condition.Count &&
+		counter.Total >= condition.Total &&
+		counter.MaxValue >= condition.Value
+}
+
+// handleEvent учитывает событие и открывает достижения, условия которых теперь выполнены.
+// Повторная обработка того же события ничего не меняет.
+func (s *AchievementService) handleEvent(event rest.Event) error {
+	if !achievementEvents[event.Type] {
+		return nil
+	}
+
+	counters, err := s.repo.ApplyAchievementEvent(event)
+	if err != nil {
+		return err
+	}
+	stats := make(map[string]rest.AchievementCounter, len(counters))
+	for _, counter := range counters {
+		stats[counter.Event] = counter
+	}
+
+	unlocked, err := s.unlockedAchievements(event.UserID)
+	if err != nil {
+		return err
+	}
+
+	for _, achievement := range s.catalog {
+		if _, ok := unlocked[achievement.Code]; ok {
+			continue
+		}
+		met, related := true, false
+		for _, condition := range achievement.Conditions {
+			related = related || condition.Event == event.Type
+			met = met && conditionMet(condition, stats[condition.Event])
+		}
+		// Достижение проверяем только по событиям из его условий
+		if !related || !met {
+			continue
+		}
+		if err := s.unlock(event.UserID, achievement); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// unlock выдает награду и отмечает достижение открытым.
+// Награда выдается первой: журнал монет не даст выдать ее дважды, если открыть достижение не получилось.
+func (s *AchievementService) unlock(userId int, achievement rest.Achievement) error {
+	if achievement.Coins > 0 {
+		_, err := s.coins.ChangeCoins(userId, achievement.Coins, rest.CoinReasonAchievement, achievement.Code)
+		if err != nil && !errors.Is(err, rest.ErrCoinTransactionExists) {
+			return err
+		}
+	}
+	_, err := s.repo.UnlockAchievement(userId, achievement.Code)
+	return err
+}
+
+func (s *AchievementService) unlockedAchievements(userId int) (map[string]rest.UserAchievement, error) {
+	achievements, err := s.repo.GetUserAchievements(userId)
+	if err != nil {
+		return nil, err
+	}
+	unlocked := make(map[string]rest.UserAchievement, len(achievements))
+	for _, achievement := range achievements {
+		unlocked[achievement.Code] = achievement
+	}
+	return unlocked, nil
+}
+
+// GetAchievements возвращает каталог достижений с отметками, какие открыты пользователем.
+func (s *AchievementService) GetAchievements(userId int) ([]rest.AchievementStatus, error) {
+	unlocked, err := s.unlockedAchievements(userId)
+	if err != nil {
+		return nil, rest.NewInternalServerError(err)
+	}
+
+	achievements := make([]rest.AchievementStatus, 0, len(s.catalog))
+	for _, achievement := range s.catalog {
+		status := rest.AchievementStatus{Achievement: achievement}
+		if userAchievement, ok := unlocked[achievement.Code]; ok {
+			status.Unlocked = true
+			status.UnlockedAt = &userAchievement.UnlockedAt
+		}
+		achievements = append(achievements, status)
+	}
+	return achievements, nil
+}
+
+// PruneProcessedEvents удаляет отметки об учтенных событиях, которые уже обрезаны из потока:
+// повторно такие события не придут. Отметка ставится после публикации события,
+// поэтому отметка события, которое еще есть в потоке, не старше самого старого события потока.
+func (s *AchievementService) PruneProcessedEvents(ctx context.Context) error {
+	since, err := s.events.RetainedSince(ctx)
+	if err != nil {
+		return err
+	}
+	if err := scheduler.EnsureLeader(ctx); err != nil {
+		return err
+	}
+	deleted, err := s.repo.DeleteProcessedEventsBefore(since)
+	if err != nil {
+		return err
+	}
+	if deleted > 0 {
+		logrus.Infof("achievements: pruned %d processed events before %s", deleted, since.Format(time.RFC3339))
+	}
+	return nil
+}
@@ -14,6 +14,7 @@ import (
 	"github.com/ArtemChadaev/go/pkg/repository"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/lib/pq"
+	"github.com/sirupsen/logrus"
 )
 
 const (
@@ -37,12 +38,17 @@ type tokenClaims struct {
 type AuthService struct {
 	repo            repository.Autorization
 	settingsService UserSettings
+	referrals       *ReferralService
+	events          Events
 }
 
-func NewAuthService(repo repository.Autorization, settingsService UserSettings) *AuthService {
+func NewAuthService(repo repository.Autorization, settingsService UserSettings, referrals *ReferralService,
+	events Events) *AuthService {
 	return &AuthService{
 		repo:            repo,
 		settingsService: settingsService,
+		referrals:       referrals,
+		events:          events,
 	}
 }
 
@@ -78,9 +84,21 @@ func GenerateRefresh(userId int) (refresh rest.RefreshToken, err error) {
 	return
 }
 
-func (s *AuthService) CreateUser(user rest.User) (int, error) {
+// CreateUser регистрирует пользователя. Пользователь, его настройки и приглашение, если указан
+// реферальный код, создаются одной транзакцией.
+func (s *AuthService) CreateUser(user rest.User, signUp rest.ReferralSignUp) (int, error) {
+	// Неверный код лучше показать сразу, пока пользователь еще не создан
+	var referral *rest.Referral
+	if user.ReferralCode != "" {
+		var err error
+		if referral, err = s.referrals.newReferral(user.ReferralCode, signUp); err != nil {
+			return 0, err
+		}
+	}
+
 	user.Password = generatePasswordHash(user.Password)
-	id, err := s.repo.CreateUser(user)
+	settings := s.settingsService.InitialUserSettings(strings.Split(user.Email, "@")[0])
+	id, err := s.repo.CreateUser(user, settings, referral, s.referrals.limits())
 	if err != nil {
 		var pqErr *pq.Error
 		if errors.As(err, &pqErr) && pqErr.Code == "23505" {
@@ -88,9 +106,11 @@ func (s *AuthService) CreateUser(user rest.User) (int, error) {
 		}
 		return 0, rest.NewInternalServerError(err)
 	}
-	if err := s.settingsService.CreateInitialUserSettings(id, strings.Split(user.Email, "@")[0]); err != nil {
-		return 0, rest.NewInternalServerError(err)
+	if referral != nil && referral.RejectReason != nil {
+		logrus.Warnf("referral of user %d by %d rejected: %s", id, referral.ReferrerID, *referral.RejectReason)
 	}
+
+	s.events.Publish(rest.Event{Type: rest.EventUserRegistered, UserID: id})
 	return id, nil
 }
 
@@ -219,3 +239,11 @@ func (s *AuthService) UnAuthorizeAll(email, password string) error {
 	err = s.repo.DeleteAllUserRefreshTokens(id)
 	return err
 }
+
+func (s *AuthService) IsAdmin(userId int) (bool, error) {
+	isAdmin, err := s.repo.IsAdmin(userId)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return false, rest.NewInternalServerError(err)
+	}
+	return isAdmin, nil
+}
@@ -0,0 +1,605 @@
+package service
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/ArtemChadaev/go"
+	"github.com/ArtemChadaev/go/pkg/repository"
+	"github.com/lib/pq"
+)
+
+const (
+	// Длина имени клана в символах
+	clanNameMinLength = 3
+	clanNameMaxLength = 32
+	// Ограничения описания и произвольных данных клана
+	clanDescriptionMaxLength = 1000
+	clanMetadataMaxSize      = 4096
+	// Длина названия роли ограничена колонкой clan_role_names.custom_name
+	clanRoleNameMaxLength = 20
+)
+
+// Права ролей, пока клан их не изменил. Младшие роли прав не имеют, у главы есть все права.
+var defaultClanPermissions = map[int]rest.ClanPermissions{
+	2: {Invite: true, Kick: true, EditDescription: true, ManageRoles: true},
+	3: {Invite: true},
+}
+
+// Все права, их всегда имеет глава
+var allClanPermissions = rest.ClanPermissions{Invite: true, Kick: true, EditDescription: true, SpendTreasury: true,
+	ManageRoles: true}
+
+// ClansConfig секция clans из конфига.
+type ClansConfig struct {
+	// Сколько человек может быть в клане, подписка главы может поднять лимит (clanMemberLimit)
+	MemberLimit int `mapstructure:"memberLimit"`
+	// Слова, запрещенные в названиях ролей
+	BannedWords []string `mapstructure:"bannedWords"`
+	// Обычные слова, в которых встречается запрещенное
+	AllowedWords []string `mapstructure:"allowedWords"`
+}
+
+type ClanService struct {
+	repo        repository.Clan
+	settings    UserSettings
+	leaderboard Leaderboard
+	events      Events
+	profanity   *profanityFilter
+	cfg         ClansConfig
+}
+
+func NewClanService(repo repository.Clan, settings UserSettings, leaderboard Leaderboard, events Events,
+	cfg ClansConfig) *ClanService {
+	return &ClanService{
+		repo:        repo,
+		settings:    settings,
+		leaderboard: leaderboard,
+		events:      events,
+		profanity:   newProfanityFilter(cfg.BannedWords, cfg.AllowedWords),
+		cfg:         cfg,
+	}
+}
+
+// CreateClan создает клан, создатель становится его главой. Состоять можно только в одном клане.
+func (s *ClanService) CreateClan(userId int, input rest.ClanInput) (rest.Clan, error) {
+	name := strings.TrimSpace(input.Name)
+	if length := utf8.RuneCountInString(name); length < clanNameMinLength || length > clanNameMaxLength {
+		return rest.Clan{}, rest.ErrInvalidClanName
+	}
+	clan := rest.Clan{Name: name}
+	if err := applyClanInfo(&clan, input.Description, input.Other); err != nil {
+		return rest.Clan{}, err
+	}
+
+	clan, err := s.repo.CreateClan(clan, userId)
+	if err != nil {
+		return rest.Clan{}, clanError(err)
+	}
+	s.joined(userId, clan.ID)
+	return clan, nil
+}
+
+func (s *ClanService) GetClan(clanId int) (rest.Clan, error) {
+	clan, err := s.repo.GetClan(clanId)
+	if err != nil {
+		return rest.Clan{}, clanError(err)
+	}
+	return clan, nil
+}
+
+// UpdateClan меняет описание и данные клана, нужно право editDescription.
+func (s *ClanService) UpdateClan(userId, clanId int, input rest.ClanUpdateInput) (rest.Clan, error) {
+	clan, err := s.repo.GetClan(clanId)
+	if err != nil {
+		return rest.Clan{}, clanError(err)
+	}
+	if err := s.requireClanPermission(clanId, userId, rest.ClanPermissionEditDescription); err != nil {
+		return rest.Clan{}, err
+	}
+
+	if err := applyClanInfo(&clan, input.Description, input.Other); err != nil {
+		return rest.Clan{}, err
+	}
+	if err := s.repo.UpdateClan(clan); err != nil {
+		return rest.Clan{}, rest.NewInternalServerError(err)
+	}
+	return clan, nil
+}
+
+// DisbandClan распускает клан, доступно главе клана.
+func (s *ClanService) DisbandClan(userId, clanId int) error {
+	if _, err := s.repo.GetClan(clanId); err != nil {
+		return clanError(err)
+	}
+	if err := s.requireClanRole(clanId, userId, rest.ClanRoleLeader); err != nil {
+		return err
+	}
+
+	if err := s.repo.DeleteClan(clanId); err != nil {
+		return rest.NewInternalServerError(err)
+	}
+	s.leaderboard.DeleteClanLeaderboards(clanId)
+	return nil
+}
+
+// GetClanMembers участники клана, старшие роли сначала.
+func (s *ClanService) GetClanMembers(clanId int) ([]rest.ClanMember, error) {
+	if _, err := s.repo.GetClan(clanId); err != nil {
+		return nil, clanError(err)
+	}
+	members, err := s.repo.GetClanMembers(clanId)
+	if err != nil {
+		return nil, rest.NewInternalServerError(err)
+	}
+	return members, nil
+}
+
+// InviteToClan приглашает пользователя в клан, нужно право invite.
+func (s *ClanService) InviteToClan(userId, clanId, inviteeId int) (rest.ClanInvite, error) {
+	if _, err := s.repo.GetClan(clanId); err != nil {
+		return rest.ClanInvite{}, clanError(err)
+	}
+	if err := s.requireClanPermission(clanId, userId, rest.ClanPermissionInvite); err != nil {
+		return rest.ClanInvite{}, err
+	}
+	if err := s.requireNoClan(inviteeId); err != nil {
+		return rest.ClanInvite{}, err
+	}
+
+	invite, err := s.repo.CreateClanInvite(rest.ClanInvite{
+		ClanID:    clanId,
+		UserID:    inviteeId,
+		Kind:      rest.ClanInviteKindInvite,
+		InvitedBy: &userId,
+	})
+	if err != nil {
+		return rest.ClanInvite{}, clanError(err)
+	}
+	return invite, nil
+}
+
+// RequestToJoinClan заявка пользователя на вступление в клан.
+func (s *ClanService) RequestToJoinClan(userId, clanId int) (rest.ClanInvite, error) {
+	if _, err := s.repo.GetClan(clanId); err != nil {
+		return rest.ClanInvite{}, clanError(err)
+	}
+	if err := s.requireNoClan(userId); err != nil {
+		return rest.ClanInvite{}, err
+	}
+
+	invite, err := s.repo.CreateClanInvite(rest.ClanInvite{
+		ClanID: clanId,
+		UserID: userId,
+		Kind:   rest.ClanInviteKindRequest,
+	})
+	if err != nil {
+		return rest.ClanInvite{}, clanError(err)
+	}
+	return invite, nil
+}
+
+// GetClanInvites приглашения и заявки клана, видны с правом invite.
+func (s *ClanService) GetClanInvites(userId, clanId int) ([]rest.ClanInvite, error) {
+	if err := s.requireClanPermission(clanId, userId, rest.ClanPermissionInvite); err != nil {
+		return nil, err
+	}
+	invites, err := s.repo.GetClanInvites(clanId)
+	if err != nil {
+		return nil, rest.NewInternalServerError(err)
+	}
+	return invites, nil
+}
+
+// GetMyClanInvites приглашения пользователя и его заявки.
+func (s *ClanService) GetMyClanInvites(userId int) ([]rest.ClanInvite, error) {
+	invites, err := s.repo.GetUserClanInvites(userId)
+	if err != nil {
+		return nil, rest.NewInternalServerError(err)
+	}
+	return invites, nil
+}
+
+// AcceptClanInvite приглашение принимает приглашенный, заявку - участник с правом invite.
+// Пользователь вступает с младшей ролью, если в клане есть место.
+func (s *ClanService) AcceptClanInvite(userId, inviteId int) error {
+	invite, err := s.getInvite(userId, inviteId)
+	if err != nil {
+		return err
+	}
+	if invite.Kind == rest.ClanInviteKindInvite && invite.UserID != userId {
+		return rest.ErrClanInviteNotFound
+	}
+	if invite.Kind == rest.ClanInviteKindRequest {
+		if err := s.requireClanPermission(invite.ClanID, userId, rest.ClanPermissionInvite); err != nil {
+			return err
+		}
+	}
+
+	limit, err := s.memberLimit(invite.ClanID)
+	if err != nil {
+		return err
+	}
+	if err := s.repo.AcceptClanInvite(invite, limit); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return rest.ErrClanInviteNotFound
+		}
+		return clanError(err)
+	}
+	s.joined(invite.UserID, invite.ClanID)
+	return nil
+}
+
+// DeclineClanInvite отклоняет приглашение или заявку. Отклонить может сам пользователь
+// (отказаться от приглашения или отозвать заявку), а также участник клана с правом invite.
+func (s *ClanService) DeclineClanInvite(userId, inviteId int) error {
+	invite, err := s.getInvite(userId, inviteId)
+	if err != nil {
+		return err
+	}
+	if invite.UserID != userId {
+		if err := s.requireClanPermission(invite.ClanID, userId, rest.ClanPermissionInvite); err != nil {
+			return err
+		}
+	}
+
+	if err := s.repo.DeleteClanInvite(invite.ID); err != nil {
+		return rest.NewInternalServerError(err)
+	}
+	return nil
+}
+
+// getInvite приглашение, которое пользователь может видеть: свое или своего клана.
+func (s *ClanService) getInvite(userId, inviteId int) (rest.ClanInvite, error) {
+	invite, err := s.repo.GetClanInvite(inviteId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return invite, rest.ErrClanInviteNotFound
+	}
+	if err != nil {
+		return invite, rest.NewInternalServerError(err)
+	}
+	if invite.UserID == userId {
+		return invite, nil
+	}
+	if _, err := s.repo.GetClanMemberRole(invite.ClanID, userId); err != nil {
+		return invite, rest.ErrClanInviteNotFound
+	}
+	return invite, nil
+}
+
+// LeaveClan выход из клана. Глава должен сначала передать главенство или распустить клан.
+func (s *ClanService) LeaveClan(userId, clanId int) error {
+	roleId, err := s.repo.GetClanMemberRole(clanId, userId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return rest.ErrClanMemberNotFound
+	}
+	if err != nil {
+		return rest.NewInternalServerError(err)
+	}
+	if roleId == rest.ClanRoleLeader {
+		return rest.ErrClanLeaderCannotLeave
+	}
+
+	if err := s.repo.RemoveClanMember(clanId, userId, roleId); err != nil {
+		return clanMemberError(err)
+	}
+	s.leaderboard.TrackClanMembership(userId, clanId, false)
+	return nil
+}
+
+// KickClanMember исключение участника, который ниже рангом, нужно право kick.
+func (s *ClanService) KickClanMember(userId, clanId, memberId int) error {
+	userRole, memberRole, err := s.memberToManage(userId, clanId, memberId)
+	if err != nil {
+		return err
+	}
+	if err := s.requireRolePermission(clanId, userRole, rest.ClanPermissionKick); err != nil {
+		return err
+	}
+
+	if err := s.repo.RemoveClanMember(clanId, memberId, memberRole); err != nil {
+		return clanMemberError(err)
+	}
+	s.leaderboard.TrackClanMembership(memberId, clanId, false)
+	return nil
+}
+
+// PromoteClanMember повышает участника на одну роль, но только до роли ниже своей.
+// Исключение - глава может повысить заместителя до главы, тогда сам становится заместителем.
+func (s *ClanService) PromoteClanMember(userId, clanId, memberId int) (rest.ClanMember, error) {
+	userRole, memberRole, err := s.memberToManage(userId, clanId, memberId)
+	if err != nil {
+		return rest.ClanMember{}, err
+	}
+	if err := s.requireRolePermission(clanId, userRole, rest.ClanPermissionManageRoles); err != nil {
+		return rest.ClanMember{}, err
+	}
+
+	role := memberRole - 1
+	switch {
+	case role == rest.ClanRoleLeader && userRole == rest.ClanRoleLeader:
+		err = s.repo.TransferClanLeadership(clanId, userId, memberId)
+	case role <= userRole:
+		return rest.ClanMember{}, rest.ErrClanRoleTooLow
+	default:
+		err = s.repo.SetClanMemberRole(clanId, memberId, memberRole, role)
+	}
+	if err != nil {
+		return rest.ClanMember{}, clanMemberError(err)
+	}
+	return s.getMember(clanId, memberId)
+}
+
+// DemoteClanMember понижает участника, который ниже рангом, на одну роль.
+func (s *ClanService) DemoteClanMember(userId, clanId, memberId int) (rest.ClanMember, error) {
+	userRole, memberRole, err := s.memberToManage(userId, clanId, memberId)
+	if err != nil {
+		return rest.ClanMember{}, err
+	}
+	if err := s.requireRolePermission(clanId, userRole, rest.ClanPermissionManageRoles); err != nil {
+		return rest.ClanMember{}, err
+	}
+	if memberRole >= rest.ClanRoleLowest {
+		return rest.ClanMember{}, rest.ErrClanRoleOutOfRange
+	}
+
+	if err := s.repo.SetClanMemberRole(clanId, memberId, memberRole, memberRole+1); err != nil {
+		return rest.ClanMember{}, clanMemberError(err)
+	}
+	return s.getMember(clanId, memberId)
+}
+
+// memberToManage роли пользователя и участника, которым он хочет управлять.
+// Управлять можно только участниками строго ниже рангом (больший id роли).
+func (s *ClanService) memberToManage(userId, clanId, memberId int) (userRole, memberRole int, err error) {
+	userRole, err = s.repo.GetClanMemberRole(clanId, userId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, 0, rest.ErrForbidden
+	}
+	if err != nil {
+		return 0, 0, rest.NewInternalServerError(err)
+	}
+	memberRole, err = s.repo.GetClanMemberRole(clanId, memberId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, 0, rest.ErrClanMemberNotFound
+	}
+	if err != nil {
+		return 0, 0, rest.NewInternalServerError(err)
+	}
+	if memberRole <= userRole {
+		return 0, 0, rest.ErrClanMemberRankTooHigh
+	}
+	return userRole, memberRole, nil
+}
+
+func (s *ClanService) getMember(clanId, memberId int) (rest.ClanMember, error) {
+	members, err := s.repo.GetClanMembers(clanId)
+	if err != nil {
+		return rest.ClanMember{}, rest.NewInternalServerError(err)
+	}
+	for _, member := range members {
+		if member.UserID == memberId {
+			return member, nil
+		}
+	}
+	return rest.ClanMember{}, rest.ErrClanMemberNotFound
+}
+
+// memberLimit сколько человек может быть в клане: из конфига или больше, если это дает подписка главы.
+func (s *ClanService) memberLimit(clanId int) (int, error) {
+	leaderId, err := s.repo.GetClanLeaderId(clanId)
+	if err != nil {
+		return 0, clanError(err)
+	}
+	entitlements, err := s.settings.GetEntitlements(leaderId)
+	if err != nil {
+		return 0, err
+	}
+
+	limit := s.cfg.MemberLimit
+	if entitlements.Active {
+		limit = max(limit, entitlements.Perks.Limit(rest.PerkClanMemberLimit))
+	}
+	return limit, nil
+}
+
+// joined обновляет рейтинги клана и сообщает о вступлении.
+func (s *ClanService) joined(userId, clanId int) {
+	s.leaderboard.TrackClanMembership(userId, clanId, true)
+	s.events.Publish(rest.Event{
+		Type:   rest.EventClanJoined,
+		UserID: userId,
+	})
+}
+
+// requireNoClan пользователь не состоит ни в одном клане.
+func (s *ClanService) requireNoClan(userId int) error {
+	_, _, err := s.repo.GetUserClanRole(userId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return rest.NewInternalServerError(err)
+	}
+	return rest.ErrAlreadyInClan
+}
+
+// GetClanRoles роли клана с названиями и правами.
+func (s *ClanService) GetClanRoles(clanId int) ([]rest.ClanRole, error) {
+	if _, err := s.repo.GetClan(clanId); err != nil {
+		return nil, clanError(err)
+	}
+	roles, err := s.repo.GetClanRoles(clanId)
+	if err != nil {
+		return nil, rest.NewInternalServerError(err)
+	}
+	custom, err := s.repo.GetClanRolePermissions(clanId)
+	if err != nil {
+		return nil, rest.NewInternalServerError(err)
+	}
+
+	for i := range roles {
+		roles[i].Permissions = effectiveClanPermissions(roles[i].ID, custom)
+	}
+	return roles, nil
+}
+
+// UpdateClanRole глава задает название роли и ее права.
+func (s *ClanService) UpdateClanRole(userId, clanId, roleId int, input rest.ClanRoleInput) (rest.ClanRole, error) {
+	if roleId < rest.ClanRoleLeader || roleId > rest.ClanRoleLowest {
+		return rest.ClanRole{}, rest.ErrClanRoleNotFound
+	}
+	if _, err := s.repo.GetClan(clanId); err != nil {
+		return rest.ClanRole{}, clanError(err)
+	}
+	if err := s.requireClanRole(clanId, userId, rest.ClanRoleLeader); err != nil {
+		return rest.ClanRole{}, err
+	}
+
+	// Сначала проверяем весь запрос, чтобы не сохранить его наполовину
+	var name *string
+	if input.Name != nil {
+		trimmed := strings.TrimSpace(*input.Name)
+		if utf8.RuneCountInString(trimmed) > clanRoleNameMaxLength {
+			return rest.ClanRole{}, rest.ErrInvalidClanRoleName
+		}
+		if s.profanity.Contains(trimmed) {
+			return rest.ClanRole{}, rest.ErrClanRoleNameNotAllowed
+		}
+		name = &trimmed
+	}
+	if input.Permissions != nil && roleId == rest.ClanRoleLeader {
+		return rest.ClanRole{}, rest.ErrClanLeaderPermissions
+	}
+
+	if err := s.repo.UpdateClanRole(clanId, roleId, name, input.Permissions); err != nil {
+		return rest.ClanRole{}, rest.NewInternalServerError(err)
+	}
+
+	roles, err := s.GetClanRoles(clanId)
+	if err != nil {
+		return rest.ClanRole{}, err
+	}
+	for _, role := range roles {
+		if role.ID == roleId {
+			return role, nil
+		}
+	}
+	return rest.ClanRole{}, rest.ErrClanRoleNotFound
+}
+
+// requireClanPermission пользователь состоит в клане и его роль имеет право permission.
+func (s *ClanService) requireClanPermission(clanId, userId int, permission string) error {
+	roleId, err := s.repo.GetClanMemberRole(clanId, userId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return rest.ErrForbidden
+	}
+	if err != nil {
+		return rest.NewInternalServerError(err)
+	}
+
+	return s.requireRolePermission(clanId, roleId, permission)
+}
+
+// requireRolePermission роль roleId в клане имеет право permission.
+func (s *ClanService) requireRolePermission(clanId, roleId int, permission string) error {
+	permissions, err := s.rolePermissions(clanId, roleId)
+	if err != nil {
+		return err
+	}
+	if !permissions.Allows(permission) {
+		return rest.ErrClanPermissionDenied
+	}
+	return nil
+}
+
+// rolePermissions права роли в клане с учетом настроек клана.
+func (s *ClanService) rolePermissions(clanId, roleId int) (rest.ClanPermissions, error) {
+	custom, err := s.repo.GetClanRolePermissions(clanId)
+	if err != nil {
+		return rest.ClanPermissions{}, rest.NewInternalServerError(err)
+	}
+	return effectiveClanPermissions(roleId, custom), nil
+}
+
+// effectiveClanPermissions права роли: у главы все, иначе настроенные кланом или по умолчанию.
+func effectiveClanPermissions(roleId int, custom map[int]rest.ClanPermissions) rest.ClanPermissions {
+	if roleId == rest.ClanRoleLeader {
+		return allClanPermissions
+	}
+	if permissions, ok := custom[roleId]; ok {
+		return permissions
+	}
+	return defaultClanPermissions[roleId]
+}
+
+// requireClanRole пользователь состоит в клане и его роль не ниже role.
+func (s *ClanService) requireClanRole(clanId, userId, role int) error {
+	roleId, err := s.repo.GetClanMemberRole(clanId, userId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return rest.ErrForbidden
+	}
+	if err != nil {
+		return rest.NewInternalServerError(err)
+	}
+	if roleId > role {
+		return rest.ErrClanRoleTooLow
+	}
+	return nil
+}
+
+// applyClanInfo проверяет и применяет описание и данные клана. nil - не менять, пустое описание удаляет его.
+func applyClanInfo(clan *rest.Clan, description *string, other rest.ClanMetadata) error {
+	if description != nil {
+		text := strings.TrimSpace(*description)
+		if utf8.RuneCountInString(text) > clanDescriptionMaxLength {
+			return rest.ErrInvalidClanInfo
+		}
+		clan.Description = &text
+		if text == "" {
+			clan.Description = nil
+		}
+	}
+	if other != nil {
+		data, err := json.Marshal(other)
+		if err != nil {
+			return rest.NewInvalidRequestError(err)
+		}
+		if len(data) > clanMetadataMaxSize {
+			return rest.ErrInvalidClanInfo
+		}
+		clan.Other = other
+	}
+	return nil
+}
+
+func clanError(err error) error {
+	var pqErr *pq.Error
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return rest.ErrClanNotFound
+	case errors.Is(err, repository.ErrClanNameTaken):
+		return rest.ErrClanNameTaken
+	case errors.Is(err, repository.ErrAlreadyInClan):
+		return rest.ErrAlreadyInClan
+	case errors.Is(err, repository.ErrClanFull):
+		return rest.ErrClanFull
+	case errors.Is(err, repository.ErrClanInviteExists):
+		return rest.ErrClanInviteExists
+	case errors.As(err, &pqErr) && pqErr.Code == "23503":
+		// Приглашенного пользователя нет
+		return rest.ErrUserNotFound
+	}
+	return rest.NewInternalServerError(err)
+}
+
+// clanMemberError ошибки изменения участника: sql.ErrNoRows значит, что его роль успела измениться или он вышел.
+func clanMemberError(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return rest.ErrClanMemberNotFound
+	}
+	return rest.NewInternalServerError(err)
+}
@@ -0,0 +1,85 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/ArtemChadaev/go"
+	"github.com/ArtemChadaev/go/pkg/repository"
+)
+
+// fakeClanRepo один клан с ролями участников в памяти.
+type fakeClanRepo struct {
+	repository.Clan
+	roles       map[int]int
+	permissions map[int]rest.ClanPermissions
+}
+
+func (f *fakeClanRepo) GetClanMemberRole(_, userId int) (int, error) {
+	role, ok := f.roles[userId]
+	if !ok {
+		return 0, errors.New("not a member")
+	}
+	return role, nil
+}
+
+func (f *fakeClanRepo) GetClanRolePermissions(int) (map[int]rest.ClanPermissions, error) {
+	return f.permissions, nil
+}
+
+func (f *fakeClanRepo) SetClanMemberRole(_, userId, _, to int) error {
+	f.roles[userId] = to
+	return nil
+}
+
+func (f *fakeClanRepo) GetClanMembers(int) ([]rest.ClanMember, error) {
+	var members []rest.ClanMember
+	for userId, role := range f.roles {
+		members = append(members, rest.ClanMember{UserID: userId, RoleID: role})
+	}
+	return members, nil
+}
+
+func TestClanRoleChangesRequireManageRoles(t *testing.T) {
+	const (
+		officer = 1
+		member  = 2
+	)
+	tests := []struct {
+		name        string
+		officerRole int
+		permissions map[int]rest.ClanPermissions
+		wantErr     error
+	}{
+		{"default deputy can manage roles", 2, nil, nil},
+		{"default third role can not", 3, nil, rest.ErrClanPermissionDenied},
+		{"permission taken away", 2, map[int]rest.ClanPermissions{2: {Kick: true}}, rest.ErrClanPermissionDenied},
+		{"permission granted", 3, map[int]rest.ClanPermissions{3: {ManageRoles: true}}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &fakeClanRepo{roles: map[int]int{officer: tt.officerRole, member: rest.ClanRoleLowest},
+				permissions: tt.permissions}
+			s := &ClanService{repo: repo}
+
+			_, err := s.PromoteClanMember(officer, 1, member)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("promote error = %v, want %v", err, tt.wantErr)
+			}
+			wantRole := rest.ClanRoleLowest
+			if tt.wantErr == nil {
+				wantRole--
+			}
+			if repo.roles[member] != wantRole {
+				t.Errorf("member role after promote = %d, want %d", repo.roles[member], wantRole)
+			}
+
+			if _, err := s.DemoteClanMember(officer, 1, member); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("demote error = %v, want %v", err, tt.wantErr)
+			}
+			if repo.roles[member] != rest.ClanRoleLowest {
+				t.Errorf("member role after demote = %d, want %d", repo.roles[member], rest.ClanRoleLowest)
+			}
+		})
+	}
+}
@@ -0,0 +1,177 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/ArtemChadaev/go"
+	"github.com/ArtemChadaev/go/pkg/repository"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+const (
+	// Размер страницы истории монет по умолчанию и максимальный
+	defaultCoinHistoryLimit = 20
+	maxCoinHistoryLimit     = 100
+)
+
+// TransferConfig настройки переводов монет между пользователями.
+type TransferConfig struct {
+	// Сколько монет пользователь может отправить за сутки, 0 - без ограничений
+	DailyCap int `mapstructure:"dailyCap"`
+	// Комиссия в процентах от суммы, округляется вверх
+	FeePercent int `mapstructure:"feePercent"`
+	// Минимальная комиссия
+	MinFee int `mapstructure:"minFee"`
+}
+
+// fee считает комиссию за перевод amount монет.
+func (c TransferConfig) fee(amount int) int {
+	fee := (amount*c.FeePercent + 99) / 100
+	return max(fee, c.MinFee)
+}
+
+type CoinService struct {
+	repo         repository.Coins
+	settingsRepo repository.UserSettings
+	events       Events
+	transfer     TransferConfig
+}
+
+func NewCoinService(repo repository.Coins, settingsRepo repository.UserSettings, events Events,
+	transfer TransferConfig) *CoinService {
+	return &CoinService{
+		repo:         repo,
+		settingsRepo: settingsRepo,
+		events:       events,
+		transfer:     transfer,
+	}
+}
+
+// ChangeCoins добавляет (или списывает) монеты пользователю с записью в журнал.
+// referenceId делает операцию идемпотентной: повтор с тем же reason и referenceId отклоняется.
+func (s *CoinService) ChangeCoins(userId, amount int, reason, referenceId string) (rest.CoinTransaction, error) {
+	transaction := rest.CoinTransaction{
+		UserID: userId,
+		Amount: amount,
+		Reason: reason,
+	}
+	if referenceId != "" {
+		transaction.ReferenceID = &referenceId
+	}
+
+	transaction, err := s.repo.ChangeCoins(transaction)
+	if err != nil {
+		return transaction, coinsError(err)
+	}
+	s.events.CoinsChanged(transaction)
+	return transaction, nil
+}
+
+// TransferCoins переводит монеты от пользователя fromUserId получателю по id или имени.
+func (s *CoinService) TransferCoins(fromUserId int, input rest.CoinTransferInput) (rest.CoinTransfer, error) {
+	toUserId, err := s.resolveRecipient(input)
+	if err != nil {
+		return rest.CoinTransfer{}, err
+	}
+	if toUserId == fromUserId {
+		return rest.CoinTransfer{}, rest.ErrTransferToSelf
+	}
+
+	transfer := rest.CoinTransfer{
+		ID:       uuid.New().String(),
+		FromUser: fromUserId,
+		ToUser:   toUserId,
+		Amount:   input.Amount,
+		Fee:      s.transfer.fee(input.Amount),
+	}
+
+	transfer, err = s.repo.TransferCoins(transfer, s.transfer.DailyCap)
+	if err != nil {
+		if errors.Is(err, repository.ErrTransferDailyCap) {
+			return transfer, rest.ErrTransferDailyCap
+		}
+		return transfer, coinsError(err)
+	}
+
+	s.events.CoinsChanged(rest.CoinTransaction{
+		UserID:       transfer.FromUser,
+		Amount:       -(transfer.Amount + transfer.Fee),
+		Reason:       rest.CoinReasonTransferOut,
+		BalanceAfter: transfer.BalanceAfter,
+	})
+	s.events.CoinsChanged(rest.CoinTransaction{
+		UserID:       transfer.ToUser,
+		Amount:       transfer.Amount,
+		Reason:       rest.CoinReasonTransferIn,
+		BalanceAfter: transfer.ToBalanceAfter,
+	})
+	return transfer, nil
+}
+
+// resolveRecipient находит получателя перевода.
+func (s *CoinService) resolveRecipient(input rest.CoinTransferInput) (int, error) {
+	if input.ToUserID > 0 {
+		return input.ToUserID, nil
+	}
+	if input.ToName == "" {
+		return 0, rest.NewInvalidRequestError(errors.New("toUserId or toName is required"))
+	}
+
+	ids, err := s.settingsRepo.GetUserIdsByName(input.ToName)
+	if err != nil {
+		return 0, rest.NewInternalServerError(err)
+	}
+	switch len(ids) {
+	case 0:
+		return 0, rest.ErrUserNotFound
+	case 1:
+		return ids[0], nil
+	default:
+		return 0, rest.ErrAmbiguousRecipient
+	}
+}
+
+// GetCoinHistory возвращает страницу журнала монет, новые записи первыми.
+func (s *CoinService) GetCoinHistory(userId, limit, offset int) (rest.CoinHistory, error) {
+	if limit <= 0 {
+		limit = defaultCoinHistoryLimit
+	}
+	if limit > maxCoinHistoryLimit {
+		limit = maxCoinHistoryLimit
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	transactions, err := s.repo.GetCoinTransactions(userId, limit, offset)
+	if err != nil {
+		return rest.CoinHistory{}, rest.NewInternalServerError(err)
+	}
+	total, err := s.repo.CountCoinTransactions(userId)
+	if err != nil {
+		return rest.CoinHistory{}, rest.NewInternalServerError(err)
+	}
+
+	return rest.CoinHistory{
+		Transactions: transactions,
+		Total:        total,
+		Limit:        limit,
+		Offset:       offset,
+	}, nil
+}
+
+// coinsError переводит ошибки репозитория монет в ошибки приложения.
+func coinsError(err error) error {
+	var pqErr *pq.Error
+	switch {
+	case errors.Is(err, repository.ErrNotEnoughCoins):
+		return rest.ErrNoCoins
+	case errors.Is(err, sql.ErrNoRows):
+		return rest.ErrUserNotFound
+	case errors.As(err, &pqErr) && pqErr.Code == "23505":
+		return rest.ErrCoinTransactionExists
+	}
+	return rest.NewInternalServerError(err)
+}
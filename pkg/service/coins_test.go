@@ -0,0 +1,24 @@
+package service
+
+import "testing"
+
+func TestTransferFee(t *testing.T) {
+	cfg := TransferConfig{FeePercent: 5, MinFee: 1}
+	tests := []struct {
+		amount int
+		want   int
+	}{
+		{1, 1},
+		{20, 1},
+		{21, 2},
+		{100, 5},
+		{101, 6},
+		// Наибольшая сумма перевода не переполняет расчет
+		{1000000000, 50000000},
+	}
+	for _, tt := range tests {
+		if got := cfg.fee(tt.amount); got != tt.want {
+			t.Errorf("fee(%d) = %d, want %d", tt.amount, got, tt.want)
+		}
+	}
+}
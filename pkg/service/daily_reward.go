@@ -0,0 +1,243 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/ArtemChadaev/go"
+	"github.com/ArtemChadaev/go/pkg/repository"
+	"github.com/redis/go-redis/v9"
+)
+
+const oneDay = 24 * time.Hour
+
+// DailyRewardConfig таблица наград за серию дней подряд.
+type DailyRewardConfig struct {
+	// Награда за день серии: берется запись с наибольшим day, не превышающим день серии
+	Rewards []rest.DailyReward `mapstructure:"rewards"`
+	// Через сколько дней таблица начинается сначала, 0 - не начинается
+	Cycle int `mapstructure:"cycle"`
+	// Как часто платный подписчик может пропустить день без потери серии
+	FreezeCooldown time.Duration `mapstructure:"freezeCooldown"`
+}
+
+// rewardFor возвращает награду за n-й день серии.
+func (c DailyRewardConfig) rewardFor(streakDay int) rest.DailyReward {
+	if c.Cycle > 0 {
+		streakDay = (streakDay-1)%c.Cycle + 1
+	}
+
+	reward := rest.DailyReward{Day: streakDay}
+	for _, r := range c.Rewards {
+		if r.Day <= streakDay {
+			reward.Coins = r.Coins
+			reward.SubscriptionDays = r.SubscriptionDays
+		}
+	}
+	return reward
+}
+
+type DailyRewardService struct {
+	repo            repository.DailyRewards
+	settingsService UserSettings
+	events          Events
+	redis           *redis.Client
+	cfg             DailyRewardConfig
+}
+
+func NewDailyRewardService(repo repository.DailyRewards, settingsService UserSettings, events Events,
+	redis *redis.Client, cfg DailyRewardConfig) *DailyRewardService {
+	// Таблица должна идти по возрастанию дней
+	sort.Slice(cfg.Rewards, func(i, j int) bool { return cfg.Rewards[i].Day < cfg.Rewards[j].Day })
+
+	return &DailyRewardService{
+		repo:            repo,
+		settingsService: settingsService,
+		events:          events,
+		redis:           redis,
+		cfg:             cfg,
+	}
+}
+
+// Сколько хранится в кеше отметка о награде: с запасом на разницу часовых поясов
+const dailyRewardClaimTTL = 3 * oneDay
+
+// rewardDay день награды пользователя по его часовому поясу.
+type rewardDay struct {
+	// Дата без времени (полночь UTC), в таком виде она хранится в базе
+	Date time.Time
+	// Когда у пользователя начнется следующий день
+	ResetAt time.Time
+	// Дает ли тариф пользователя заморозку серии
+	StreakFreeze bool
+}
+
+func (d rewardDay) String() string {
+	return d.Date.Format("2006-01-02")
+}
+
+// userRewardDay определяет "сегодня" для пользователя по его часовому поясу.
+func (s *DailyRewardService) userRewardDay(userId int) (rewardDay, error) {
+	settings, err := s.settingsService.GetByUserID(userId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return rewardDay{}, rest.ErrUserNotFound
+		}
+		return rewardDay{}, rest.NewInternalServerError(err)
+	}
+
+	loc, err := loadTimezone(settings.Timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+	day := rewardDayAt(time.Now(), loc)
+	day.StreakFreeze = settings.Plan != nil && settings.Plan.Perks.Has(rest.PerkStreakFreeze)
+
+	return day, nil
+}
+
+// rewardDayAt день награды для момента now в часовом поясе loc.
+func rewardDayAt(now time.Time, loc *time.Location) rewardDay {
+	year, month, date := now.In(loc).Date()
+
+	return rewardDay{
+		Date:    time.Date(year, month, date, 0, 0, 0, 0, time.UTC),
+		ResetAt: time.Date(year, month, date+1, 0, 0, 0, 0, loc),
+	}
+}
+
+func dailyRewardKey(userId int) string {
+	return "daily_reward:" + strconv.Itoa(userId)
+}
+
+// nextStreak считает, каким будет следующий день серии, если забрать награду в день claimDay.
+// Пропуск одного дня прощается подписчикам с заморозкой серии не чаще раза в FreezeCooldown.
+func (s *DailyRewardService) nextStreak(streak rest.DailyRewardStreak, claimDay time.Time, streakFreeze bool) (next int, frozen bool) {
+	if streak.LastClaimDate == nil {
+		return 1, false
+	}
+
+	switch claimDay.Sub(streak.LastClaimDate.UTC().Truncate(oneDay)) {
+	case oneDay:
+		return streak.CurrentStreak + 1, false
+	case 2 * oneDay:
+		missed := claimDay.Add(-oneDay)
+		canFreeze := streak.LastFreezeDate == nil || missed.Sub(*streak.LastFreezeDate) >= s.cfg.FreezeCooldown
+		if streakFreeze && canFreeze {
+			return streak.CurrentStreak + 1, true
+		}
+	}
+	return 1, false
+}
+
+// GetGrantDailyReward выдает награду за текущий день серии раз в день по часовому поясу пользователя.
+// Получение фиксируется в Postgres вместе с начислением, Redis используется только как кеш,
+// чтобы повторные запросы не доходили до базы.
+func (s *DailyRewardService) GetGrantDailyReward(userId int) (rest.DailyRewardClaim, error) {
+	today, err := s.userRewardDay(userId)
+	if err != nil {
+		return rest.DailyRewardClaim{}, err
+	}
+
+	ctx := context.Background()
+	key := dailyRewardKey(userId)
+	if last, err := s.redis.Get(ctx, key).Result(); err == nil && last >= today.String() {
+		return rest.DailyRewardClaim{}, rest.ErrDayCoin // Награда уже получена сегодня
+	}
+
+	streak, err := s.repo.GetDailyRewardStreak(userId)
+	if err != nil {
+		return rest.DailyRewardClaim{}, rest.NewInternalServerError(err)
+	}
+	// Смена часового пояса не должна давать награду за уже прошедший день
+	if streak.LastClaimDate != nil && !streak.LastClaimDate.Before(today.Date) {
+		return rest.DailyRewardClaim{}, rest.ErrDayCoin
+	}
+	prevClaimDate := streak.LastClaimDate
+
+	next, frozen := s.nextStreak(streak, today.Date, today.StreakFreeze)
+	reward := s.cfg.rewardFor(next)
+
+	streak.CurrentStreak = next
+	streak.LongestStreak = max(streak.LongestStreak, next)
+	streak.LastClaimDate = &today.Date
+	if frozen {
+		missed := today.Date.Add(-oneDay)
+		streak.LastFreezeDate = &missed
+	}
+
+	claim, err := s.repo.ClaimDailyReward(rest.DailyRewardClaim{
+		UserID:           userId,
+		ClaimDate:        today.Date,
+		StreakDay:        next,
+		Coins:            reward.Coins,
+		SubscriptionDays: reward.SubscriptionDays,
+	}, streak, prevClaimDate)
+	if err != nil {
+		if errors.Is(err, repository.ErrDailyRewardClaimed) {
+			return claim, rest.ErrDayCoin
+		}
+		return claim, coinsError(err)
+	}
+
+	s.redis.Set(ctx, key, today.String(), dailyRewardClaimTTL)
+	if claim.SubscriptionDays > 0 {
+		s.redis.Del(ctx, entitlementsKey(userId))
+	}
+	s.events.Publish(rest.Event{
+		Type:   rest.EventDailyRewardClaimed,
+		UserID: userId,
+		Value:  claim.StreakDay,
+	})
+	if claim.Coins > 0 {
+		s.events.CoinsChanged(rest.CoinTransaction{
+			UserID:       userId,
+			Amount:       claim.Coins,
+			Reason:       rest.CoinReasonDailyReward,
+			BalanceAfter: claim.Balance,
+		})
+	}
+	claim.NextClaimAt = today.ResetAt
+
+	return claim, nil
+}
+
+// GetDailyRewardStatus текущая серия, следующая награда и время до смены дня.
+func (s *DailyRewardService) GetDailyRewardStatus(userId int) (rest.DailyRewardStatus, error) {
+	streak, err := s.repo.GetDailyRewardStreak(userId)
+	if err != nil {
+		return rest.DailyRewardStatus{}, rest.NewInternalServerError(err)
+	}
+	today, err := s.userRewardDay(userId)
+	if err != nil {
+		return rest.DailyRewardStatus{}, err
+	}
+
+	claimedToday := streak.LastClaimDate != nil && !streak.LastClaimDate.Before(today.Date)
+
+	// Если сегодня уже забрал, следующая награда будет завтра
+	currentStreak := streak.CurrentStreak
+	nextDay := today.Date
+	if claimedToday {
+		nextDay = today.Date.Add(oneDay)
+	}
+	next, _ := s.nextStreak(streak, nextDay, today.StreakFreeze)
+	if next == 1 && !claimedToday {
+		// Серия прервалась
+		currentStreak = 0
+	}
+
+	return rest.DailyRewardStatus{
+		Streak:            currentStreak,
+		LongestStreak:     streak.LongestStreak,
+		ClaimedToday:      claimedToday,
+		NextStreakDay:     next,
+		NextReward:        s.cfg.rewardFor(next),
+		ResetAt:           today.ResetAt,
+		SecondsUntilReset: int(time.Until(today.ResetAt).Seconds()),
+	}, nil
+}
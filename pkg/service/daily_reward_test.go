@@ -0,0 +1,147 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ArtemChadaev/go"
+)
+
+func TestRewardFor(t *testing.T) {
+	cfg := DailyRewardConfig{
+		Rewards: []rest.DailyReward{
+			{Day: 1, Coins: 10},
+			{Day: 3, Coins: 20},
+			{Day: 7, Coins: 50, SubscriptionDays: 1},
+		},
+		Cycle: 7,
+	}
+	tests := []struct {
+		name      string
+		streakDay int
+		want      rest.DailyReward
+	}{
+		{"first day", 1, rest.DailyReward{Day: 1, Coins: 10}},
+		{"between entries", 2, rest.DailyReward{Day: 2, Coins: 10}},
+		{"exact entry", 3, rest.DailyReward{Day: 3, Coins: 20}},
+		{"last day of cycle", 7, rest.DailyReward{Day: 7, Coins: 50, SubscriptionDays: 1}},
+		{"cycle wraps", 8, rest.DailyReward{Day: 1, Coins: 10}},
+		{"second cycle", 10, rest.DailyReward{Day: 3, Coins: 20}},
+		{"end of second cycle", 14, rest.DailyReward{Day: 7, Coins: 50, SubscriptionDays: 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := cfg.rewardFor(tt.streakDay); got != tt.want {
+				t.Errorf("rewardFor(%d) = %+v, want %+v", tt.streakDay, got, tt.want)
+			}
+		})
+	}
+
+	// Без цикла последняя запись действует дальше
+	cfg.Cycle = 0
+	if got := cfg.rewardFor(30); got != (rest.DailyReward{Day: 30, Coins: 50, SubscriptionDays: 1}) {
+		t.Errorf("rewardFor(30) without cycle = %+v", got)
+	}
+	// День раньше первой записи ничего не дает
+	cfg.Rewards = []rest.DailyReward{{Day: 2, Coins: 10}}
+	if got := cfg.rewardFor(1); got != (rest.DailyReward{Day: 1}) {
+		t.Errorf("rewardFor(1) before first entry = %+v", got)
+	}
+}
+
+func TestNextStreak(t *testing.T) {
+	s := &DailyRewardService{cfg: DailyRewardConfig{FreezeCooldown: 7 * oneDay}}
+	day := func(d int) *time.Time {
+		date := time.Date(2026, time.March, d, 0, 0, 0, 0, time.UTC)
+		return &date
+	}
+	claimDay := *day(10)
+
+	tests := []struct {
+		name         string
+		streak       rest.DailyRewardStreak
+		streakFreeze bool
+		wantNext     int
+		wantFrozen   bool
+	}{
+		{"first claim", rest.DailyRewardStreak{}, false, 1, false},
+		{"continue", rest.DailyRewardStreak{CurrentStreak: 4, LastClaimDate: day(9)}, false, 5, false},
+		{"missed day resets", rest.DailyRewardStreak{CurrentStreak: 4, LastClaimDate: day(8)}, false, 1, false},
+		{"missed day frozen", rest.DailyRewardStreak{CurrentStreak: 4, LastClaimDate: day(8)}, true, 5, true},
+		{"freeze on cooldown", rest.DailyRewardStreak{CurrentStreak: 4, LastClaimDate: day(8), LastFreezeDate: day(5)}, true, 1, false},
+		{"freeze after cooldown", rest.DailyRewardStreak{CurrentStreak: 4, LastClaimDate: day(8), LastFreezeDate: day(2)}, true, 5, true},
+		{"two missed days reset even with freeze", rest.DailyRewardStreak{CurrentStreak: 4, LastClaimDate: day(7)}, true, 1, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next, frozen := s.nextStreak(tt.streak, claimDay, tt.streakFreeze)
+			if next != tt.wantNext || frozen != tt.wantFrozen {
+				t.Errorf("nextStreak() = (%d, %v), want (%d, %v)", next, frozen, tt.wantNext, tt.wantFrozen)
+			}
+		})
+	}
+}
+
+func TestRewardDayAt(t *testing.T) {
+	moscow, err := time.LoadLocation("Europe/Moscow")
+	if err != nil {
+		t.Skipf("no tzdata: %v", err)
+	}
+	losAngeles, err := time.LoadLocation("America/Los_Angeles")
+	if err != nil {
+		t.Skipf("no tzdata: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		now       time.Time
+		loc       *time.Location
+		wantDate  string
+		wantReset time.Time
+	}{
+		{
+			name:      "utc",
+			now:       time.Date(2026, time.March, 10, 23, 59, 0, 0, time.UTC),
+			loc:       time.UTC,
+			wantDate:  "2026-03-10",
+			wantReset: time.Date(2026, time.March, 11, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			// 21:30 UTC в Москве уже следующий день
+			name:      "ahead of utc",
+			now:       time.Date(2026, time.March, 10, 21, 30, 0, 0, time.UTC),
+			loc:       moscow,
+			wantDate:  "2026-03-11",
+			wantReset: time.Date(2026, time.March, 11, 21, 0, 0, 0, time.UTC),
+		},
+		{
+			name:      "just before midnight ahead of utc",
+			now:       time.Date(2026, time.March, 10, 20, 59, 0, 0, time.UTC),
+			loc:       moscow,
+			wantDate:  "2026-03-10",
+			wantReset: time.Date(2026, time.March, 10, 21, 0, 0, 0, time.UTC),
+		},
+		{
+			// 03:00 UTC в Лос-Анджелесе еще предыдущий день
+			name:      "behind utc",
+			now:       time.Date(2026, time.March, 10, 3, 0, 0, 0, time.UTC),
+			loc:       losAngeles,
+			wantDate:  "2026-03-09",
+			wantReset: time.Date(2026, time.March, 10, 7, 0, 0, 0, time.UTC),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			day := rewardDayAt(tt.now, tt.loc)
+			if day.String() != tt.wantDate {
+				t.Errorf("date = %s, want %s", day, tt.wantDate)
+			}
+			if day.Date.Location() != time.UTC || !day.Date.Equal(day.Date.Truncate(oneDay)) {
+				t.Errorf("date %v is not midnight UTC", day.Date)
+			}
+			if !day.ResetAt.Equal(tt.wantReset) {
+				t.Errorf("resetAt = %v, want %v", day.ResetAt.UTC(), tt.wantReset)
+			}
+		})
+	}
+}
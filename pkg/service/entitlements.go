@@ -0,0 +1,90 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/ArtemChadaev/go"
+	"github.com/sirupsen/logrus"
+)
+
+// entitlementsKey ключ кеша возможностей подписки, сбрасывается при ее изменении.
+func entitlementsKey(userId int) string {
+	return "entitlements:" + strconv.Itoa(userId)
+}
+
+// GetEntitlements возможности пользователя по тарифу активной подписки.
+// Ответ кешируется в Redis, но не дольше, чем до окончания подписки.
+func (s *UserSettingsService) GetEntitlements(userId int) (rest.Entitlements, error) {
+	ctx := context.Background()
+	key := entitlementsKey(userId)
+
+	var entitlements rest.Entitlements
+	if cached, err := s.redis.Get(ctx, key).Bytes(); err == nil && json.Unmarshal(cached, &entitlements) == nil {
+		return entitlements, nil
+	}
+
+	settings, err := s.GetByUserID(userId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return entitlements, rest.ErrUserNotFound
+		}
+		return entitlements, rest.NewInternalServerError(err)
+	}
+
+	entitlements = rest.Entitlements{
+		Active: hasActiveSubscription(settings),
+		Perks:  rest.PlanPerks{},
+	}
+	ttl := entitlementsCacheTTL
+	if entitlements.Active {
+		var expiresAt time.Time
+		if settings.DateOfPaidSubscription != nil {
+			expiresAt = *settings.DateOfPaidSubscription
+		}
+		if settings.SubscriptionGraceUntil != nil && settings.SubscriptionGraceUntil.After(expiresAt) {
+			expiresAt = *settings.SubscriptionGraceUntil
+		}
+		entitlements.ExpiresAt = &expiresAt
+		ttl = min(ttl, time.Until(expiresAt))
+	}
+	if settings.Plan != nil {
+		entitlements.Plan = settings.Plan.Code
+		entitlements.Perks = settings.Plan.Perks
+	}
+
+	if data, err := json.Marshal(entitlements); err == nil && ttl > 0 {
+		s.redis.Set(ctx, key, data, ttl)
+	}
+	return entitlements, nil
+}
+
+// RequireEntitlement проверяет, что тариф пользователя дает feature.
+// Иначе возвращает 402 с тарифом, который ее дает.
+func (s *UserSettingsService) RequireEntitlement(userId int, feature string) error {
+	entitlements, err := s.GetEntitlements(userId)
+	if err != nil {
+		return err
+	}
+	if entitlements.Perks.Has(feature) {
+		return nil
+	}
+
+	// Предлагаем самый короткий тариф с этой возможностью
+	var required string
+	plans, err := s.plans.GetSubscriptionPlans()
+	if err != nil {
+		logrus.Errorf("can't find plan with %s: %v", feature, err)
+	}
+	for _, plan := range plans {
+		if plan.Perks.Has(feature) {
+			required = plan.Code
+			break
+		}
+	}
+	return rest.NewEntitlementRequiredError(feature, required)
+}
@@ -0,0 +1,235 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ArtemChadaev/go"
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// Поток событий в Redis
+	eventStream = "events"
+	// Поток обрезается примерно до стольких записей
+	eventStreamMaxLen = 100000
+	// Сколько событий читаем за раз и сколько ждем новых
+	eventReadCount = 100
+	eventReadBlock = 5 * time.Second
+	// Событие, которое обработчик не подтвердил за это время, забирает другой обработчик группы
+	eventClaimIdle = time.Minute
+	// Пауза после ошибки Redis
+	eventRetryDelay = 5 * time.Second
+)
+
+type EventService struct {
+	redis       *redis.Client
+	leaderboard Leaderboard
+
+	mu            sync.Mutex
+	subscriptions []eventSubscription
+}
+
+type eventSubscription struct {
+	group  string
+	handle func(event rest.Event) error
+}
+
+func NewEventService(redis *redis.Client, leaderboard Leaderboard) *EventService {
+	return &EventService{
+		redis:       redis,
+		leaderboard: leaderboard,
+	}
+}
+
+// Publish добавляет событие в поток. Ошибка только логируется: событие не должно ломать основной запрос.
+func (s *EventService) Publish(event rest.Event) {
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = time.Now()
+	}
+	data, err := json.Marshal(event)
+	if err == nil {
+		err = s.redis.XAdd(context.Background(), &redis.XAddArgs{
+			Stream: eventStream,
+			MaxLen: eventStreamMaxLen,
+			Approx: true,
+			Values: map[string]interface{}{"data": data},
+		}).Err()
+	}
+	if err != nil {
+		logrus.Errorf("events: can't publish %s for user %d: %v", event.Type, event.UserID, err)
+	}
+}
+
+// CoinsChanged вызывается после каждой записи в журнал монет: обновляет рейтинги и публикует заработок.
+func (s *EventService) CoinsChanged(transaction rest.CoinTransaction) {
+	s.leaderboard.TrackCoinTransaction(transaction)
+	if isEarned(transaction) {
+		s.Publish(rest.Event{
+			Type:   rest.EventCoinsEarned,
+			UserID: transaction.UserID,
+			Value:  transaction.Amount,
+		})
+	}
+}
+
+// Subscribe регистрирует обработчик потока для группы group, обработка начинается в Consume.
+// Каждая реплика - отдельный обработчик группы, событие получает только один из них.
+// Неподтвержденные события доставляются повторно, поэтому handle должен быть идемпотентным.
+func (s *EventService) Subscribe(group string, handle func(event rest.Event) error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.subscriptions = append(s.subscriptions, eventSubscription{group: group, handle: handle})
+}
+
+// Consume обрабатывает поток всеми подписками, пока не отменен ctx. Начатая пачка событий
+// не дорабатывается: необработанные события останутся неподтвержденными и придут снова.
+func (s *EventService) Consume(ctx context.Context) {
+	s.mu.Lock()
+	subscriptions := s.subscriptions
+	s.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, sub := range subscriptions {
+		wg.Go(func() { s.consume(ctx, sub.group, sub.handle) })
+	}
+	wg.Wait()
+}
+
+func (s *EventService) consume(ctx context.Context, group string, handle func(event rest.Event) error) {
+	consumer := eventConsumerName()
+
+	for {
+		err := s.redis.XGroupCreateMkStream(ctx, eventStream, group, "0").Err()
+		if err == nil || strings.HasPrefix(err.Error(), "BUSYGROUP") {
+			break
+		}
+		if !s.consumeError(ctx, group, err) {
+			return
+		}
+	}
+	logrus.Infof("events: consumer %s of group %s started", consumer, group)
+	defer logrus.Infof("events: consumer %s of group %s stopped", consumer, group)
+
+	var lastClaim time.Time
+	for ctx.Err() == nil {
+		// Сначала забираем события, зависшие у упавших обработчиков
+		if time.Since(lastClaim) >= eventClaimIdle {
+			messages, _, err := s.redis.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+				Stream:   eventStream,
+				Group:    group,
+				Consumer: consumer,
+				MinIdle:  eventClaimIdle,
+				Start:    "0-0",
+				Count:    eventReadCount,
+			}).Result()
+			if err != nil {
+				s.consumeError(ctx, group, err)
+				continue
+			}
+			lastClaim = time.Now()
+			s.handleMessages(ctx, group, messages, handle)
+		}
+
+		streams, err := s.redis.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group:    group,
+			Consumer: consumer,
+			Streams:  []string{eventStream, ">"},
+			Count:    eventReadCount,
+			Block:    eventReadBlock,
+		}).Result()
+		if errors.Is(err, redis.Nil) {
+			continue
+		}
+		if err != nil {
+			s.consumeError(ctx, group, err)
+			continue
+		}
+		for _, stream := range streams {
+			s.handleMessages(ctx, group, stream.Messages, handle)
+		}
+	}
+}
+
+// consumeError логирует ошибку Redis и ждет перед повтором. false - сервис останавливается.
+func (s *EventService) consumeError(ctx context.Context, group string, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	logrus.Errorf("events: group %s can't read stream: %v", group, err)
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(eventRetryDelay):
+		return true
+	}
+}
+
+// handleMessages обрабатывает события и подтверждает успешно обработанные.
+// Событие с ошибкой остается неподтвержденным и будет доставлено снова.
+func (s *EventService) handleMessages(ctx context.Context, group string, messages []redis.XMessage,
+	handle func(event rest.Event) error) {
+	for _, message := range messages {
+		if ctx.Err() != nil {
+			return
+		}
+		event, err := parseEvent(message)
+		if err != nil {
+			// Испорченное событие повторять бесполезно
+			logrus.Errorf("events: skip malformed event %s: %v", message.ID, err)
+		} else if err := handle(event); err != nil {
+			logrus.Errorf("events: group %s can't handle %s of user %d: %v", group, event.Type, event.UserID, err)
+			continue
+		}
+		// Обработанное событие подтверждаем и при остановке, чтобы не обрабатывать его снова
+		if err := s.redis.XAck(context.WithoutCancel(ctx), eventStream, group, message.ID).Err(); err != nil {
+			logrus.Errorf("events: can't ack %s: %v", message.ID, err)
+		}
+	}
+}
+
+// RetainedSince время самого старого события в потоке. Более ранние события обрезаны
+// и повторно доставлены уже не будут. Пустой поток - текущее время.
+func (s *EventService) RetainedSince(ctx context.Context) (time.Time, error) {
+	messages, err := s.redis.XRangeN(ctx, eventStream, "-", "+", 1).Result()
+	if err != nil {
+		return time.Time{}, err
+	}
+	if len(messages) == 0 {
+		return time.Now(), nil
+	}
+	// ID записи потока - время добавления в миллисекундах и порядковый номер
+	ms, _, _ := strings.Cut(messages[0].ID, "-")
+	unixMilli, err := strconv.ParseInt(ms, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("bad stream id %s: %w", messages[0].ID, err)
+	}
+	return time.UnixMilli(unixMilli), nil
+}
+
+func parseEvent(message redis.XMessage) (rest.Event, error) {
+	var event rest.Event
+	data, ok := message.Values["data"].(string)
+	if !ok {
+		return event, errors.New("no data")
+	}
+	if err := json.Unmarshal([]byte(data), &event); err != nil {
+		return event, err
+	}
+	event.ID = message.ID
+	return event, nil
+}
+
+// eventConsumerName имя обработчика, уникальное для процесса.
+func eventConsumerName() string {
+	host, _ := os.Hostname()
+	return fmt.Sprintf("%s-%d", host, os.Getpid())
+}
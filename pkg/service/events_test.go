@@ -0,0 +1,51 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestEventRetainedSince(t *testing.T) {
+	client := redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+	s := NewEventService(client, nil)
+	ctx := context.Background()
+
+	// В пустом потоке повторно прийти нечему
+	before := time.Now()
+	since, err := s.RetainedSince(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if since.Before(before) {
+		t.Errorf("empty stream: since = %v, want now", since)
+	}
+
+	for _, id := range []string{"1700000000000-0", "1700000000000-1", "1700000060000-0"} {
+		if err := client.XAdd(ctx, &redis.XAddArgs{Stream: eventStream, ID: id, Values: []string{"data", "{}"}}).Err(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	since, err = s.RetainedSince(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := time.UnixMilli(1700000000000); !since.Equal(want) {
+		t.Errorf("since = %v, want %v", since, want)
+	}
+
+	// После обрезки потока граница сдвигается
+	if err := client.XTrimMaxLen(ctx, eventStream, 1).Err(); err != nil {
+		t.Fatal(err)
+	}
+	since, err = s.RetainedSince(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := time.UnixMilli(1700000060000); !since.Equal(want) {
+		t.Errorf("after trim: since = %v, want %v", since, want)
+	}
+}
@@ -0,0 +1,396 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ArtemChadaev/go"
+	"github.com/ArtemChadaev/go/pkg/repository"
+	"github.com/ArtemChadaev/go/pkg/scheduler"
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// Размер рейтинга по умолчанию и максимальный
+	defaultLeaderboardLimit = 10
+	maxLeaderboardLimit     = 100
+	// Сколько соседей сверху и снизу показываем вокруг пользователя
+	leaderboardNeighbours = 2
+	// Сколько мест недельного рейтинга сохраняется в архив
+	leaderboardArchiveSize = 100
+	// Сколько живет недельный рейтинг: с запасом, чтобы архиватор успел его сохранить
+	leaderboardWeekTTL = 5 * 7 * oneDay
+	// Сколько хранится рейтинг прошлой недели после архивации
+	leaderboardArchivedTTL = 7 * oneDay
+)
+
+// Поступления, которые не считаются заработком: переводы от других игроков, стартовый баланс и купленные монеты.
+var notEarnedReasons = []string{rest.CoinReasonTransferIn, rest.CoinReasonInitialBalance, rest.CoinReasonPurchase}
+
+func isEarned(transaction rest.CoinTransaction) bool {
+	if transaction.Amount <= 0 {
+		return false
+	}
+	for _, reason := range notEarnedReasons {
+		if transaction.Reason == reason {
+			return false
+		}
+	}
+	return true
+}
+
+// leaderboardWeek неделя ISO по UTC, например 2025-W39.
+func leaderboardWeek(t time.Time) string {
+	year, week := t.UTC().ISOWeek()
+	return fmt.Sprintf("%d-W%02d", year, week)
+}
+
+// weekStart начало недели ISO (понедельник, полночь UTC).
+func weekStart(t time.Time) time.Time {
+	t = t.UTC().Truncate(oneDay)
+	return t.AddDate(0, 0, -(int(t.Weekday())+6)%7)
+}
+
+// leaderboardKey ключ ZSET рейтинга. week пустой для рейтинга за все время, clanId 0 - для глобального.
+func leaderboardKey(board, week string, clanId int) string {
+	key := "leaderboard:" + board
+	if week != "" {
+		key += ":week:" + week
+	}
+	if clanId != 0 {
+		key += ":clan:" + strconv.Itoa(clanId)
+	}
+	return key
+}
+
+type LeaderboardService struct {
+	repo         repository.Leaderboards
+	settingsRepo repository.UserSettings
+	redis        *redis.Client
+}
+
+func NewLeaderboardService(repo repository.Leaderboards, settingsRepo repository.UserSettings, redis *redis.Client) *LeaderboardService {
+	return &LeaderboardService{
+		repo:         repo,
+		settingsRepo: settingsRepo,
+		redis:        redis,
+	}
+}
+
+// TrackCoinTransaction обновляет рейтинги после записи в журнал монет.
+// Ошибки только логируются: рейтинг вторичен, а расхождения исправляет RebuildLeaderboards.
+func (s *LeaderboardService) TrackCoinTransaction(transaction rest.CoinTransaction) {
+	clanId, err := s.repo.GetUserClanId(transaction.UserID)
+	if err != nil {
+		logrus.Errorf("leaderboard: can't get clan of user %d: %v", transaction.UserID, err)
+	}
+
+	ctx := context.Background()
+	member := strconv.Itoa(transaction.UserID)
+	week := leaderboardWeek(time.Now())
+
+	pipe := s.redis.Pipeline()
+	balance := redis.Z{Score: float64(transaction.BalanceAfter), Member: member}
+	pipe.ZAdd(ctx, leaderboardKey(rest.LeaderboardBalance, "", 0), balance)
+	if clanId != 0 {
+		pipe.ZAdd(ctx, leaderboardKey(rest.LeaderboardBalance, "", clanId), balance)
+	}
+	if isEarned(transaction) {
+		amount := float64(transaction.Amount)
+		pipe.ZIncrBy(ctx, leaderboardKey(rest.LeaderboardEarned, "", 0), amount, member)
+		pipe.ZIncrBy(ctx, leaderboardKey(rest.LeaderboardEarned, week, 0), amount, member)
+		pipe.Expire(ctx, leaderboardKey(rest.LeaderboardEarned, week, 0), leaderboardWeekTTL)
+		if clanId != 0 {
+			pipe.ZIncrBy(ctx, leaderboardKey(rest.LeaderboardEarned, "", clanId), amount, member)
+			pipe.ZIncrBy(ctx, leaderboardKey(rest.LeaderboardEarned, week, clanId), amount, member)
+			pipe.Expire(ctx, leaderboardKey(rest.LeaderboardEarned, week, clanId), leaderboardWeekTTL)
+		}
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		logrus.Errorf("leaderboard: can't track transaction of user %d: %v", transaction.UserID, err)
+	}
+}
+
+// clanBoard рейтинг, который ведется и внутри кланов. week пустой для рейтинга за все время.
+type clanBoard struct {
+	board, week string
+}
+
+func clanBoards(now time.Time) []clanBoard {
+	return []clanBoard{
+		{rest.LeaderboardBalance, ""},
+		{rest.LeaderboardEarned, ""},
+		{rest.LeaderboardEarned, leaderboardWeek(now)},
+	}
+}
+
+// TrackClanMembership при вступлении в клан копирует очки пользователя из общих рейтингов в рейтинги клана,
+// при выходе убирает его оттуда. Ошибки только логируются, как и в TrackCoinTransaction.
+func (s *LeaderboardService) TrackClanMembership(userId, clanId int, joined bool) {
+	ctx := context.Background()
+	member := strconv.Itoa(userId)
+
+	pipe := s.redis.Pipeline()
+	for _, b := range clanBoards(time.Now()) {
+		clanKey := leaderboardKey(b.board, b.week, clanId)
+		if !joined {
+			pipe.ZRem(ctx, clanKey, member)
+			continue
+		}
+		score, err := s.redis.ZScore(ctx, leaderboardKey(b.board, b.week, 0), member).Result()
+		if errors.Is(err, redis.Nil) {
+			continue
+		}
+		if err != nil {
+			logrus.Errorf("leaderboard: can't get score of user %d: %v", userId, err)
+			return
+		}
+		pipe.ZAdd(ctx, clanKey, redis.Z{Score: score, Member: member})
+		if b.week != "" {
+			pipe.Expire(ctx, clanKey, leaderboardWeekTTL)
+		}
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		logrus.Errorf("leaderboard: can't update clan %d boards for user %d: %v", clanId, userId, err)
+	}
+}
+
+// DeleteClanLeaderboards удаляет рейтинги распущенного клана.
+func (s *LeaderboardService) DeleteClanLeaderboards(clanId int) {
+	keys := make([]string, 0, 3)
+	for _, b := range clanBoards(time.Now()) {
+		keys = append(keys, leaderboardKey(b.board, b.week, clanId))
+	}
+	if err := s.redis.Del(context.Background(), keys...).Err(); err != nil {
+		logrus.Errorf("leaderboard: can't delete boards of clan %d: %v", clanId, err)
+	}
+}
+
+// GetLeaderboard возвращает топ рейтинга, место пользователя и его соседей.
+func (s *LeaderboardService) GetLeaderboard(userId int, query rest.LeaderboardQuery) (rest.Leaderboard, error) {
+	if query.Period == "" {
+		query.Period = rest.LeaderboardPeriodAll
+	}
+	if query.Board != rest.LeaderboardBalance && query.Board != rest.LeaderboardEarned {
+		return rest.Leaderboard{}, rest.NewInvalidRequestError(errors.New("unknown leaderboard"))
+	}
+	week := ""
+	switch {
+	case query.Period == rest.LeaderboardPeriodWeek && query.Board == rest.LeaderboardEarned:
+		week = leaderboardWeek(time.Now())
+	case query.Period != rest.LeaderboardPeriodAll:
+		return rest.Leaderboard{}, rest.NewInvalidRequestError(errors.New("unsupported leaderboard period"))
+	}
+	if query.Limit <= 0 {
+		query.Limit = defaultLeaderboardLimit
+	}
+	if query.Limit > maxLeaderboardLimit {
+		query.Limit = maxLeaderboardLimit
+	}
+
+	ctx := context.Background()
+	key := leaderboardKey(query.Board, week, query.ClanID)
+
+	top, err := s.redis.ZRevRangeWithScores(ctx, key, 0, int64(query.Limit-1)).Result()
+	if err != nil {
+		return rest.Leaderboard{}, rest.NewInternalServerError(err)
+	}
+	leaderboard := rest.Leaderboard{
+		Board:      query.Board,
+		Period:     query.Period,
+		ClanID:     query.ClanID,
+		Entries:    leaderboardEntries(top, 0),
+		Neighbours: []rest.LeaderboardEntry{},
+	}
+
+	rank, err := s.redis.ZRevRank(ctx, key, strconv.Itoa(userId)).Result()
+	switch {
+	case errors.Is(err, redis.Nil):
+		// Пользователя еще нет в рейтинге
+	case err != nil:
+		return rest.Leaderboard{}, rest.NewInternalServerError(err)
+	default:
+		from := max(0, rank-leaderboardNeighbours)
+		around, err := s.redis.ZRevRangeWithScores(ctx, key, from, rank+leaderboardNeighbours).Result()
+		if err != nil {
+			return rest.Leaderboard{}, rest.NewInternalServerError(err)
+		}
+		for _, entry := range leaderboardEntries(around, int(from)) {
+			if entry.UserID == userId {
+				leaderboard.Me = &entry
+				continue
+			}
+			leaderboard.Neighbours = append(leaderboard.Neighbours, entry)
+		}
+	}
+
+	if err := s.fillUsers(&leaderboard); err != nil {
+		return rest.Leaderboard{}, rest.NewInternalServerError(err)
+	}
+	return leaderboard, nil
+}
+
+// leaderboardEntries превращает ответ ZREVRANGE в строки рейтинга, offset - место первой строки минус 1.
+func leaderboardEntries(members []redis.Z, offset int) []rest.LeaderboardEntry {
+	entries := make([]rest.LeaderboardEntry, 0, len(members))
+	for i, z := range members {
+		userId, _ := strconv.Atoi(z.Member.(string))
+		entries = append(entries, rest.LeaderboardEntry{
+			Rank:   offset + i + 1,
+			UserID: userId,
+			Score:  int64(z.Score),
+		})
+	}
+	return entries
+}
+
+// fillUsers подставляет имена и иконки пользователей одним запросом.
+func (s *LeaderboardService) fillUsers(leaderboard *rest.Leaderboard) error {
+	entries := make([]*rest.LeaderboardEntry, 0, len(leaderboard.Entries)+len(leaderboard.Neighbours)+1)
+	for i := range leaderboard.Entries {
+		entries = append(entries, &leaderboard.Entries[i])
+	}
+	for i := range leaderboard.Neighbours {
+		entries = append(entries, &leaderboard.Neighbours[i])
+	}
+	if leaderboard.Me != nil {
+		entries = append(entries, leaderboard.Me)
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+
+	ids := make([]int, 0, len(entries))
+	for _, entry := range entries {
+		ids = append(ids, entry.UserID)
+	}
+	settings, err := s.settingsRepo.GetUsersSettings(ids)
+	if err != nil {
+		return err
+	}
+	users := make(map[int]rest.UserSettings, len(settings))
+	for _, user := range settings {
+		users[user.UserID] = user
+	}
+	for _, entry := range entries {
+		entry.Name = users[entry.UserID].Name
+		entry.Icon = users[entry.UserID].Icon
+	}
+	return nil
+}
+
+// RebuildLeaderboards пересчитывает все текущие рейтинги из Postgres.
+// Рейтинги собираются во временных ключах и подменяются через RENAME, чтобы чтение не видело пустых данных.
+func (s *LeaderboardService) RebuildLeaderboards() error {
+	now := time.Now()
+	week := leaderboardWeek(now)
+	boards := make(map[string][]redis.Z)
+	weekly := make(map[string]bool)
+	add := func(board, week string, scores []rest.LeaderboardScore) {
+		for _, score := range scores {
+			z := redis.Z{Score: float64(score.Score), Member: strconv.Itoa(score.UserID)}
+			keys := []string{leaderboardKey(board, week, 0)}
+			if score.ClanID != nil {
+				keys = append(keys, leaderboardKey(board, week, *score.ClanID))
+			}
+			for _, key := range keys {
+				boards[key] = append(boards[key], z)
+				weekly[key] = week != ""
+			}
+		}
+	}
+
+	balances, err := s.repo.GetBalanceScores()
+	if err != nil {
+		return rest.NewInternalServerError(err)
+	}
+	add(rest.LeaderboardBalance, "", balances)
+	earned, err := s.repo.GetEarnedScores(time.Time{}, notEarnedReasons)
+	if err != nil {
+		return rest.NewInternalServerError(err)
+	}
+	add(rest.LeaderboardEarned, "", earned)
+	earnedWeek, err := s.repo.GetEarnedScores(weekStart(now), notEarnedReasons)
+	if err != nil {
+		return rest.NewInternalServerError(err)
+	}
+	add(rest.LeaderboardEarned, week, earnedWeek)
+
+	ctx := context.Background()
+	for key, members := range boards {
+		tmp := key + ":rebuild"
+		pipe := s.redis.TxPipeline()
+		pipe.Del(ctx, tmp)
+		pipe.ZAdd(ctx, tmp, members...)
+		pipe.Rename(ctx, tmp, key)
+		if weekly[key] {
+			pipe.Expire(ctx, key, leaderboardWeekTTL)
+		}
+		if _, err := pipe.Exec(ctx); err != nil {
+			return rest.NewInternalServerError(err)
+		}
+	}
+
+	// Удаляем рейтинги, для которых в базе больше нет данных (например, распущенных кланов).
+	// Прошлые недели не трогаем, они нужны архиватору.
+	iter := s.redis.Scan(ctx, 0, "leaderboard:*", 100).Iterator()
+	for iter.Next(ctx) {
+		key := iter.Val()
+		if _, ok := boards[key]; ok {
+			continue
+		}
+		if strings.Contains(key, ":week:") && !strings.Contains(key, ":week:"+week) {
+			continue
+		}
+		if err := s.redis.Del(ctx, key).Err(); err != nil {
+			return rest.NewInternalServerError(err)
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return rest.NewInternalServerError(err)
+	}
+
+	logrus.Infof("leaderboards rebuilt: %d boards", len(boards))
+	return nil
+}
+
+// ArchivePreviousWeek фоновая задача планировщика: сохраняет топ недельного рейтинга прошлой недели в Postgres.
+// Уже сохраненная неделя пропускается, а повторные строки отбрасываются базой.
+func (s *LeaderboardService) ArchivePreviousWeek(ctx context.Context) error {
+	week := leaderboardWeek(time.Now().AddDate(0, 0, -7))
+	archived, err := s.repo.HasLeaderboardArchive(week, rest.LeaderboardEarned)
+	if err != nil || archived {
+		return err
+	}
+
+	key := leaderboardKey(rest.LeaderboardEarned, week, 0)
+	top, err := s.redis.ZRevRangeWithScores(ctx, key, 0, leaderboardArchiveSize-1).Result()
+	if err != nil {
+		return err
+	}
+
+	entries := make([]rest.LeaderboardArchiveEntry, 0, len(top))
+	for _, entry := range leaderboardEntries(top, 0) {
+		entries = append(entries, rest.LeaderboardArchiveEntry{
+			Week:   week,
+			Board:  rest.LeaderboardEarned,
+			Rank:   entry.Rank,
+			UserID: entry.UserID,
+			Score:  entry.Score,
+		})
+	}
+	if err := scheduler.EnsureLeader(ctx); err != nil {
+		return err
+	}
+	if err := s.repo.SaveLeaderboardArchive(entries); err != nil {
+		return err
+	}
+
+	logrus.Infof("leaderboard for week %s archived: %d entries", week, len(entries))
+	return s.redis.Expire(ctx, key, leaderboardArchivedTTL).Err()
+}
@@ -0,0 +1,206 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/ArtemChadaev/go"
+	"github.com/ArtemChadaev/go/pkg/mailer"
+	"github.com/ArtemChadaev/go/pkg/queue"
+	"github.com/ArtemChadaev/go/pkg/repository"
+	"github.com/ArtemChadaev/go/pkg/scheduler"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultNotificationsLimit = 20
+	maxNotificationsLimit     = 100
+
+	// Задача очереди: письмо с уведомлением
+	taskNotificationEmail = "notification_email"
+	// Как показываем дату окончания подписки в тексте уведомления
+	notificationDateLayout = "02.01.2006 15:04 MST"
+)
+
+// NotificationsConfig секция notifications из конфига.
+type NotificationsConfig struct {
+	// За сколько до окончания подписки без автопродления напоминать о ней
+	ExpiryReminders []time.Duration   `mapstructure:"expiryReminders"`
+	SMTP            mailer.SMTPConfig `mapstructure:"smtp"`
+}
+
+// notificationEmail задача отправки письма с уведомлением.
+type notificationEmail struct {
+	NotificationID int64  `json:"notificationId"`
+	UserID         int    `json:"userId"`
+	Type           string `json:"type"`
+	Title          string `json:"title"`
+	Body           string `json:"body"`
+}
+
+type NotificationService struct {
+	repo   repository.Notifications
+	users  repository.Autorization
+	mailer mailer.Mailer
+	tasks  *queue.Queue
+	cfg    NotificationsConfig
+}
+
+func NewNotificationService(repo repository.Notifications, users repository.Autorization, tasks *queue.Queue,
+	cfg NotificationsConfig) *NotificationService {
+	// Сначала ближайшее напоминание: если подходят несколько, отправляем только его
+	sort.Slice(cfg.ExpiryReminders, func(i, j int) bool { return cfg.ExpiryReminders[i] < cfg.ExpiryReminders[j] })
+
+	service := &NotificationService{
+		repo:   repo,
+		users:  users,
+		mailer: mailer.New(cfg.SMTP),
+		tasks:  tasks,
+		cfg:    cfg,
+	}
+	tasks.Handle(taskNotificationEmail, service.sendEmail)
+
+	return service
+}
+
+// notify сохраняет уведомление в приложении и ставит в очередь письмо с ним.
+// Если очередь недоступна, письмо отправляется сразу.
+// Уведомление с уже использованным dedupKey не отправляется повторно.
+func (s *NotificationService) notify(userId int, notificationType, dedupKey, title, body string) error {
+	notification, created, err := s.repo.CreateNotification(rest.Notification{
+		UserID:   userId,
+		Type:     notificationType,
+		Title:    title,
+		Body:     body,
+		DedupKey: &dedupKey,
+	})
+	if err != nil || !created {
+		return err
+	}
+
+	email := notificationEmail{
+		NotificationID: notification.ID,
+		UserID:         userId,
+		Type:           notificationType,
+		Title:          title,
+		Body:           body,
+	}
+	ctx := context.Background()
+	if _, err := s.tasks.Enqueue(ctx, taskNotificationEmail, email, queue.Options{}); err != nil {
+		// Повторно уведомление не создастся, поэтому письмо нельзя просто потерять
+		logrus.Warnf("can't enqueue %s email to user %d, sending it directly: %v", notificationType, userId, err)
+		return s.deliverEmail(ctx, email)
+	}
+	return nil
+}
+
+// sendEmail обработчик задачи очереди: отправляет письмо, при ошибке очередь повторит попытку.
+func (s *NotificationService) sendEmail(ctx context.Context, payload []byte) error {
+	var task notificationEmail
+	if err := json.Unmarshal(payload, &task); err != nil {
+		return err
+	}
+	return s.deliverEmail(ctx, task)
+}
+
+func (s *NotificationService) deliverEmail(ctx context.Context, task notificationEmail) error {
+	email, err := s.users.GetUserEmailFromId(task.UserID)
+	if err != nil {
+		return err
+	}
+	if err := s.mailer.Send(ctx, email, task.Title, task.Body); err != nil {
+		return fmt.Errorf("can't send %s email to user %d: %w", task.Type, task.UserID, err)
+	}
+	return s.repo.MarkNotificationEmailed(task.NotificationID)
+}
+
+// SendExpiryReminders напоминает об окончании подписок без автопродления.
+// Каждое напоминание отправляется один раз за период подписки.
+// Ошибка возвращается, только если задачу нужно прервать.
+func (s *NotificationService) SendExpiryReminders(ctx context.Context) error {
+	notified := make(map[int]bool)
+	for _, before := range s.cfg.ExpiryReminders {
+		expiring, err := s.repo.GetExpiringSubscriptions(before)
+		if err != nil {
+			logrus.Errorf("can't get expiring subscriptions: %v", err)
+			return nil
+		}
+		for _, expiry := range expiring {
+			if notified[expiry.UserID] {
+				continue
+			}
+			notified[expiry.UserID] = true
+			if err := scheduler.EnsureLeader(ctx); err != nil {
+				return err
+			}
+
+			key := fmt.Sprintf("%s:%s:%d", rest.NotificationSubscriptionExpiring, before, expiry.EndsAt.Unix())
+			err := s.notify(expiry.UserID, rest.NotificationSubscriptionExpiring, key,
+				"Подписка скоро закончится",
+				fmt.Sprintf("Ваша подписка закончится %s. Продлите ее, чтобы не потерять возможности тарифа.",
+					expiry.EndsAt.UTC().Format(notificationDateLayout)))
+			if err != nil {
+				logrus.Errorf("can't notify user %d about expiring subscription: %v", expiry.UserID, err)
+			}
+		}
+	}
+	return nil
+}
+
+// NotifySubscriptionExpired сообщает, что подписка закончилась.
+func (s *NotificationService) NotifySubscriptionExpired(expiry rest.SubscriptionExpiry) error {
+	key := fmt.Sprintf("%s:%d", rest.NotificationSubscriptionExpired, expiry.EndsAt.Unix())
+	return s.notify(expiry.UserID, rest.NotificationSubscriptionExpired, key,
+		"Подписка закончилась",
+		"Ваша подписка закончилась. Оформите ее снова, чтобы вернуть возможности тарифа.")
+}
+
+// NotifyRenewalFailed сообщает, что автопродление не прошло и подписка работает только льготный период.
+func (s *NotificationService) NotifyRenewalFailed(userId int, paymentId string) error {
+	key := rest.NotificationRenewalFailed + ":" + paymentId
+	return s.notify(userId, rest.NotificationRenewalFailed, key,
+		"Не удалось продлить подписку",
+		"Мы не смогли списать оплату за продление подписки. Она еще немного поработает, "+
+			"но чтобы не потерять возможности тарифа, оплатите ее вручную.")
+}
+
+// GetNotifications страница уведомлений пользователя, новые сначала.
+func (s *NotificationService) GetNotifications(userId, limit, offset int) (rest.NotificationList, error) {
+	if limit <= 0 {
+		limit = defaultNotificationsLimit
+	}
+	if limit > maxNotificationsLimit {
+		limit = maxNotificationsLimit
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	notifications, err := s.repo.GetNotifications(userId, limit, offset)
+	if err != nil {
+		return rest.NotificationList{}, rest.NewInternalServerError(err)
+	}
+	total, unread, err := s.repo.CountNotifications(userId)
+	if err != nil {
+		return rest.NotificationList{}, rest.NewInternalServerError(err)
+	}
+
+	return rest.NotificationList{
+		Notifications: notifications,
+		Unread:        unread,
+		Total:         total,
+		Limit:         limit,
+		Offset:        offset,
+	}, nil
+}
+
+// MarkNotificationsRead отмечает уведомления прочитанными, пустой ids - все.
+func (s *NotificationService) MarkNotificationsRead(userId int, ids []int64) error {
+	if err := s.repo.MarkNotificationsRead(userId, ids); err != nil {
+		return rest.NewInternalServerError(err)
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ArtemChadaev/go"
+	"github.com/ArtemChadaev/go/pkg/queue"
+	"github.com/ArtemChadaev/go/pkg/repository"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// fakeNotifications хранит уведомления в памяти, dedupKey уникален как в базе.
+type fakeNotifications struct {
+	repository.Notifications
+	now           time.Time
+	subscriptions map[int]time.Time
+	created       []rest.Notification
+	keys          map[string]bool
+}
+
+func (f *fakeNotifications) CreateNotification(notification rest.Notification) (rest.Notification, bool, error) {
+	if notification.DedupKey != nil {
+		if f.keys[*notification.DedupKey] {
+			return rest.Notification{}, false, nil
+		}
+		f.keys[*notification.DedupKey] = true
+	}
+	notification.ID = int64(len(f.created) + 1)
+	f.created = append(f.created, notification)
+	return notification, true, nil
+}
+
+func (f *fakeNotifications) GetExpiringSubscriptions(within time.Duration) ([]rest.SubscriptionExpiry, error) {
+	var expiring []rest.SubscriptionExpiry
+	for userId, endsAt := range f.subscriptions {
+		if endsAt.After(f.now) && !endsAt.After(f.now.Add(within)) {
+			expiring = append(expiring, rest.SubscriptionExpiry{UserID: userId, EndsAt: endsAt})
+		}
+	}
+	return expiring, nil
+}
+
+func newTestNotificationService(t *testing.T, repo *fakeNotifications, reminders ...time.Duration) *NotificationService {
+	client := redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+	tasks, err := queue.New(client, queue.Config{
+		Workers:           1,
+		VisibilityTimeout: time.Minute,
+		Backoff:           time.Second,
+		MaxBackoff:        time.Second,
+		PollInterval:      time.Second,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewNotificationService(repo, nil, tasks, NotificationsConfig{ExpiryReminders: reminders})
+}
+
+func TestSendExpiryReminders(t *testing.T) {
+	now := time.Date(2026, time.March, 10, 12, 0, 0, 0, time.UTC)
+	endsAt := now.Add(30 * time.Minute)
+	repo := &fakeNotifications{
+		now:           now,
+		subscriptions: map[int]time.Time{1: endsAt},
+		keys:          make(map[string]bool),
+	}
+	// Порядок в конфиге не важен
+	s := newTestNotificationService(t, repo, 72*time.Hour, time.Hour, 24*time.Hour)
+
+	for range 3 {
+		if err := s.SendExpiryReminders(t.Context()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Подходят все три напоминания, но отправляется только ближайшее и только один раз
+	if len(repo.created) != 1 {
+		t.Fatalf("sent %d notifications, want 1", len(repo.created))
+	}
+	notification := repo.created[0]
+	if notification.UserID != 1 || notification.Type != rest.NotificationSubscriptionExpiring {
+		t.Errorf("notification = %+v", notification)
+	}
+	key := *notification.DedupKey
+	if !strings.Contains(key, time.Hour.String()) || !strings.Contains(key, fmt.Sprint(endsAt.Unix())) {
+		t.Errorf("dedup key %q must contain offset %s and end %d", key, time.Hour, endsAt.Unix())
+	}
+}
+
+func TestSendExpiryRemindersOncePerPeriod(t *testing.T) {
+	start := time.Date(2026, time.March, 10, 12, 0, 0, 0, time.UTC)
+	endsAt := start.Add(70 * time.Hour)
+	repo := &fakeNotifications{
+		subscriptions: map[int]time.Time{1: endsAt},
+		keys:          make(map[string]bool),
+	}
+	s := newTestNotificationService(t, repo, time.Hour, 24*time.Hour, 72*time.Hour)
+
+	run := func(now time.Time) {
+		t.Helper()
+		repo.now = now
+		// Планировщик может запустить задачу несколько раз за окно напоминания
+		for range 2 {
+			if err := s.SendExpiryReminders(t.Context()); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	wantSent := func(offsets ...time.Duration) {
+		t.Helper()
+		if len(repo.created) != len(offsets) {
+			t.Fatalf("sent %d notifications, want %d", len(repo.created), len(offsets))
+		}
+		for i, offset := range offsets {
+			want := fmt.Sprintf("%s:%s:%d", rest.NotificationSubscriptionExpiring, offset, repo.subscriptions[1].Unix())
+			if got := *repo.created[i].DedupKey; got != want {
+				t.Errorf("notification %d key = %q, want %q", i, got, want)
+			}
+		}
+	}
+
+	run(start)
+	wantSent(72 * time.Hour)
+	run(endsAt.Add(-20 * time.Hour))
+	wantSent(72*time.Hour, 24*time.Hour)
+	run(endsAt.Add(-10 * time.Minute))
+	wantSent(72*time.Hour, 24*time.Hour, time.Hour)
+	run(endsAt.Add(-time.Minute))
+	wantSent(72*time.Hour, 24*time.Hour, time.Hour)
+
+	// Продленная подписка - новый период, о нем снова напоминаем
+	repo.created = nil
+	repo.subscriptions[1] = endsAt.Add(30 * 24 * time.Hour)
+	run(repo.subscriptions[1].Add(-30 * time.Minute))
+	wantSent(time.Hour)
+}
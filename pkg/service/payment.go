@@ -0,0 +1,315 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/ArtemChadaev/go"
+	"github.com/ArtemChadaev/go/pkg/payment"
+	"github.com/ArtemChadaev/go/pkg/repository"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+)
+
+// Сколько ждем ответа провайдера
+const paymentProviderTimeout = 15 * time.Second
+
+// PaymentsConfig секция payments из конфига.
+type PaymentsConfig struct {
+	// Провайдер для новых платежей
+	Provider  string             `mapstructure:"provider"`
+	CoinPacks []rest.CoinPack    `mapstructure:"coinPacks"`
+	Mock      payment.MockConfig `mapstructure:"mock"`
+}
+
+type PaymentService struct {
+	repo          repository.Payments
+	plans         repository.Subscriptions
+	notifications Notifications
+	events        Events
+	redis         *redis.Client
+	providers     map[string]payment.Provider
+	cfg           PaymentsConfig
+	// Льготный период после неудачного автопродления
+	gracePeriod time.Duration
+}
+
+func NewPaymentService(repo repository.Payments, plans repository.Subscriptions, notifications Notifications,
+	events Events, redis *redis.Client, cfg PaymentsConfig, subscriptionCfg SubscriptionConfig) *PaymentService {
+	providers := make(map[string]payment.Provider)
+	if cfg.Mock.URL != "" {
+		providers[payment.MockProviderName] = payment.NewMockProvider(cfg.Mock)
+	}
+	if cfg.Provider == "" {
+		logrus.Info("payment provider is not set, purchases are disabled")
+	} else if _, ok := providers[cfg.Provider]; !ok {
+		logrus.Errorf("payment provider %q is not configured, purchases are disabled", cfg.Provider)
+	}
+
+	return &PaymentService{
+		repo:          repo,
+		plans:         plans,
+		notifications: notifications,
+		events:        events,
+		redis:         redis,
+		providers:     providers,
+		cfg:           cfg,
+		gracePeriod:   subscriptionCfg.GracePeriod,
+	}
+}
+
+// GetCoinPacks наборы монет, которые можно купить.
+func (s *PaymentService) GetCoinPacks() []rest.CoinPack {
+	return s.cfg.CoinPacks
+}
+
+// CreateSubscriptionCheckout создает платеж за тариф и страницу оплаты у провайдера.
+// autoRenew - пользователь сам выбрал автопродление, после оплаты оно включится.
+func (s *PaymentService) CreateSubscriptionCheckout(userId int, planCode string, autoRenew bool) (rest.Payment, error) {
+	plan, err := s.plans.GetSubscriptionPlan(planCode)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return rest.Payment{}, rest.ErrSubscriptionPlanNotFound
+		}
+		return rest.Payment{}, rest.NewInternalServerError(err)
+	}
+
+	return s.checkout(rest.Payment{
+		UserID:    userId,
+		Kind:      rest.PaymentKindSubscription,
+		PlanID:    &plan.ID,
+		Amount:    plan.Price,
+		Currency:  plan.Currency,
+		AutoRenew: autoRenew,
+	}, plan.Name)
+}
+
+// CreateCoinsCheckout создает платеж за набор монет и страницу оплаты у провайдера.
+func (s *PaymentService) CreateCoinsCheckout(userId int, packCode string) (rest.Payment, error) {
+	for _, pack := range s.cfg.CoinPacks {
+		if pack.Code != packCode {
+			continue
+		}
+		return s.checkout(rest.Payment{
+			UserID:   userId,
+			Kind:     rest.PaymentKindCoins,
+			Coins:    &pack.Coins,
+			Amount:   pack.Price,
+			Currency: pack.Currency,
+		}, pack.Code)
+	}
+	return rest.Payment{}, rest.ErrCoinPackNotFound
+}
+
+func (s *PaymentService) checkout(p rest.Payment, description string) (rest.Payment, error) {
+	provider, ok := s.providers[s.cfg.Provider]
+	if !ok {
+		return rest.Payment{}, rest.ErrPaymentProviderNotFound
+	}
+
+	p.ID = uuid.New().String()
+	p.Provider = provider.Name()
+	p.Status = rest.PaymentStatusPending
+	p, err := s.repo.CreatePayment(p)
+	if err != nil {
+		return p, rest.NewInternalServerError(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), paymentProviderTimeout)
+	defer cancel()
+	session, err := provider.CreateCheckout(ctx, payment.CheckoutRequest{
+		PaymentID:   p.ID,
+		Amount:      p.Amount,
+		Currency:    p.Currency,
+		Description: description,
+	})
+	if err != nil {
+		// Страницы оплаты нет, платеж уже не состоится
+		if _, _, err := s.repo.UpdatePaymentStatus(p.ID, rest.PaymentStatusFailed); err != nil {
+			logrus.Errorf("can't fail payment %s: %v", p.ID, err)
+		}
+		appErr := *rest.ErrPaymentProviderUnavailable
+		appErr.Err = err
+		return p, &appErr
+	}
+
+	if err := s.repo.SetPaymentCheckout(p.ID, session.ExternalID, session.URL); err != nil {
+		return p, rest.NewInternalServerError(err)
+	}
+	p.ExternalID = &session.ExternalID
+	p.CheckoutURL = &session.URL
+	return p, nil
+}
+
+// RenewSubscription автопродление: списывает оплату тарифа способом оплаты прошлого платежа.
+// Если списание не прошло, подписка получает льготный период, в который списание повторяется.
+func (s *PaymentService) RenewSubscription(ctx context.Context, renewal rest.SubscriptionRenewal) error {
+	provider, ok := s.providers[renewal.Provider]
+	if !ok {
+		return rest.ErrPaymentProviderNotFound
+	}
+	plan, err := s.plans.GetSubscriptionPlanById(renewal.PlanID)
+	if err != nil {
+		return err
+	}
+
+	// Сначала занимаем попытку, и только потом списываем: параллельный запуск задачи ее пропустит
+	p, claimed, err := s.repo.ClaimSubscriptionRenewal(rest.Payment{
+		ID:             uuid.New().String(),
+		UserID:         renewal.UserID,
+		Provider:       provider.Name(),
+		Kind:           rest.PaymentKindSubscription,
+		PlanID:         &plan.ID,
+		Amount:         plan.Price,
+		Currency:       plan.Currency,
+		Status:         rest.PaymentStatusPending,
+		RenewalPeriod:  &renewal.Period,
+		RenewalAttempt: &renewal.Attempt,
+	})
+	if err != nil {
+		return err
+	}
+	if !claimed {
+		logrus.Infof("renewal of user %d (attempt %d) is already in progress", renewal.UserID, renewal.Attempt)
+		return nil
+	}
+
+	// Начатое списание доводим до конца даже при остановке, иначе не узнаем его результат
+	chargeCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), paymentProviderTimeout)
+	defer cancel()
+	result, err := provider.Charge(chargeCtx, payment.ChargeRequest{
+		PaymentID:     p.ID,
+		Amount:        p.Amount,
+		Currency:      p.Currency,
+		Description:   plan.Name,
+		PaymentMethod: renewal.PaymentMethod,
+	})
+	if err != nil {
+		logrus.Warnf("renewal charge %s of user %d failed: %v", p.ID, p.UserID, err)
+		_, err = s.applyPaymentStatus(p, rest.PaymentStatusFailed)
+		return err
+	}
+
+	if err := s.repo.SetPaymentCheckout(p.ID, result.ExternalID, ""); err != nil {
+		return err
+	}
+	_, err = s.applyPaymentStatus(p, result.Status)
+	return err
+}
+
+// GetPayment платеж пользователя. Если уведомление от провайдера еще не пришло, статус спрашивается у него.
+func (s *PaymentService) GetPayment(userId int, paymentId string) (rest.Payment, error) {
+	if _, err := uuid.Parse(paymentId); err != nil {
+		return rest.Payment{}, rest.ErrPaymentNotFound
+	}
+	p, err := s.repo.GetPayment(paymentId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return p, rest.ErrPaymentNotFound
+		}
+		return p, rest.NewInternalServerError(err)
+	}
+	if p.UserID != userId {
+		return rest.Payment{}, rest.ErrPaymentNotFound
+	}
+
+	provider, ok := s.providers[p.Provider]
+	if p.Status != rest.PaymentStatusPending || p.ExternalID == nil || !ok {
+		return p, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), paymentProviderTimeout)
+	defer cancel()
+	status, err := provider.GetPaymentStatus(ctx, *p.ExternalID)
+	if err != nil {
+		logrus.Warnf("can't get status of payment %s from %s: %v", p.ID, p.Provider, err)
+		return p, nil
+	}
+	if status == p.Status {
+		return p, nil
+	}
+	return s.applyPaymentStatus(p, status)
+}
+
+// HandlePaymentWebhook обрабатывает уведомление провайдера о смене статуса платежа.
+// Провайдеры повторяют уведомления, поэтому повтор уже примененного статуса просто подтверждается.
+func (s *PaymentService) HandlePaymentWebhook(providerName string, header http.Header, body []byte) error {
+	provider, ok := s.providers[providerName]
+	if !ok {
+		return rest.ErrPaymentProviderNotFound
+	}
+
+	event, err := provider.VerifyWebhook(header, body)
+	if err != nil {
+		if errors.Is(err, payment.ErrInvalidSignature) {
+			return rest.ErrInvalidWebhookSignature
+		}
+		return rest.NewInvalidRequestError(err)
+	}
+
+	p, err := s.repo.GetPayment(event.PaymentID)
+	if errors.Is(err, sql.ErrNoRows) || err == nil && (p.Provider != providerName ||
+		p.ExternalID != nil && *p.ExternalID != event.ExternalID) {
+		return rest.ErrPaymentNotFound
+	}
+	if err != nil {
+		return rest.NewInternalServerError(err)
+	}
+
+	_, err = s.applyPaymentStatus(p, event.Status)
+	if errors.Is(err, rest.ErrInvalidPaymentTransition) {
+		// Например, отказ пришел после успешной оплаты. Повторять такое уведомление бесполезно.
+		logrus.Warnf("payment %s: ignore %s -> %s from %s", p.ID, p.Status, event.Status, providerName)
+		return nil
+	}
+	return err
+}
+
+// applyPaymentStatus меняет статус платежа и сообщает остальным сервисам о выданной подписке или монетах.
+func (s *PaymentService) applyPaymentStatus(p rest.Payment, status string) (rest.Payment, error) {
+	switch status {
+	case rest.PaymentStatusSucceeded, rest.PaymentStatusFailed, rest.PaymentStatusRefunded:
+	default:
+		// Промежуточные статусы провайдера нам не интересны
+		return p, nil
+	}
+
+	p, applied, err := s.repo.UpdatePaymentStatus(p.ID, status)
+	if err != nil {
+		if errors.Is(err, repository.ErrInvalidPaymentTransition) {
+			return p, rest.ErrInvalidPaymentTransition
+		}
+		return p, rest.NewInternalServerError(err)
+	}
+	if !applied {
+		return p, nil
+	}
+	logrus.Infof("payment %s of user %d is %s", p.ID, p.UserID, p.Status)
+
+	if p.Subscription != nil {
+		s.redis.Del(context.Background(), entitlementsKey(p.UserID))
+		if p.Status == rest.PaymentStatusSucceeded {
+			s.events.Publish(rest.Event{
+				Type:   rest.EventSubscriptionPurchased,
+				UserID: p.UserID,
+				Value:  p.Subscription.Days,
+			})
+		}
+	}
+	if p.Renewal && p.Status == rest.PaymentStatusFailed {
+		if err := s.plans.SetSubscriptionGrace(p.UserID, s.gracePeriod); err != nil {
+			return p, rest.NewInternalServerError(err)
+		}
+		s.redis.Del(context.Background(), entitlementsKey(p.UserID))
+		if err := s.notifications.NotifyRenewalFailed(p.UserID, p.ID); err != nil {
+			logrus.Errorf("can't notify user %d about failed renewal: %v", p.UserID, err)
+		}
+	}
+	if p.Transaction != nil {
+		s.events.CoinsChanged(*p.Transaction)
+	}
+	return p, nil
+}
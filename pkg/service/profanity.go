@@ -0,0 +1,74 @@
+package service
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Цифры и символы, которыми заменяют буквы, чтобы обойти фильтр
+var profanityReplacer = strings.NewReplacer(
+	"0", "o", "1", "i", "3", "e", "4", "a", "5", "s", "@", "a", "$", "s", "ё", "е",
+)
+
+// profanityFilter ищет запрещенные слова в пользовательских названиях.
+// Запрещенное слово ищется в любом месте слова без учета регистра, поэтому находятся и составные
+// "Superadmin", "Motherfucker". Обычные слова, в которых оно встречается ("Badminton"),
+// перечисляются в allowed. Буквы, разделенные пробелами или знаками, склеиваются в одно слово,
+// так что "F.u c k" тоже найдется.
+type profanityFilter struct {
+	words   []string
+	allowed []string
+}
+
+func newProfanityFilter(words, allowed []string) *profanityFilter {
+	filter := &profanityFilter{}
+	for _, word := range words {
+		filter.words = append(filter.words, profanityTokens(word)...)
+	}
+	for _, word := range allowed {
+		filter.allowed = append(filter.allowed, profanityTokens(word)...)
+	}
+	return filter
+}
+
+// Contains в тексте есть запрещенное слово.
+func (f *profanityFilter) Contains(text string) bool {
+	for _, token := range profanityTokens(text) {
+		// Разрешенное слово вырезается, а не пропускает все слово: "badmintonadmin" запрещено
+		for _, allowed := range f.allowed {
+			token = strings.ReplaceAll(token, allowed, " ")
+		}
+		for _, word := range f.words {
+			if strings.Contains(token, word) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// profanityTokens разбивает текст на слова из букв в нижнем регистре.
+// Идущие подряд одиночные буквы считаются одним словом.
+func profanityTokens(text string) []string {
+	text = profanityReplacer.Replace(strings.ToLower(text))
+	words := strings.FieldsFunc(text, func(r rune) bool { return !unicode.IsLetter(r) })
+
+	tokens := make([]string, 0, len(words))
+	var letters strings.Builder
+	for _, word := range words {
+		if utf8.RuneCountInString(word) == 1 {
+			letters.WriteString(word)
+			continue
+		}
+		if letters.Len() > 0 {
+			tokens = append(tokens, letters.String())
+			letters.Reset()
+		}
+		tokens = append(tokens, word)
+	}
+	if letters.Len() > 0 {
+		tokens = append(tokens, letters.String())
+	}
+	return tokens
+}
@@ -0,0 +1,63 @@
+package service
+
+import "testing"
+
+func TestProfanityFilter(t *testing.T) {
+	filter := newProfanityFilter(
+		[]string{"admin", "moderator", "fuck", "shit", "bitch", "хуй", "хуе", "хуя", "пизд", "бляд", "сука"},
+		[]string{"badminton", "барсук", "страху"},
+	)
+
+	tests := []struct {
+		text string
+		want bool
+	}{
+		{"Fuck", true},
+		{"FUCKING legends", true},
+		{"Team Admin", true},
+		{"Administrators", true},
+		{"moderator-2", true},
+		{"Сука", true},
+		{"Пиздец", true},
+		// Разделители между буквами
+		{"F.u c k", true},
+		{"f_u_c_k", true},
+		{"S-H-I-T happens", true},
+		{"х у й", true},
+		// Цифры и символы вместо букв
+		{"Sh1t", true},
+		{"5h1t", true},
+		{"$hit", true},
+		{"b1tch", true},
+		{"@dmin", true},
+		{"Бляд0", true},
+		// Составные слова
+		{"Superadmin", true},
+		{"Motherfucker", true},
+		{"BullShit", true},
+		{"Ахуеть", true},
+		{"Нахуя", true},
+		{"Распиздяй", true},
+		{"Badmintonadmin", true},
+		{"Барсуки и сука", true},
+		// Запрещенное слово внутри разрешенного
+		{"Badminton", false},
+		{"Badminton club", false},
+		{"Барсука", false},
+		{"Страхует", false},
+		{"Class hit", false},
+		{"Pass hit list", false},
+		{"Cocktail", false},
+		{"Shiitake", false},
+		{"Ёлка", false},
+		{"Мастер клана", false},
+		{"a b c", false},
+		{"Officer 1", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := filter.Contains(tt.text); got != tt.want {
+			t.Errorf("Contains(%q) = %v, want %v", tt.text, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,302 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ArtemChadaev/go"
+	"github.com/ArtemChadaev/go/pkg/queue"
+	"github.com/ArtemChadaev/go/pkg/repository"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// Алфавит кодов без похожих символов (0/O, 1/I), ровно 32 символа
+	redeemCodeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+	// Длина кода: 12 символов по 5 бит = 60 бит случайности
+	redeemCodeLength = 12
+	// Код показывается группами по 4 символа: ABCD-EFGH-JKLM
+	redeemCodeGroup = 4
+
+	// Задача очереди: собрать CSV партии
+	taskRedeemExport = "redeem_export"
+	// Сколько хранится готовая выгрузка
+	redeemExportTTL = 24 * time.Hour
+)
+
+type RedeemService struct {
+	repo   repository.Redeem
+	events Events
+	redis  *redis.Client
+	tasks  *queue.Queue
+}
+
+func NewRedeemService(repo repository.Redeem, events Events, redis *redis.Client, tasks *queue.Queue) *RedeemService {
+	service := &RedeemService{
+		repo:   repo,
+		events: events,
+		redis:  redis,
+		tasks:  tasks,
+	}
+	tasks.Handle(taskRedeemExport, service.buildExport)
+
+	return service
+}
+
+// generateRedeemCode генерирует криптографически случайный код.
+func generateRedeemCode() (string, error) {
+	bytes := make([]byte, redeemCodeLength)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+
+	var code strings.Builder
+	for i, b := range bytes {
+		if i > 0 && i%redeemCodeGroup == 0 {
+			code.WriteByte('-')
+		}
+		// 32 символа - младшие 5 бит дают равномерное распределение
+		code.WriteByte(redeemCodeAlphabet[b&31])
+	}
+	return code.String(), nil
+}
+
+// normalizeRedeemCode приводит введенный пользователем код к виду, в котором он хранится.
+func normalizeRedeemCode(input string) string {
+	var raw strings.Builder
+	for _, r := range strings.ToUpper(input) {
+		if strings.ContainsRune(redeemCodeAlphabet, r) {
+			raw.WriteRune(r)
+		}
+	}
+
+	var code strings.Builder
+	for i, r := range raw.String() {
+		if i > 0 && i%redeemCodeGroup == 0 {
+			code.WriteByte('-')
+		}
+		code.WriteRune(r)
+	}
+	return code.String()
+}
+
+// CreateRedeemBatch выпускает партию из count кодов с одинаковой наградой.
+func (s *RedeemService) CreateRedeemBatch(adminId int, input rest.RedeemBatchInput) (rest.RedeemBatch, error) {
+	codes := make([]string, 0, input.Count)
+	for range input.Count {
+		code, err := generateRedeemCode()
+		if err != nil {
+			return rest.RedeemBatch{}, rest.NewInternalServerError(err)
+		}
+		codes = append(codes, code)
+	}
+
+	batch := input.RedeemBatch
+	batch.CreatedBy = &adminId
+
+	batch, err := s.repo.CreateRedeemBatch(batch, codes)
+	if err != nil {
+		return batch, rest.NewInternalServerError(err)
+	}
+	return batch, nil
+}
+
+// GetRedeemBatch возвращает партию со всеми кодами, например для выгрузки в CSV.
+func (s *RedeemService) GetRedeemBatch(batchId int) (rest.RedeemBatch, error) {
+	batch, err := s.repo.GetRedeemBatch(batchId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return batch, rest.ErrRedeemBatchNotFound
+		}
+		return batch, rest.NewInternalServerError(err)
+	}
+	return batch, nil
+}
+
+// RedeemCode активирует код и выдает награду.
+func (s *RedeemService) RedeemCode(userId int, code string) (rest.RedeemResult, error) {
+	result, err := s.repo.RedeemCode(userId, normalizeRedeemCode(code))
+	var pqErr *pq.Error
+	switch {
+	case err == nil:
+	case errors.Is(err, sql.ErrNoRows):
+		return result, rest.ErrRedeemCodeNotFound
+	case errors.Is(err, repository.ErrRedeemCodeExpired):
+		return result, rest.ErrRedeemCodeExpired
+	case errors.Is(err, repository.ErrRedeemCodeExhausted):
+		return result, rest.ErrRedeemCodeExhausted
+	case errors.Is(err, repository.ErrRedeemCodeAlreadyUsed),
+		errors.As(err, &pqErr) && pqErr.Code == "23505":
+		return result, rest.ErrRedeemCodeAlreadyUsed
+	default:
+		return result, rest.NewInternalServerError(err)
+	}
+
+	if result.RewardType == rest.RedeemRewardSubscriptionDays {
+		s.redis.Del(context.Background(), entitlementsKey(userId))
+	}
+	if result.Balance != nil {
+		s.events.CoinsChanged(rest.CoinTransaction{
+			UserID:       userId,
+			Amount:       result.RewardAmount,
+			Reason:       rest.CoinReasonRedeemCode,
+			BalanceAfter: *result.Balance,
+		})
+	}
+	return result, nil
+}
+
+// redeemExportTask задача сборки выгрузки.
+type redeemExportTask struct {
+	ExportID string `json:"exportId"`
+	BatchID  int    `json:"batchId"`
+}
+
+func redeemExportKey(exportId string) string {
+	return "redeem_export:" + exportId
+}
+
+func redeemExportFileKey(exportId string) string {
+	return "redeem_export:" + exportId + ":csv"
+}
+
+// ExportRedeemBatch ставит в очередь выгрузку кодов партии в CSV. Готовый файл отдает GetRedeemExport.
+func (s *RedeemService) ExportRedeemBatch(batchId int) (rest.RedeemExport, error) {
+	export := rest.RedeemExport{
+		ID:        uuid.NewString(),
+		BatchID:   batchId,
+		Status:    rest.RedeemExportPending,
+		CreatedAt: time.Now(),
+	}
+	ctx := context.Background()
+	if err := s.saveExport(ctx, export); err != nil {
+		return export, rest.NewInternalServerError(err)
+	}
+
+	_, err := s.tasks.Enqueue(ctx, taskRedeemExport, redeemExportTask{ExportID: export.ID, BatchID: batchId}, queue.Options{})
+	if err != nil {
+		s.redis.Del(ctx, redeemExportKey(export.ID))
+		return export, rest.NewInternalServerError(err)
+	}
+	return export, nil
+}
+
+// GetRedeemExport состояние выгрузки и CSV, если она готова.
+func (s *RedeemService) GetRedeemExport(exportId string) (rest.RedeemExport, []byte, error) {
+	var export rest.RedeemExport
+	if _, err := uuid.Parse(exportId); err != nil {
+		return export, nil, rest.ErrRedeemExportNotFound
+	}
+
+	ctx := context.Background()
+	data, err := s.redis.Get(ctx, redeemExportKey(exportId)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return export, nil, rest.ErrRedeemExportNotFound
+	}
+	if err == nil {
+		err = json.Unmarshal(data, &export)
+	}
+	if err != nil {
+		return export, nil, rest.NewInternalServerError(err)
+	}
+	if export.Status != rest.RedeemExportReady {
+		return export, nil, nil
+	}
+
+	file, err := s.redis.Get(ctx, redeemExportFileKey(exportId)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		// Файл истек раньше описания
+		return export, nil, rest.ErrRedeemExportNotFound
+	}
+	if err != nil {
+		return export, nil, rest.NewInternalServerError(err)
+	}
+	return export, file, nil
+}
+
+// buildExport обработчик задачи очереди: собирает CSV партии и сохраняет его в Redis.
+func (s *RedeemService) buildExport(ctx context.Context, payload []byte) error {
+	var task redeemExportTask
+	if err := json.Unmarshal(payload, &task); err != nil {
+		return err
+	}
+	var export rest.RedeemExport
+	data, err := s.redis.Get(ctx, redeemExportKey(task.ExportID)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		// Выгрузку уже никто не ждет
+		return nil
+	}
+	if err == nil {
+		err = json.Unmarshal(data, &export)
+	}
+	if err != nil {
+		return err
+	}
+
+	batch, err := s.GetRedeemBatch(task.BatchID)
+	if errors.Is(err, rest.ErrRedeemBatchNotFound) {
+		now := time.Now()
+		export.Status = rest.RedeemExportFailed
+		export.Error = rest.ErrRedeemBatchNotFound.Message
+		export.FinishedAt = &now
+		return s.saveExport(ctx, export)
+	}
+	if err != nil {
+		return err
+	}
+
+	file, err := redeemBatchCSV(batch)
+	if err != nil {
+		return err
+	}
+	if err := s.redis.Set(ctx, redeemExportFileKey(export.ID), file, redeemExportTTL).Err(); err != nil {
+		return fmt.Errorf("can't save redeem export %s: %w", export.ID, err)
+	}
+	now := time.Now()
+	export.Status = rest.RedeemExportReady
+	export.FinishedAt = &now
+	return s.saveExport(ctx, export)
+}
+
+func (s *RedeemService) saveExport(ctx context.Context, export rest.RedeemExport) error {
+	data, err := json.Marshal(export)
+	if err != nil {
+		return err
+	}
+	return s.redis.Set(ctx, redeemExportKey(export.ID), data, redeemExportTTL).Err()
+}
+
+// redeemBatchCSV коды партии в CSV для маркетинга.
+func redeemBatchCSV(batch rest.RedeemBatch) ([]byte, error) {
+	expiresAt := ""
+	if batch.ExpiresAt != nil {
+		expiresAt = batch.ExpiresAt.Format(time.RFC3339)
+	}
+
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	_ = w.Write([]string{"code", "reward_type", "reward_amount", "max_uses", "uses", "expires_at"})
+	for _, code := range batch.Codes {
+		_ = w.Write([]string{
+			code.Code,
+			batch.RewardType,
+			strconv.Itoa(batch.RewardAmount),
+			strconv.Itoa(batch.MaxUses),
+			strconv.Itoa(code.Uses),
+			expiresAt,
+		})
+	}
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
@@ -0,0 +1,214 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ArtemChadaev/go"
+	"github.com/ArtemChadaev/go/pkg/repository"
+	"github.com/lib/pq"
+)
+
+const (
+	// Группа обработчиков потока событий, которая проверяет условие приглашений
+	referralsGroup = "referrals"
+	// Длина реферального кода, алфавит тот же, что у промокодов
+	referralCodeLength = 8
+	// Сколько раз пробуем сгенерировать код, если он совпал с чужим
+	referralCodeAttempts = 5
+)
+
+// ReferralConfig настройки реферальной программы.
+type ReferralConfig struct {
+	// Бонусы пригласившему и приглашенному
+	ReferrerCoins int `mapstructure:"referrerCoins"`
+	RefereeCoins  int `mapstructure:"refereeCoins"`
+	// Приглашение засчитывается, когда серия ежедневных наград приглашенного дойдет до этого дня
+	QualifyStreak int `mapstructure:"qualifyStreak"`
+	// Защита от накруток: сколько приглашенных может зарегистрироваться
+	// с одного IP и одного устройства за Window, 0 - без ограничений
+	MaxPerIP     int           `mapstructure:"maxPerIP"`
+	MaxPerDevice int           `mapstructure:"maxPerDevice"`
+	Window       time.Duration `mapstructure:"window"`
+}
+
+type ReferralService struct {
+	repo  repository.Referrals
+	coins Coins
+	cfg   ReferralConfig
+}
+
+func NewReferralService(repo repository.Referrals, coins Coins, events Events, cfg ReferralConfig) *ReferralService {
+	service := &ReferralService{
+		repo:  repo,
+		coins: coins,
+		cfg:   cfg,
+	}
+
+	events.Subscribe(referralsGroup, service.handleEvent)
+
+	return service
+}
+
+func generateReferralCode() (string, error) {
+	bytes := make([]byte, referralCodeLength)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	for i, b := range bytes {
+		bytes[i] = redeemCodeAlphabet[b&31]
+	}
+	return string(bytes), nil
+}
+
+// referralCode возвращает код пользователя, создавая его при первом обращении.
+func (s *ReferralService) referralCode(userId int) (string, error) {
+	for range referralCodeAttempts {
+		code, err := s.repo.GetReferralCode(userId)
+		if err != nil || code != "" {
+			return code, err
+		}
+
+		if code, err = generateReferralCode(); err != nil {
+			return "", err
+		}
+		err = s.repo.SetReferralCode(userId, code)
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+			continue // Код уже занят, пробуем другой
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	return s.repo.GetReferralCode(userId)
+}
+
+// ResolveReferralCode находит пригласившего по коду, введенному при регистрации.
+func (s *ReferralService) ResolveReferralCode(code string) (int, error) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if len(code) != referralCodeLength {
+		return 0, rest.ErrReferralCodeNotFound
+	}
+	referrerId, err := s.repo.GetUserIdByReferralCode(code)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, rest.ErrReferralCodeNotFound
+		}
+		return 0, rest.NewInternalServerError(err)
+	}
+	return referrerId, nil
+}
+
+// newReferral приглашение нового пользователя по коду. Ограничения по IP и устройству проверяются
+// при сохранении, в одной транзакции с регистрацией.
+func (s *ReferralService) newReferral(code string, signUp rest.ReferralSignUp) (*rest.Referral, error) {
+	referrerId, err := s.ResolveReferralCode(code)
+	if err != nil {
+		return nil, err
+	}
+
+	referral := &rest.Referral{
+		ReferrerID: referrerId,
+		Status:     rest.ReferralStatusPending,
+	}
+	// Лимит по IP действует и без отпечатка устройства: заголовок клиент может просто не прислать
+	if signUp.IP != "" {
+		referral.SignupIP = &signUp.IP
+	}
+	if signUp.DeviceFingerprint != "" {
+		// Отпечаток может быть длинным и содержать лишнее, храним только хеш
+		sum := sha256.Sum256([]byte(signUp.DeviceFingerprint))
+		fingerprint := hex.EncodeToString(sum[:])
+		referral.DeviceFingerprint = &fingerprint
+	}
+	return referral, nil
+}
+
+// limits ограничения регистраций по приглашениям с одного IP и устройства.
+func (s *ReferralService) limits() repository.ReferralLimits {
+	return repository.ReferralLimits{
+		MaxPerIP:     s.cfg.MaxPerIP,
+		MaxPerDevice: s.cfg.MaxPerDevice,
+		Since:        time.Now().Add(-s.cfg.Window),
+	}
+}
+
+// handleEvent засчитывает приглашение, когда приглашенный набрал нужную серию ежедневных наград.
+func (s *ReferralService) handleEvent(event rest.Event) error {
+	if event.Type != rest.EventDailyRewardClaimed || event.Value < s.cfg.QualifyStreak {
+		return nil
+	}
+
+	referral, err := s.repo.GetReferral(event.UserID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if referral.Status != rest.ReferralStatusPending {
+		return nil
+	}
+
+	// Бонусы выдаются до смены статуса: журнал монет не даст выдать их дважды при повторной обработке
+	referenceId := strconv.Itoa(referral.RefereeID)
+	bonuses := []struct {
+		userId, coins int
+		reason        string
+	}{
+		{referral.ReferrerID, s.cfg.ReferrerCoins, rest.CoinReasonReferrerBonus},
+		{referral.RefereeID, s.cfg.RefereeCoins, rest.CoinReasonRefereeBonus},
+	}
+	for _, bonus := range bonuses {
+		if bonus.coins <= 0 {
+			continue
+		}
+		_, err := s.coins.ChangeCoins(bonus.userId, bonus.coins, bonus.reason, referenceId)
+		if err != nil && !errors.Is(err, rest.ErrCoinTransactionExists) {
+			return err
+		}
+	}
+
+	return s.repo.QualifyReferral(referral.RefereeID)
+}
+
+// GetReferralStats реферальный код пользователя и его приглашенные.
+func (s *ReferralService) GetReferralStats(userId int) (rest.ReferralStats, error) {
+	code, err := s.referralCode(userId)
+	if err != nil {
+		return rest.ReferralStats{}, rest.NewInternalServerError(err)
+	}
+	referrals, err := s.repo.GetReferrals(userId)
+	if err != nil {
+		return rest.ReferralStats{}, rest.NewInternalServerError(err)
+	}
+	coins, err := s.repo.GetReferralCoins(userId)
+	if err != nil {
+		return rest.ReferralStats{}, rest.NewInternalServerError(err)
+	}
+
+	stats := rest.ReferralStats{
+		Code:        code,
+		Invited:     len(referrals),
+		CoinsEarned: coins,
+		Referrals:   referrals,
+	}
+	for _, referral := range referrals {
+		switch referral.Status {
+		case rest.ReferralStatusPending:
+			stats.Pending++
+		case rest.ReferralStatusQualified:
+			stats.Qualified++
+		case rest.ReferralStatusRejected:
+			stats.Rejected++
+		}
+	}
+	return stats, nil
+}
@@ -1,39 +1,184 @@
 package service
 
 import (
+	"context"
+	"net/http"
+	"time"
+
 	"github.com/ArtemChadaev/go"
+	"github.com/ArtemChadaev/go/pkg/queue"
 	"github.com/ArtemChadaev/go/pkg/repository"
+	"github.com/ArtemChadaev/go/pkg/scheduler"
 	"github.com/redis/go-redis/v9"
 )
 
 type Autorization interface {
-	CreateUser(user rest.User) (int, error)
+	CreateUser(user rest.User, signUp rest.ReferralSignUp) (int, error)
 	GenerateTokens(email, password string) (tokens rest.ResponseTokens, err error)
 	GetAccessToken(refreshToken string) (tokens rest.ResponseTokens, err error)
 	ParseToken(accessToken string) (int, error)
 	UnAuthorize(refreshToken string) error
 	UnAuthorizeAll(email, password string) error
+	IsAdmin(userId int) (bool, error)
 }
 type UserSettings interface {
-	CreateInitialUserSettings(userId int, name string) error
+	InitialUserSettings(name string) rest.UserSettings
 	GetByUserID(userId int) (rest.UserSettings, error)
 	UpdateInfo(userId int, name, icon string) error
-	ChangeCoins(userId, amount int) error
-	ActivateSubscription(userId, daysToAdd int, paymentToken string) error
-	GetGrantDailyReward(userId int) error
+	SetTimezone(userId int, timezone string) error
+	GetSubscriptionPlans() ([]rest.SubscriptionPlan, error)
+	BuySubscriptionWithCoins(userId int, planCode string) (rest.Subscription, error)
+	StartTrial(userId int) (rest.Subscription, error)
+	SetAutoRenew(userId int, autoRenew bool) error
+	CancelSubscription(userId int) (rest.Subscription, error)
+	ExtendSubscription(userId, days int) (time.Time, error)
+	HasPaidSubscription(userId int) (bool, error)
+	GetEntitlements(userId int) (rest.Entitlements, error)
+	RequireEntitlement(userId int, feature string) error
+}
+type DailyReward interface {
+	GetGrantDailyReward(userId int) (rest.DailyRewardClaim, error)
+	GetDailyRewardStatus(userId int) (rest.DailyRewardStatus, error)
+}
+type Coins interface {
+	ChangeCoins(userId, amount int, reason, referenceId string) (rest.CoinTransaction, error)
+	TransferCoins(fromUserId int, input rest.CoinTransferInput) (rest.CoinTransfer, error)
+	GetCoinHistory(userId, limit, offset int) (rest.CoinHistory, error)
+}
+type Redeem interface {
+	CreateRedeemBatch(adminId int, input rest.RedeemBatchInput) (rest.RedeemBatch, error)
+	ExportRedeemBatch(batchId int) (rest.RedeemExport, error)
+	GetRedeemExport(exportId string) (rest.RedeemExport, []byte, error)
+	RedeemCode(userId int, code string) (rest.RedeemResult, error)
+}
+type Leaderboard interface {
+	GetLeaderboard(userId int, query rest.LeaderboardQuery) (rest.Leaderboard, error)
+	RebuildLeaderboards() error
+	TrackCoinTransaction(transaction rest.CoinTransaction)
+	TrackClanMembership(userId, clanId int, joined bool)
+	DeleteClanLeaderboards(clanId int)
+}
+type Events interface {
+	Publish(event rest.Event)
+	CoinsChanged(transaction rest.CoinTransaction)
+	Subscribe(group string, handle func(event rest.Event) error)
+	Consume(ctx context.Context)
+	RetainedSince(ctx context.Context) (time.Time, error)
+}
+type Achievements interface {
+	GetAchievements(userId int) ([]rest.AchievementStatus, error)
+}
+type Referrals interface {
+	GetReferralStats(userId int) (rest.ReferralStats, error)
+}
+type Payments interface {
+	GetCoinPacks() []rest.CoinPack
+	CreateSubscriptionCheckout(userId int, planCode string, autoRenew bool) (rest.Payment, error)
+	CreateCoinsCheckout(userId int, packCode string) (rest.Payment, error)
+	GetPayment(userId int, paymentId string) (rest.Payment, error)
+	HandlePaymentWebhook(provider string, header http.Header, body []byte) error
+	RenewSubscription(ctx context.Context, renewal rest.SubscriptionRenewal) error
+}
+type Notifications interface {
+	GetNotifications(userId, limit, offset int) (rest.NotificationList, error)
+	MarkNotificationsRead(userId int, ids []int64) error
+	SendExpiryReminders(ctx context.Context) error
+	NotifySubscriptionExpired(expiry rest.SubscriptionExpiry) error
+	NotifyRenewalFailed(userId int, paymentId string) error
+}
+type Clans interface {
+	CreateClan(userId int, input rest.ClanInput) (rest.Clan, error)
+	GetClan(clanId int) (rest.Clan, error)
+	UpdateClan(userId, clanId int, input rest.ClanUpdateInput) (rest.Clan, error)
+	DisbandClan(userId, clanId int) error
+	GetClanMembers(clanId int) ([]rest.ClanMember, error)
+	InviteToClan(userId, clanId, inviteeId int) (rest.ClanInvite, error)
+	RequestToJoinClan(userId, clanId int) (rest.ClanInvite, error)
+	GetClanInvites(userId, clanId int) ([]rest.ClanInvite, error)
+	GetMyClanInvites(userId int) ([]rest.ClanInvite, error)
+	AcceptClanInvite(userId, inviteId int) error
+	DeclineClanInvite(userId, inviteId int) error
+	LeaveClan(userId, clanId int) error
+	KickClanMember(userId, clanId, memberId int) error
+	PromoteClanMember(userId, clanId, memberId int) (rest.ClanMember, error)
+	DemoteClanMember(userId, clanId, memberId int) (rest.ClanMember, error)
+	GetClanRoles(clanId int) ([]rest.ClanRole, error)
+	UpdateClanRole(userId, clanId, roleId int, input rest.ClanRoleInput) (rest.ClanRole, error)
+}
+type Jobs interface {
+	JobsStatus(ctx context.Context) (rest.SchedulerStatus, error)
+}
+type Tasks interface {
+	DeadLetters(ctx context.Context, limit int) ([]queue.Task, error)
 }
 type Service struct {
 	Autorization
 	UserSettings
+	Coins
+	Redeem
+	DailyReward
+	Leaderboard
+	Achievements
+	Referrals
+	Payments
+	Notifications
+	Clans
+	Jobs
+	Tasks
+	Events
 }
 
-func NewService(repos *repository.Repository, redis *redis.Client) *Service {
-	userSettingsService := NewUserSettingsService(repos.UserSettings, redis)
+// Config настройки бизнес-логики из конфига.
+type Config struct {
+	Settings      UserSettingsConfig  `mapstructure:"settings"`
+	Coins         CoinsConfig         `mapstructure:"coins"`
+	DailyReward   DailyRewardConfig   `mapstructure:"dailyReward"`
+	Achievements  AchievementsConfig  `mapstructure:"achievements"`
+	Referrals     ReferralConfig      `mapstructure:"referrals"`
+	Subscriptions SubscriptionConfig  `mapstructure:"subscriptions"`
+	Payments      PaymentsConfig      `mapstructure:"payments"`
+	Notifications NotificationsConfig `mapstructure:"notifications"`
+	Clans         ClansConfig         `mapstructure:"clans"`
+}
+
+type CoinsConfig struct {
+	Transfer TransferConfig `mapstructure:"transfer"`
+}
+
+func NewService(repos *repository.Repository, redis *redis.Client, jobs *scheduler.Scheduler, tasks *queue.Queue,
+	cfg Config) *Service {
+	leaderboardService := NewLeaderboardService(repos.Leaderboards, repos.UserSettings, redis)
+	eventService := NewEventService(redis, leaderboardService)
+	coinService := NewCoinService(repos.Coins, repos.UserSettings, eventService, cfg.Coins.Transfer)
+	notificationService := NewNotificationService(repos.Notifications, repos.Autorization, tasks, cfg.Notifications)
+	paymentService := NewPaymentService(repos.Payments, repos.Subscriptions, notificationService, eventService, redis,
+		cfg.Payments, cfg.Subscriptions)
+	userSettingsService := NewUserSettingsService(repos.UserSettings, repos.Subscriptions, paymentService,
+		notificationService, eventService, redis, cfg.Settings, cfg.Subscriptions)
+
+	referralService := NewReferralService(repos.Referrals, coinService, eventService, cfg.Referrals)
+	authService := NewAuthService(repos.Autorization, userSettingsService, referralService, eventService)
+	achievementService := NewAchievementService(repos.Achievements, coinService, eventService, cfg.Achievements.Catalog)
 
-	authService := NewAuthService(repos.Autorization, userSettingsService)
+	// Фоновые задачи, расписание в секции scheduler конфига
+	jobs.Register("subscriptions", userSettingsService.CheckSubscriptions)
+	jobs.Register("leaderboard_archive", leaderboardService.ArchivePreviousWeek)
+	jobs.Register("achievement_events_cleanup", achievementService.PruneProcessedEvents)
 
 	return &Service{
-		Autorization: authService,
-		UserSettings: userSettingsService,
+		Autorization:  authService,
+		UserSettings:  userSettingsService,
+		Coins:         coinService,
+		Redeem:        NewRedeemService(repos.Redeem, eventService, redis, tasks),
+		DailyReward:   NewDailyRewardService(repos.DailyRewards, userSettingsService, eventService, redis, cfg.DailyReward),
+		Leaderboard:   leaderboardService,
+		Achievements:  achievementService,
+		Referrals:     referralService,
+		Payments:      paymentService,
+		Notifications: notificationService,
+		Clans:         NewClanService(repos.Clan, userSettingsService, leaderboardService, eventService, cfg.Clans),
+		Jobs:          jobs,
+		Tasks:         tasks,
+		Events:        eventService,
 	}
 }
@@ -0,0 +1,159 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/ArtemChadaev/go"
+	"github.com/ArtemChadaev/go/pkg/repository"
+	"github.com/ArtemChadaev/go/pkg/scheduler"
+	"github.com/sirupsen/logrus"
+)
+
+// SubscriptionConfig настройки подписки.
+type SubscriptionConfig struct {
+	// Тариф для подписки без тарифа: подаренной наградами или купленной до их появления
+	DefaultPlan string      `mapstructure:"defaultPlan"`
+	Trial       TrialConfig `mapstructure:"trial"`
+	// За сколько до окончания подписки списывается оплата автопродления
+	RenewBefore time.Duration `mapstructure:"renewBefore"`
+	// Сколько подписка еще работает, если автопродление не прошло
+	GracePeriod time.Duration `mapstructure:"gracePeriod"`
+	// В льготный период списание повторяется не чаще renewRetryInterval, всего попыток renewAttempts
+	RenewRetryInterval time.Duration `mapstructure:"renewRetryInterval"`
+	RenewAttempts      int           `mapstructure:"renewAttempts"`
+}
+
+// TrialConfig пробный период, один раз на аккаунт.
+type TrialConfig struct {
+	Plan string `mapstructure:"plan"`
+	// 0 - пробного периода нет
+	Days int `mapstructure:"days"`
+}
+
+// GetSubscriptionPlans тарифы, которые можно купить.
+func (s *UserSettingsService) GetSubscriptionPlans() ([]rest.SubscriptionPlan, error) {
+	plans, err := s.plans.GetSubscriptionPlans()
+	if err != nil {
+		return nil, rest.NewInternalServerError(err)
+	}
+	return plans, nil
+}
+
+// activePlan тариф активной подписки пользователя, nil - если подписки нет.
+func (s *UserSettingsService) activePlan(settings rest.UserSettings) (*rest.SubscriptionPlan, error) {
+	if !hasActiveSubscription(settings) {
+		return nil, nil
+	}
+
+	var plan rest.SubscriptionPlan
+	var err error
+	if settings.SubscriptionPlanID != nil {
+		plan, err = s.plans.GetSubscriptionPlanById(*settings.SubscriptionPlanID)
+	} else {
+		plan, err = s.plans.GetSubscriptionPlan(s.subscriptionCfg.DefaultPlan)
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &plan, nil
+}
+
+// BuySubscriptionWithCoins покупает или продлевает подписку за монеты по цене тарифа.
+func (s *UserSettingsService) BuySubscriptionWithCoins(userId int, planCode string) (rest.Subscription, error) {
+	plan, err := s.plans.GetSubscriptionPlan(planCode)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return rest.Subscription{}, rest.ErrSubscriptionPlanNotFound
+		}
+		return rest.Subscription{}, rest.NewInternalServerError(err)
+	}
+	if plan.CoinPrice == nil || *plan.CoinPrice <= 0 {
+		return rest.Subscription{}, rest.ErrSubscriptionPlanNotForCoins
+	}
+
+	subscription, err := s.plans.PurchaseSubscriptionWithCoins(userId, plan)
+	if err != nil {
+		return subscription, coinsError(err)
+	}
+	s.redis.Del(context.Background(), entitlementsKey(userId))
+
+	s.events.CoinsChanged(*subscription.Transaction)
+	s.events.Publish(rest.Event{
+		Type:   rest.EventSubscriptionPurchased,
+		UserID: userId,
+		Value:  plan.DurationDays,
+	})
+	return subscription, nil
+}
+
+// StartTrial включает пробный период по тарифу из конфига.
+func (s *UserSettingsService) StartTrial(userId int) (rest.Subscription, error) {
+	if s.subscriptionCfg.Trial.Days <= 0 {
+		return rest.Subscription{}, rest.ErrTrialUnavailable
+	}
+	plan, err := s.plans.GetSubscriptionPlan(s.subscriptionCfg.Trial.Plan)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return rest.Subscription{}, rest.ErrSubscriptionPlanNotFound
+		}
+		return rest.Subscription{}, rest.NewInternalServerError(err)
+	}
+
+	subscription, err := s.plans.StartTrial(userId, plan, s.subscriptionCfg.Trial.Days)
+	switch {
+	case errors.Is(err, repository.ErrTrialUnavailable):
+		return subscription, rest.ErrTrialUnavailable
+	case errors.Is(err, sql.ErrNoRows):
+		return subscription, rest.ErrUserNotFound
+	case err != nil:
+		return subscription, rest.NewInternalServerError(err)
+	}
+	s.redis.Del(context.Background(), entitlementsKey(userId))
+	return subscription, nil
+}
+
+// SetAutoRenew включает или выключает автопродление подписки.
+func (s *UserSettingsService) SetAutoRenew(userId int, autoRenew bool) error {
+	if err := s.plans.SetAutoRenew(userId, autoRenew); err != nil {
+		return rest.NewInternalServerError(err)
+	}
+	return nil
+}
+
+// CancelSubscription отменяет подписку. Она не продлится, но работает до конца оплаченного срока.
+func (s *UserSettingsService) CancelSubscription(userId int) (rest.Subscription, error) {
+	subscription, err := s.plans.CancelSubscription(userId)
+	if err != nil {
+		if errors.Is(err, repository.ErrSubscriptionNotActive) {
+			return subscription, rest.ErrNoActiveSubscription
+		}
+		return subscription, rest.NewInternalServerError(err)
+	}
+	return subscription, nil
+}
+
+// renewSubscriptions списывает оплату за подписки с автопродлением, которые скоро закончатся.
+// Ошибка возвращается, только если задачу нужно прервать: сервис останавливается или лидерство потеряно.
+func (s *UserSettingsService) renewSubscriptions(ctx context.Context) error {
+	renewals, err := s.plans.GetSubscriptionsDueForRenewal(s.subscriptionCfg.RenewBefore,
+		s.subscriptionCfg.RenewRetryInterval, max(s.subscriptionCfg.RenewAttempts, 1))
+	if err != nil {
+		logrus.Errorf("Ошибка при поиске подписок для автопродления: %v", err)
+		return nil
+	}
+	for _, renewal := range renewals {
+		if err := scheduler.EnsureLeader(ctx); err != nil {
+			return err
+		}
+		if err := s.payments.RenewSubscription(ctx, renewal); err != nil {
+			logrus.Errorf("Ошибка автопродления подписки пользователя %d: %v", renewal.UserID, err)
+		}
+	}
+	return nil
+}
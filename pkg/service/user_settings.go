@@ -4,55 +4,66 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"fmt"
 	"time"
 
 	"github.com/ArtemChadaev/go"
 	"github.com/ArtemChadaev/go/pkg/repository"
+	"github.com/ArtemChadaev/go/pkg/scheduler"
 	"github.com/redis/go-redis/v9"
 	"github.com/sirupsen/logrus"
 )
 
-const (
-	// Простой токен для имитации успешной оплаты в pet-проекте
-	mockPaymentToken = "mock-success-payment-token"
+// Сколько кешируются возможности подписки пользователя
+const entitlementsCacheTTL = 5 * time.Minute
 
-	//Через каждые n минут удаляются все неактивные подписки
-	checkExpiredSubscriptionsInterval = 10 * time.Minute
-
-	//Количество монеток в день сколько можно получить
-	dayCoins = 3
-)
+// UserSettingsConfig настройки профиля пользователя.
+type UserSettingsConfig struct {
+	// Как часто можно менять часовой пояс, чтобы не получать ежедневную награду чаще раза в день
+	TimezoneChangeCooldown time.Duration `mapstructure:"timezoneChangeCooldown"`
+}
 
 type UserSettingsService struct {
-	repo  repository.UserSettings
-	redis *redis.Client
+	repo            repository.UserSettings
+	plans           repository.Subscriptions
+	payments        Payments
+	notifications   Notifications
+	events          Events
+	redis           *redis.Client
+	cfg             UserSettingsConfig
+	subscriptionCfg SubscriptionConfig
 }
 
-func NewUserSettingsService(repo repository.UserSettings, redis *redis.Client) *UserSettingsService {
-	service := &UserSettingsService{
-		repo:  repo,
-		redis: redis,
+func NewUserSettingsService(repo repository.UserSettings, plans repository.Subscriptions, payments Payments,
+	notifications Notifications, events Events, redis *redis.Client, cfg UserSettingsConfig, subscriptionCfg SubscriptionConfig) *UserSettingsService {
+	return &UserSettingsService{
+		repo:            repo,
+		plans:           plans,
+		payments:        payments,
+		notifications:   notifications,
+		events:          events,
+		redis:           redis,
+		cfg:             cfg,
+		subscriptionCfg: subscriptionCfg,
 	}
-
-	// Запускаем фоновую задачу для проверки подписок
-	go service.startSubscriptionChecker()
-
-	return service
 }
 
-// CreateInitialUserSettings создает начальные настройки для нового пользователя используется в auth.
-func (s *UserSettingsService) CreateInitialUserSettings(userId int, name string) error {
-	settings := rest.UserSettings{
-		UserID:             userId,
+// InitialUserSettings начальные настройки нового пользователя, auth сохраняет их вместе с пользователем.
+func (s *UserSettingsService) InitialUserSettings(name string) rest.UserSettings {
+	return rest.UserSettings{
 		Name:               name, // Используется часть email до @
 		DateOfRegistration: time.Now(),
 	}
-	return s.repo.CreateUserSettings(settings)
 }
 
-// GetByUserID возвращает настройки пользователя по его ID.
+// GetByUserID возвращает настройки пользователя по его ID вместе с тарифом активной подписки.
 func (s *UserSettingsService) GetByUserID(userId int) (rest.UserSettings, error) {
-	return s.repo.GetUserSettings(userId)
+	settings, err := s.repo.GetUserSettings(userId)
+	if err != nil {
+		return settings, err
+	}
+	settings.Plan, err = s.activePlan(settings)
+	return settings, err
 }
 
 // UpdateInfo обновляет основную информацию пользователя (имя и иконку).
@@ -69,9 +80,12 @@ func (s *UserSettingsService) UpdateInfo(userId int, name, icon string) error {
 	return s.repo.UpdateUserSettings(settings)
 }
 
-// ChangeCoins добавляет (или списывает) монеты пользователю.
-func (s *UserSettingsService) ChangeCoins(userId, coin int) error {
-	// Здесь бизнес-логика: мы не устанавливаем баланс, а изменяем его.
+// SetTimezone меняет часовой пояс пользователя, имя проверяется по базе IANA.
+func (s *UserSettingsService) SetTimezone(userId int, timezone string) error {
+	if _, err := loadTimezone(timezone); err != nil {
+		return rest.ErrInvalidTimezone
+	}
+
 	settings, err := s.repo.GetUserSettings(userId)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
@@ -79,99 +93,82 @@ func (s *UserSettingsService) ChangeCoins(userId, coin int) error {
 		}
 		return err
 	}
-
-	newBalance := settings.Coin + coin
-	if newBalance < 0 {
-		return rest.ErrNoCoins
+	if settings.Timezone == timezone {
+		return nil
+	}
+	if settings.TimezoneUpdatedAt != nil && time.Since(*settings.TimezoneUpdatedAt) < s.cfg.TimezoneChangeCooldown {
+		return rest.ErrTimezoneChangeTooSoon
 	}
 
-	return s.repo.UpdateUserCoin(userId, newBalance)
+	return s.repo.UpdateUserTimezone(userId, timezone)
 }
 
-// ActivateSubscription активирует или продлевает подписку.
-// В 'paymentToken' мы ожидаем некий токен от "платежной системы".
-func (s *UserSettingsService) ActivateSubscription(userId, daysToAdd int, paymentToken string) error {
-	// --- Защита от прямого вызова ---
-	// В реальном проекте здесь была бы проверка токена через API платежной системы.
-	// Для pet-проекта мы просто сравниваем его с константой.
-	if paymentToken != mockPaymentToken {
-		return rest.ErrPaymentFailed
+// loadTimezone загружает часовой пояс по имени IANA. "Local" и пустое имя не принимаются,
+// потому что зависят от настроек сервера.
+func loadTimezone(name string) (*time.Location, error) {
+	if name == "" || name == "Local" {
+		return nil, errors.New("unknown time zone " + name)
 	}
+	return time.LoadLocation(name)
+}
 
-	settings, err := s.repo.GetUserSettings(userId)
+// ExtendSubscription продлевает подписку без оплаты: награды, промокоды.
+// Активная подписка продлевается, истекшая начинается заново.
+func (s *UserSettingsService) ExtendSubscription(userId, days int) (time.Time, error) {
+	until, err := s.repo.ExtendPaidSubscription(userId, days)
 	if err != nil {
 		// Если настроек нет (хотя должны быть), возвращаем ошибку
 		if errors.Is(err, sql.ErrNoRows) {
-			return rest.ErrUserNotFound
+			return until, rest.ErrUserNotFound
 		}
-		return err
+		return until, err
 	}
+	s.redis.Del(context.Background(), entitlementsKey(userId))
 
-	var newExpirationDate time.Time
-
-	// --- Логика продления ---
-	// Если подписка уже активна и не истекла, добавляем дни к дате окончания.
-	if settings.PaidSubscription && settings.DateOfPaidSubscription != nil && settings.DateOfPaidSubscription.After(time.Now()) {
-		newExpirationDate = settings.DateOfPaidSubscription.AddDate(0, 0, daysToAdd)
-	} else {
-		// Иначе, даем подписку от текущего момента.
-		newExpirationDate = time.Now().AddDate(0, 0, daysToAdd)
-	}
+	return until, nil
+}
 
-	return s.repo.BuyPaidSubscription(userId, newExpirationDate)
+// hasActiveSubscription подписка оплачена и еще не истекла или идет льготный период после неудачного автопродления.
+func hasActiveSubscription(settings rest.UserSettings) bool {
+	now := time.Now()
+	return settings.PaidSubscription &&
+		(settings.DateOfPaidSubscription != nil && settings.DateOfPaidSubscription.After(now) ||
+			settings.SubscriptionGraceUntil != nil && settings.SubscriptionGraceUntil.After(now))
 }
 
-// GetGrantDailyReward даёт 3 монетки раз в день
-func (s *UserSettingsService) GetGrantDailyReward(userId int) error {
-	// Ключ в Redis будет уникальным для каждого дня, например, "daily_rewards:2025-09-27"
-	key := "daily_rewards:" + time.Now().UTC().Format("2006-01-02")
+// HasPaidSubscription проверяет, есть ли у пользователя активная платная подписка.
+func (s *UserSettingsService) HasPaidSubscription(userId int) (bool, error) {
+	entitlements, err := s.GetEntitlements(userId)
+	return entitlements.Active, err
+}
 
-	// SAdd добавит ID пользователя в "множество" (set) и вернет 1, если ID новый,
-	// или 0, если ID там уже был. Это атомарная операция.
-	added, err := s.redis.SAdd(context.Background(), key, userId).Result()
-	if err != nil {
+// CheckSubscriptions фоновая задача планировщика: продлевает подписки с автопродлением,
+// напоминает об окончании и деактивирует просроченные.
+func (s *UserSettingsService) CheckSubscriptions(ctx context.Context) error {
+	if err := s.renewSubscriptions(ctx); err != nil {
 		return err
 	}
-
-	// Если ID не был добавлен (уже там был), значит награду получал.
-	if added == 0 {
-		return rest.ErrDayCoin // Награда уже получена сегодня
+	if err := s.notifications.SendExpiryReminders(ctx); err != nil {
+		return err
 	}
-
-	// Если ID был добавлен успешно, значит это первая выдача сегодня.
-	// Устанавливаем "срок жизни" для ключа, чтобы он автоматически удалился через 25 часов.
-	// Это избавляет нас от необходимости сбрасывать кеш вручную.
-	s.redis.Expire(context.Background(), key, 24*time.Hour)
-
-	// Теперь обновляем монеты в основной БД.
-	if err := s.ChangeCoins(userId, dayCoins); err != nil { // Предполагаем, что этот метод прибавляет монеты
-		s.redis.SRem(context.Background(), key, userId)
+	if err := scheduler.EnsureLeader(ctx); err != nil {
 		return err
 	}
 
-	return nil
-}
-
-// startSubscriptionChecker - это внутренний метод, который в бесконечном цикле
-// проверяет и деактивирует просроченные подписки.
-func (s *UserSettingsService) startSubscriptionChecker() {
-	ticker := time.NewTicker(checkExpiredSubscriptionsInterval)
-	defer ticker.Stop()
-
-	logrus.Infof("Запущена фоновая задача: проверка подписок каждые %v", checkExpiredSubscriptionsInterval)
-
-	for {
-		<-ticker.C // Ожидаем следующего тика
-
-		logrus.Info("Выполняется плановая проверка просроченных подписок...")
-		rowsAffected, err := s.repo.DeactivateExpiredSubscriptions()
-		if err != nil {
-			logrus.Errorf("Ошибка при деактивации просроченных подписок: %v", err)
-			continue
-		}
+	expired, err := s.repo.DeactivateExpiredSubscriptions()
+	if err != nil {
+		return fmt.Errorf("can't deactivate expired subscriptions: %w", err)
+	}
 
-		if rowsAffected > 0 {
-			logrus.Infof("Успешно деактивировано %d просроченных подписок", rowsAffected)
+	if len(expired) > 0 {
+		logrus.Infof("Успешно деактивировано %d просроченных подписок", len(expired))
+	}
+	for _, expiry := range expired {
+		// Подписки уже выключены, кэш и уведомления нужны в любом случае
+		s.redis.Del(ctx, entitlementsKey(expiry.UserID))
+		if err := s.notifications.NotifySubscriptionExpired(expiry); err != nil {
+			logrus.Errorf("Ошибка уведомления об окончании подписки пользователя %d: %v", expiry.UserID, err)
 		}
 	}
+	return nil
 }
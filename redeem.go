@@ -0,0 +1,67 @@
+package rest
+
+import "time"
+
+// Типы наград промокодов
+const (
+	RedeemRewardCoins            = "coins"
+	RedeemRewardSubscriptionDays = "subscription_days"
+)
+
+// Статусы выгрузки партии
+const (
+	RedeemExportPending = "pending"
+	RedeemExportReady   = "ready"
+	RedeemExportFailed  = "failed"
+)
+
+// RedeemBatch партия промокодов с общей наградой.
+type RedeemBatch struct {
+	ID           int          `json:"id" db:"id"`
+	Name         string       `json:"name" db:"name" binding:"required"`
+	RewardType   string       `json:"rewardType" db:"reward_type" binding:"required,oneof=coins subscription_days"`
+	RewardAmount int          `json:"rewardAmount" db:"reward_amount" binding:"required,gt=0"`
+	MaxUses      int          `json:"maxUses" db:"max_uses" binding:"required,gt=0"`
+	ExpiresAt    *time.Time   `json:"expiresAt" db:"expires_at"`
+	CreatedBy    *int         `json:"createdBy" db:"created_by"`
+	CreatedAt    time.Time    `json:"createdAt" db:"created_at"`
+	Codes        []RedeemCode `json:"codes,omitempty" db:"-"`
+}
+
+// RedeemBatchInput запрос администратора на выпуск партии.
+type RedeemBatchInput struct {
+	RedeemBatch
+	// Сколько кодов сгенерировать
+	Count int `json:"count" binding:"required,gt=0,lte=10000"`
+}
+
+type RedeemCode struct {
+	ID      int    `json:"-" db:"id"`
+	BatchID int    `json:"-" db:"batch_id"`
+	Code    string `json:"code" db:"code"`
+	Uses    int    `json:"uses" db:"uses"`
+}
+
+type RedeemInput struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// RedeemResult что получил пользователь за код.
+type RedeemResult struct {
+	RewardType   string `json:"rewardType"`
+	RewardAmount int    `json:"rewardAmount"`
+	// Заполняется для награды монетами
+	Balance *int `json:"balance,omitempty"`
+	// Заполняется для награды днями подписки
+	SubscriptionUntil *time.Time `json:"subscriptionUntil,omitempty"`
+}
+
+// RedeemExport выгрузка кодов партии в CSV. Собирается в очереди задач, файл хранится ограниченное время.
+type RedeemExport struct {
+	ID         string     `json:"id"`
+	BatchID    int        `json:"batchId"`
+	Status     string     `json:"status"`
+	Error      string     `json:"error,omitempty"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	FinishedAt *time.Time `json:"finishedAt,omitempty"`
+}
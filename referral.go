@@ -0,0 +1,51 @@
+package rest
+
+import "time"
+
+// Статусы приглашений
+const (
+	// Ждем, пока приглашенный выполнит условие
+	ReferralStatusPending = "pending"
+	// Условие выполнено, бонусы выданы
+	ReferralStatusQualified = "qualified"
+	// Отклонено защитой от накруток, бонусов не будет
+	ReferralStatusRejected = "rejected"
+)
+
+// Причины отклонения приглашения
+const (
+	ReferralRejectIPLimit     = "ip_limit"
+	ReferralRejectDeviceLimit = "device_limit"
+)
+
+// ReferralSignUp откуда пришла регистрация по приглашению.
+type ReferralSignUp struct {
+	IP                string
+	DeviceFingerprint string
+}
+
+// Referral приглашенный пользователь.
+type Referral struct {
+	RefereeID  int    `json:"userId" db:"referee_id"`
+	ReferrerID int    `json:"-" db:"referrer_id"`
+	Name       string `json:"name" db:"name"`
+	Status     string `json:"status" db:"status"`
+	// Причина отклонения пригласившему не показывается, чтобы не подсказывать, как обойти защиту
+	RejectReason      *string    `json:"-" db:"reject_reason"`
+	SignupIP          *string    `json:"-" db:"signup_ip"`
+	DeviceFingerprint *string    `json:"-" db:"device_fingerprint"`
+	CreatedAt         time.Time  `json:"createdAt" db:"created_at"`
+	QualifiedAt       *time.Time `json:"qualifiedAt" db:"qualified_at"`
+}
+
+// ReferralStats реферальный код пользователя и статистика приглашений.
+type ReferralStats struct {
+	Code      string `json:"code"`
+	Invited   int    `json:"invited"`
+	Pending   int    `json:"pending"`
+	Qualified int    `json:"qualified"`
+	Rejected  int    `json:"rejected"`
+	// Сколько монет получено за приглашения
+	CoinsEarned int        `json:"coinsEarned"`
+	Referrals   []Referral `json:"referrals"`
+}
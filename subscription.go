@@ -0,0 +1,146 @@
+package rest
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// Действия в истории подписки
+const (
+	SubscriptionActionPurchase = "purchase"
+	SubscriptionActionRenewal  = "renewal"
+	// Дни подписки за награды и промокоды
+	SubscriptionActionGrant  = "grant"
+	SubscriptionActionCancel = "cancel"
+	// Возврат денег за покупку, срок подписки уменьшается
+	SubscriptionActionRefund = "refund"
+	// Пробный период, один раз на аккаунт
+	SubscriptionActionTrial = "trial"
+)
+
+// Возможности тарифов, ключи PlanPerks
+const (
+	// Пропуск дня без потери серии ежедневных наград
+	PerkStreakFreeze = "streakFreeze"
+	// Повышенный лимит запросов
+	PerkPaidRateLimit = "paidRateLimit"
+	// Аватар большего размера
+	PerkBigAvatar = "bigAvatar"
+	// Сколько человек может быть в клане владельца, числовой лимит
+	PerkClanMemberLimit = "clanMemberLimit"
+)
+
+// PlanPerks что дает тариф: флаги возможностей и числовые лимиты. Хранится в JSONB.
+type PlanPerks map[string]interface{}
+
+// Has возможность включена: флаг true, положительный лимит или непустая строка.
+func (p PlanPerks) Has(perk string) bool {
+	switch v := p[perk].(type) {
+	case bool:
+		return v
+	case float64:
+		return v > 0
+	case string:
+		return v != ""
+	}
+	return false
+}
+
+// Limit числовой лимит возможности, 0 - если не задан.
+func (p PlanPerks) Limit(perk string) int {
+	v, _ := p[perk].(float64)
+	return int(v)
+}
+
+func (p PlanPerks) Value() (driver.Value, error) {
+	if p == nil {
+		return []byte("{}"), nil
+	}
+	return json.Marshal(p)
+}
+
+func (p *PlanPerks) Scan(src interface{}) error {
+	var data []byte
+	switch v := src.(type) {
+	case nil:
+		*p = PlanPerks{}
+		return nil
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return errors.New("unsupported type for plan perks")
+	}
+	return json.Unmarshal(data, p)
+}
+
+// SubscriptionPlan тариф подписки.
+type SubscriptionPlan struct {
+	ID           int    `json:"id" db:"id"`
+	Code         string `json:"code" db:"code"`
+	Name         string `json:"name" db:"name"`
+	DurationDays int    `json:"durationDays" db:"duration_days"`
+	// Цена в копейках
+	Price    int    `json:"price" db:"price"`
+	Currency string `json:"currency" db:"currency"`
+	// Цена в монетах, nil - за монеты не продается
+	CoinPrice *int      `json:"coinPrice" db:"coin_price"`
+	Perks     PlanPerks `json:"perks" db:"perks"`
+	Active    bool      `json:"-" db:"active"`
+	CreatedAt time.Time `json:"-" db:"created_at"`
+}
+
+// Subscription запись в истории подписки.
+type Subscription struct {
+	ID     int64  `json:"id" db:"id"`
+	UserID int    `json:"-" db:"user_id"`
+	PlanID *int   `json:"planId" db:"plan_id"`
+	Action string `json:"action" db:"action"`
+	Days   int    `json:"days" db:"days"`
+	// Дата окончания подписки после операции
+	EndsAt      *time.Time `json:"endsAt" db:"ends_at"`
+	ReferenceID *string    `json:"-" db:"reference_id"`
+	CreatedAt   time.Time  `json:"createdAt" db:"created_at"`
+
+	Plan *SubscriptionPlan `json:"plan,omitempty" db:"-"`
+	// Списание монет, если подписка куплена за них
+	Transaction *CoinTransaction `json:"transaction,omitempty" db:"-"`
+}
+
+// Entitlements что доступно пользователю по активной подписке.
+type Entitlements struct {
+	Active bool `json:"active"`
+	// Код тарифа, пустой - подписки нет или тариф не найден
+	Plan  string    `json:"plan,omitempty"`
+	Perks PlanPerks `json:"perks"`
+	// До какого момента действует подписка с учетом льготного периода
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+}
+
+// SubscriptionRenewal подписка, которую пора продлить, и чем за нее платить.
+type SubscriptionRenewal struct {
+	UserID   int    `db:"user_id"`
+	PlanID   int    `db:"plan_id"`
+	Provider string `db:"provider"`
+	// ID прошлого успешного платежа у провайдера, его способ оплаты используется повторно
+	PaymentMethod string `db:"payment_method"`
+	// Окончание подписки, которое продлеваем, и номер попытки: после неудачи списание
+	// повторяется в льготный период
+	Period  time.Time `db:"period"`
+	Attempt int       `db:"attempt"`
+}
+
+// AutoRenewInput включение и отключение автопродления.
+type AutoRenewInput struct {
+	AutoRenew *bool `json:"autoRenew" binding:"required"`
+}
+
+// SubscriptionPurchaseInput покупка тарифа.
+type SubscriptionPurchaseInput struct {
+	PlanCode string `json:"plan" binding:"required"`
+	// Продлевать подписку автоматически, только при покупке у провайдера
+	AutoRenew bool `json:"autoRenew"`
+}
@@ -10,6 +10,8 @@ type User struct {
 	ID       int    `json:"-" db:"id"`
 	Email    string `json:"email" binding:"required"`
 	Password string `json:"password" binding:"required"`
+	// Реферальный код пригласившего, только при регистрации
+	ReferralCode string `json:"referralCode,omitempty" db:"-"`
 }
 
 type RefreshToken struct {
@@ -31,4 +33,19 @@ type UserSettings struct {
 	DateOfRegistration     time.Time  `json:"dateOfRegistration" db:"date_of_registration"`
 	PaidSubscription       bool       `json:"paidSubscription" db:"paid_subscription"`
 	DateOfPaidSubscription *time.Time `json:"dateOfPaidSubscription" db:"date_of_paid_subscription"`
+	Timezone               string     `json:"timezone" db:"timezone"`
+	TimezoneUpdatedAt      *time.Time `json:"-" db:"timezone_updated_at"`
+	SubscriptionPlanID     *int       `json:"-" db:"subscription_plan_id"`
+	AutoRenew              bool       `json:"autoRenew" db:"auto_renew"`
+	TrialUsedAt            *time.Time `json:"trialUsedAt" db:"trial_used_at"`
+	// Подписка отменена и не продлится, но работает до DateOfPaidSubscription
+	SubscriptionCanceledAt *time.Time `json:"subscriptionCanceledAt" db:"subscription_canceled_at"`
+	// Автопродление не прошло, подписка работает до этого момента
+	SubscriptionGraceUntil *time.Time `json:"subscriptionGraceUntil" db:"subscription_grace_until"`
+	// Тариф активной подписки вместе с его возможностями
+	Plan *SubscriptionPlan `json:"plan" db:"-"`
+}
+
+type TimezoneInput struct {
+	Timezone string `json:"timezone" binding:"required"`
 }